@@ -1,53 +1,160 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
+	"sync"
+	"time"
 
 	argparser "github.com/codecrafters-io/redis-starter-go/app/pkg/arg-parser"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
 	commandhandler "github.com/codecrafters-io/redis-starter-go/app/pkg/command-handler"
 	"github.com/codecrafters-io/redis-starter-go/app/pkg/config"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/persistence"
 	redisfileparser "github.com/codecrafters-io/redis-starter-go/app/pkg/redis-file-parser"
+	redisparser "github.com/codecrafters-io/redis-starter-go/app/pkg/redis-parser"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/response"
 	"github.com/codecrafters-io/redis-starter-go/app/pkg/storage"
 )
 
-func handleConnection(conn net.Conn, handler *commandhandler.CommandHandler) {
+func handleConnection(conn net.Conn, handler *commandhandler.CommandHandler, redisConfig config.RedisConfig) {
 	defer conn.Close()
+	limit := redisConfig.PubSubOutputLimit
+	outputLimit := client.OutputLimit{
+		Hard:    limit.HardBytes,
+		Soft:    limit.SoftBytes,
+		SoftFor: time.Duration(limit.SoftSeconds) * time.Second,
+	}
+
+	client := client.NewClient()
+	defer handler.CloseClient(client)
+	client.SetOutputLimit(outputLimit, func() { conn.Close() })
+	reader := redisparser.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+
+	// pushed messages are written by their own goroutine so a client that
+	// only listens still gets them, writeMu keeps them apart from replies
+	var writeMu sync.Mutex
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-client.PushReady():
+			}
+			writeMu.Lock()
+			if pushed := client.TakePushed(); len(pushed) > 0 {
+				writer.Write(pushed)
+				writer.Flush()
+			}
+			writeMu.Unlock()
+		}
+	}()
+
 	for {
-		buffer := make([]byte, 1024)
-		length, err := conn.Read(buffer)
+		command, err := reader.ReadCommand()
 		if err != nil {
-			fmt.Println("Error reading from connection:", err)
+			var protocolErr *redisparser.ProtocolError
+			if errors.As(err, &protocolErr) {
+				writeMu.Lock()
+				fmt.Fprintf(writer, "-ERR %s\r\n", protocolErr.Error())
+				writer.Flush()
+				writeMu.Unlock()
+			}
+			if err != io.EOF {
+				fmt.Println("Error reading from connection:", err)
+			}
 			return
 		}
 
-		if length > 0 {
-			response, err := handler.Handle(buffer, length)
-			if err != nil {
-				fmt.Printf("Error handling command: %v\n", err)
-				errorResponse := fmt.Sprintf("-ERR %s\r\n", err.Error())
-				conn.Write([]byte(errorResponse))
-				continue
+		// empty arrays are ignored like redis does
+		if command.Name != "" {
+			response := handler.HandleCommand(client, command)
+			if client.Blocked != nil {
+				writeMu.Lock()
+				err := writer.Flush()
+				writeMu.Unlock()
+				if err != nil {
+					fmt.Printf("Error writing response: %v\n", err)
+				}
+				response = waitBlocked(conn, reader, client)
 			}
+			// messages pushed while the command ran go out before its reply
+			writeMu.Lock()
+			writer.Write(client.TakePushed())
+			writer.Write(response.Encode(nil, client.Protocol))
+			writeMu.Unlock()
+		}
 
-			if response != nil {
-				redisResponse := response.ToRedisFormat()
-				_, writeErr := conn.Write([]byte(redisResponse))
-				if writeErr != nil {
-					fmt.Printf("Error writing response: %v\n", writeErr)
-					return
-				}
+		// replies of a pipeline are flushed together once it is drained
+		if reader.Buffered() == 0 {
+			writeMu.Lock()
+			err := writer.Flush()
+			writeMu.Unlock()
+			if err != nil {
+				fmt.Printf("Error writing response: %v\n", err)
+				return
 			}
 		}
 	}
 }
 
+// waitBlocked waits for the reply of a blocked client while watching the
+// connection, a client that disconnects stops waiting so it can not take
+// data away from the others
+func waitBlocked(conn net.Conn, reader *redisparser.Reader, client *client.Client) response.Value {
+	closed := make(chan struct{})
+	watching := make(chan struct{})
+	go func() {
+		defer close(watching)
+		// commands pipelined after the blocking one wait in the buffer
+		if err := reader.Peek(); err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+			close(closed)
+		}
+	}()
+
+	reply := client.Blocked.Wait(closed)
+	client.Blocked = nil
+
+	// stop the watcher before the connection is read again
+	conn.SetReadDeadline(time.Now())
+	<-watching
+	conn.SetReadDeadline(time.Time{})
+	return reply
+}
+
+// openAppendOnlyFile opens the AOF to load when appendonly is on, nil
+// when it is off or there is no manifest yet
+func openAppendOnlyFile(redisConfig config.RedisConfig) *persistence.AOFLoader {
+	if !redisConfig.AppendOnly {
+		return nil
+	}
+	if err := persistence.UpgradeAOF(redisConfig.AOFDir(), redisConfig.AOFPath()); err != nil {
+		fmt.Println("Error moving the append only file into its directory:", err)
+		os.Exit(1)
+	}
+	loader, err := persistence.NewAOFLoader(redisConfig.AOFDir(), redisConfig.AOFLoadTruncated)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		fmt.Println("Error opening the append only file:", err)
+		os.Exit(1)
+	}
+	return loader
+}
+
 // Todo move them out of main
 func HandleSlavePingStage(redisConfig config.RedisConfig) error {
 	fmt.Println("Pinging master")
 
-	masterAddr := fmt.Sprintf("%s:%s", redisConfig.MasterHost, redisConfig.MasterPort)
+	masterAddr := net.JoinHostPort(redisConfig.MasterHost, redisConfig.MasterPort)
 	conn, err := net.Dial("tcp", masterAddr)
 	if err != nil {
 		return fmt.Errorf("failed to connect to master at %s: %v", masterAddr, err)
@@ -85,21 +192,51 @@ func main() {
 		os.Exit(1)
 	}
 	argParserConfig := argParser.ParseArgsToRedisConfig()
+	// with appendonly the AOF has the data, the RDB file is only loaded
+	// when there is no AOF yet and --dir was given
 	var dataStorage storage.StorageInterface
-	if argParserConfig.Dir != "" {
-		redisFileParser := redisfileparser.NewRedisFileParser(argParserConfig.Dir + "/" + argParserConfig.DbFileName)
-
-		if redisFileParser.DoesRedisFileExists() {
-			_, data := redisFileParser.ParseFile()
-			dataStorage = storage.NewPersistanceStorage(data)
-		} else {
-			dataStorage = storage.NewInMemoryStorage()
+	aofLoader := openAppendOnlyFile(argParserConfig)
+	redisFileParser := redisfileparser.NewRedisFileParser(argParserConfig.RDBPath())
+	if aofLoader != nil {
+		data, err := aofLoader.LoadPreamble()
+		if err != nil {
+			fmt.Println("Error loading the append only file:", err)
+			os.Exit(1)
 		}
-
+		dataStorage = storage.NewPersistanceStorage(data)
+	} else if argParserConfig.Dir != "" && redisFileParser.DoesRedisFileExists() {
+		_, data := redisFileParser.ParseFile()
+		dataStorage = storage.NewPersistanceStorage(data)
 	} else {
 		dataStorage = storage.NewInMemoryStorage()
 	}
-	handler := commandhandler.NewCommandHandler(dataStorage, argParserConfig)
+	rdb := persistence.NewRDB(argParserConfig.RDBPath(), dataStorage, argParserConfig.SaveRules)
+	aof := persistence.NewAOF(argParserConfig.AOFDir(), dataStorage, argParserConfig.AppendFsync)
+	aof.SetAutoRewrite(argParserConfig.AutoAOFRewritePercentage, argParserConfig.AutoAOFRewriteMinSize)
+	handler := commandhandler.NewCommandHandler(dataStorage, rdb, aof, argParserConfig)
+
+	if aofLoader != nil {
+		loading := client.NewClient()
+		loading.DenyBlocking = true
+		dataStorage.SetLoading(true)
+		err := aofLoader.Replay(func(command *redisparser.Command) error {
+			return handler.ReplayCommand(loading, command)
+		})
+		if err != nil {
+			fmt.Println("Error loading the append only file:", err)
+			os.Exit(1)
+		}
+		dataStorage.SetLoading(false)
+		rdb.ClearDirty()
+	}
+	if argParserConfig.AppendOnly {
+		if err := aof.Start(); err != nil {
+			fmt.Println("Error opening the append only file:", err)
+			os.Exit(1)
+		}
+	}
+	dataStorage.StartActiveExpire()
+	rdb.StartSavePoints()
 
 	if argParserConfig.Role == config.RoleSlave {
 		err = HandleSlavePingStage(argParserConfig)
@@ -122,6 +259,6 @@ func main() {
 			fmt.Println("Error accepting connection: ", err.Error())
 			os.Exit(1)
 		}
-		go handleConnection(conn, handler)
+		go handleConnection(conn, handler, argParserConfig)
 	}
 }
@@ -14,6 +14,13 @@ type ArgParser struct {
 	port       *string
 	role       *string
 	replocaOf  *string
+	saveRules  []config.SaveRule
+
+	appendOnly       *bool
+	appendFsync      string
+	aofLoadTruncated *bool
+	rewritePercent   *int64
+	rewriteMinSize   *int64
 }
 
 func NewArgParser() *ArgParser {
@@ -25,6 +32,39 @@ func NewArgParser() *ArgParser {
 	parser.dbfilename = parser.flags.String("dbfilename", "", "Database filename")
 	parser.port = parser.flags.String("port", "", "Port for Redis")
 	parser.replocaOf = parser.flags.String("replicaof", "", "Master host and port (host port)")
+	parser.flags.Func("save", "Save points as <seconds> <changes> pairs, \"\" disables saving", func(value string) error {
+		rules, err := config.ParseSaveRules(value)
+		if err != nil {
+			return err
+		}
+		parser.saveRules = rules
+		return nil
+	})
+	parser.flags.Func("appendonly", "Log every write to the append only file, yes or no", func(value string) error {
+		enabled, err := config.ParseYesNo(value)
+		parser.appendOnly = &enabled
+		return err
+	})
+	parser.flags.Func("appendfsync", "How often the append only file is synced, always, everysec or no", func(value string) error {
+		policy, err := config.ParseAppendFsync(value)
+		parser.appendFsync = policy
+		return err
+	})
+	parser.flags.Func("aof-load-truncated", "Load an append only file whose last command is cut short, yes or no", func(value string) error {
+		enabled, err := config.ParseYesNo(value)
+		parser.aofLoadTruncated = &enabled
+		return err
+	})
+	parser.flags.Func("auto-aof-rewrite-percentage", "Rewrite the append only file once it grew by this percentage, 0 disables it", func(value string) error {
+		percentage, err := config.ParsePercentage(value)
+		parser.rewritePercent = &percentage
+		return err
+	})
+	parser.flags.Func("auto-aof-rewrite-min-size", "Smallest append only file that is rewritten automatically, like 64mb", func(value string) error {
+		size, err := config.ParseMemory(value)
+		parser.rewriteMinSize = &size
+		return err
+	})
 
 	return parser
 }
@@ -33,6 +73,7 @@ func (a *ArgParser) Parse(args []string) error {
 	return a.flags.Parse(args)
 }
 func (a *ArgParser) ParseArgsToRedisConfig() config.RedisConfig {
+	saveRules, _ := config.ParseSaveRules(config.DefaultSaveRules)
 	redisConfig := config.RedisConfig{
 		Port:              "6379",
 		Dir:               "",
@@ -42,6 +83,13 @@ func (a *ArgParser) ParseArgsToRedisConfig() config.RedisConfig {
 		MasterPort:        "",
 		ReplicationId:     "8371b4fb1155b71f4a04d3e1bc3e18c4a990aeeb",
 		ReplicationOffset: 0,
+		SaveRules:         saveRules,
+		AppendFsync:       config.FsyncEverySec,
+		AOFLoadTruncated:  true,
+
+		AutoAOFRewritePercentage: 100,
+		AutoAOFRewriteMinSize:    64 << 20,
+		PubSubOutputLimit:        config.OutputBufferLimit{HardBytes: 32 << 20, SoftBytes: 8 << 20, SoftSeconds: 60},
 	}
 
 	if a.dir != nil && *a.dir != "" {
@@ -57,6 +105,27 @@ func (a *ArgParser) ParseArgsToRedisConfig() config.RedisConfig {
 	if a.role != nil && *a.role != "" {
 		redisConfig.Role = *a.role
 	}
+	if a.saveRules != nil {
+		redisConfig.SaveRules = a.saveRules
+	} else if redisConfig.Dir == "" {
+		// without --dir nothing is saved unless asked for
+		redisConfig.SaveRules = nil
+	}
+	if a.appendOnly != nil {
+		redisConfig.AppendOnly = *a.appendOnly
+	}
+	if a.appendFsync != "" {
+		redisConfig.AppendFsync = a.appendFsync
+	}
+	if a.aofLoadTruncated != nil {
+		redisConfig.AOFLoadTruncated = *a.aofLoadTruncated
+	}
+	if a.rewritePercent != nil {
+		redisConfig.AutoAOFRewritePercentage = *a.rewritePercent
+	}
+	if a.rewriteMinSize != nil {
+		redisConfig.AutoAOFRewriteMinSize = *a.rewriteMinSize
+	}
 	if a.replocaOf != nil && *a.replocaOf != "" {
 		redisConfig.Role = config.RoleSlave
 		parts := strings.Split(*a.replocaOf, " ")
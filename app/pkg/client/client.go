@@ -0,0 +1,168 @@
+package client
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/command"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/response"
+)
+
+var lastClientId atomic.Int64
+
+// Blocker is a command waiting for data, Wait returns its reply once it
+// was served, timed out or closed was closed
+type Blocker interface {
+	Wait(closed <-chan struct{}) response.Value
+}
+
+// Client is the state redis keeps for every connection
+type Client struct {
+	Id       int64
+	Name     string
+	Protocol int
+
+	// Blocked is set when the last command blocked the client instead of
+	// replying, the connection waits on it for the reply
+	Blocked Blocker
+	// DenyBlocking is set for the client replaying the AOF, its blocking
+	// commands get what a timeout would give
+	DenyBlocking bool
+
+	// InMulti is set between MULTI and EXEC, the commands wait in Queued
+	// meanwhile. MultiFailed is set when one of them could not be queued,
+	// EXEC discards the transaction then.
+	InMulti     bool
+	Queued      []*command.Command
+	MultiFailed bool
+	// Propagated are the commands EXEC logs to the AOF as one transaction
+	// once the queued commands ran
+	Propagated []*command.Command
+
+	// Watched are the keys of WATCH and whether they existed back then, a
+	// key that expired since counts as changed. WatchTouched is set by the
+	// clients changing one of them.
+	Watched      map[string]bool
+	WatchTouched atomic.Bool
+
+	// Channels and Patterns are the pub/sub subscriptions, a client with
+	// any of them is in subscribed mode
+	Channels map[string]struct{}
+	Patterns map[string]struct{}
+
+	// mu guards what other clients touch, the messages pushed to this one
+	// and the protocol they are encoded with
+	mu          sync.Mutex
+	pushed      []byte
+	pushReady   chan struct{}
+	outputLimit OutputLimit
+	softSince   time.Time
+	closed      bool
+	onClose     func()
+}
+
+// OutputLimit is the client-output-buffer-limit of redis for the messages
+// pushed to a client. Going over Hard, or over Soft for SoftFor, drops the
+// client, a zero limit is no limit.
+type OutputLimit struct {
+	Hard    int
+	Soft    int
+	SoftFor time.Duration
+}
+
+func NewClient() *Client {
+	return &Client{
+		Id:        lastClientId.Add(1),
+		Protocol:  response.ProtocolRESP2,
+		Watched:   make(map[string]bool),
+		Channels:  make(map[string]struct{}),
+		Patterns:  make(map[string]struct{}),
+		pushReady: make(chan struct{}, 1),
+	}
+}
+
+// SetProtocol switches the protocol, pushes encode with it from other
+// goroutines so it changes under the lock
+func (c *Client) SetProtocol(protocol int) {
+	c.mu.Lock()
+	c.Protocol = protocol
+	c.mu.Unlock()
+}
+
+// Subscriptions counts the channels and patterns the client listens to
+func (c *Client) Subscriptions() int {
+	return len(c.Channels) + len(c.Patterns)
+}
+
+// SetOutputLimit sets the limit of pushed messages, onClose is how the
+// connection is dropped when the client goes over it
+func (c *Client) SetOutputLimit(limit OutputLimit, onClose func()) {
+	c.mu.Lock()
+	c.outputLimit = limit
+	c.onClose = onClose
+	c.mu.Unlock()
+}
+
+// Push queues a message sent outside of the replies, like the messages
+// of pub/sub. It never waits for the connection, a client that does not
+// read fast enough is dropped once over its limit and false is returned.
+func (c *Client) Push(message response.Value) bool {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return false
+	}
+	c.pushed = message.Encode(c.pushed, c.Protocol)
+	if c.overLimit(time.Now()) {
+		c.closed = true
+		c.pushed = nil
+		onClose := c.onClose
+		c.mu.Unlock()
+		if onClose != nil {
+			onClose()
+		}
+		return false
+	}
+	c.mu.Unlock()
+
+	select {
+	case c.pushReady <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// PushReady is signaled when messages were pushed
+func (c *Client) PushReady() <-chan struct{} {
+	return c.pushReady
+}
+
+// TakePushed returns the encoded messages pushed since the last call,
+// they have to be written before the next reply to keep their order
+func (c *Client) TakePushed() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pushed := c.pushed
+	c.pushed = nil
+	c.softSince = time.Time{}
+	return pushed
+}
+
+// overLimit checks the queued messages against the limit, the lock is
+// held
+func (c *Client) overLimit(now time.Time) bool {
+	limit := c.outputLimit
+	size := len(c.pushed)
+	if limit.Hard > 0 && size >= limit.Hard {
+		return true
+	}
+	if limit.Soft <= 0 || size < limit.Soft {
+		c.softSince = time.Time{}
+		return false
+	}
+	if c.softSince.IsZero() {
+		c.softSince = now
+	}
+	return now.Sub(c.softSince) >= limit.SoftFor
+}
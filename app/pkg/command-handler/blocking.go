@@ -0,0 +1,228 @@
+package commandhandler
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/response"
+)
+
+// blockedClient is a blocking command parked on its keys until another
+// client pushes to one of them
+type blockedClient struct {
+	state *blockingState
+	keys  []string
+	// lockKeys are the keys serving the client touches, the key that got
+	// data is locked besides them
+	lockKeys []string
+	timeout  time.Duration
+	// serve completes the command with the data pushed to key, false when
+	// there is nothing it can use there
+	serve        func(key string) (response.Value, bool)
+	timeoutReply response.Value
+	// command is what serving did as a command that does not block, which
+	// is what the AOF logs. It is nil for commands that only read.
+	command func(key string) *Command
+
+	reply chan response.Value
+	// done is set under the state mutex once the client was served or gave
+	// up, whoever sets it owns the outcome
+	done bool
+}
+
+// blockingState tracks the clients waiting on every key. Pushes mark the
+// keys as ready and the waiting clients are served after the command that
+// pushed finished, so a transaction only wakes clients with its final
+// result and not with what its commands saw in between.
+type blockingState struct {
+	mu      sync.Mutex
+	waiting map[string][]*blockedClient
+	// blocked is read without the mutex so pushes skip all of this while
+	// nobody waits
+	blocked atomic.Int64
+
+	readyMu sync.Mutex
+	ready   []string
+}
+
+func newBlockingState() *blockingState {
+	return &blockingState{waiting: make(map[string][]*blockedClient)}
+}
+
+// block parks client on keys, it must run inside the command so no push
+// can happen between finding the keys empty and waiting on them
+func (h *CommandHandler) block(client *client.Client, blocked *blockedClient) response.Value {
+	// a transaction or the AOF being loaded can not wait, they get what a
+	// timeout would give
+	if client.InMulti || client.DenyBlocking {
+		return blocked.timeoutReply
+	}
+
+	state := h.blocking
+	blocked.state = state
+	blocked.reply = make(chan response.Value, 1)
+
+	// a key given twice still takes a single place in its queue
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, key := range blocked.keys {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	blocked.keys = keys
+
+	state.mu.Lock()
+	for _, key := range blocked.keys {
+		state.waiting[key] = append(state.waiting[key], blocked)
+	}
+	state.mu.Unlock()
+	state.blocked.Add(1)
+
+	client.Blocked = blocked
+	return response.Value{}
+}
+
+// signalKeyAsReady is called for every push, clients waiting on the key
+// are served once the current command is done
+func (h *CommandHandler) signalKeyAsReady(key string) {
+	state := h.blocking
+	if state.blocked.Load() == 0 {
+		return
+	}
+
+	state.readyMu.Lock()
+	state.ready = append(state.ready, key)
+	state.readyMu.Unlock()
+}
+
+// serveBlockedClients hands the data pushed to ready keys to the clients
+// waiting on them, the longest waiting client first
+func (h *CommandHandler) serveBlockedClients() {
+	state := h.blocking
+	for {
+		state.readyMu.Lock()
+		if len(state.ready) == 0 {
+			state.readyMu.Unlock()
+			return
+		}
+		key := state.ready[0]
+		state.ready = state.ready[1:]
+		state.readyMu.Unlock()
+
+		h.serveBlocked(key)
+	}
+}
+
+// serveBlocked tries the clients waiting on key in the order they came,
+// one that can't use what is there keeps waiting and the next one is
+// tried. Like for any other command, the AOF is written out before the
+// replies go and without holding the locks of the keys.
+func (h *CommandHandler) serveBlocked(key string) {
+	state := h.blocking
+	state.mu.Lock()
+	queue := append([]*blockedClient{}, state.waiting[key]...)
+	state.mu.Unlock()
+
+	served := []*blockedClient{}
+	replies := []response.Value{}
+	for _, blocked := range queue {
+		h.storage.Atomic(append([]string{key}, blocked.lockKeys...), func() {
+			state.mu.Lock()
+			defer state.mu.Unlock()
+			if blocked.done {
+				// it timed out meanwhile and left the queue
+				return
+			}
+
+			reply, ok := blocked.serve(key)
+			if !ok {
+				return
+			}
+			state.unblock(blocked)
+			h.touchKeys(append([]string{key}, blocked.lockKeys...))
+			h.rdb.AddDirty(1)
+			if blocked.command != nil && h.aof.Enabled() {
+				h.aof.Append(blocked.command(key))
+			}
+			served = append(served, blocked)
+			replies = append(replies, reply)
+		})
+	}
+	if len(served) == 0 {
+		return
+	}
+
+	h.aof.Flush()
+	for i, blocked := range served {
+		blocked.reply <- replies[i]
+	}
+}
+
+// unblock removes the client from every queue, the state mutex is held
+func (s *blockingState) unblock(blocked *blockedClient) {
+	blocked.done = true
+	s.blocked.Add(-1)
+	for _, key := range blocked.keys {
+		queue := s.waiting[key]
+		for i, other := range queue {
+			if other == blocked {
+				queue = append(queue[:i:i], queue[i+1:]...)
+				break
+			}
+		}
+		if len(queue) == 0 {
+			delete(s.waiting, key)
+		} else {
+			s.waiting[key] = queue
+		}
+	}
+}
+
+func (b *blockedClient) Wait(closed <-chan struct{}) response.Value {
+	var timeout <-chan time.Time
+	if b.timeout > 0 {
+		timer := time.NewTimer(b.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case reply := <-b.reply:
+		return reply
+	case <-timeout:
+	case <-closed:
+	}
+
+	b.state.mu.Lock()
+	served := b.done
+	if !served {
+		b.state.unblock(b)
+	}
+	b.state.mu.Unlock()
+
+	if served {
+		// it was served while giving up, the reply is on its way
+		return <-b.reply
+	}
+	return b.timeoutReply
+}
+
+// parseTimeout parses the timeout in seconds of the blocking commands,
+// 0 blocks forever
+func parseTimeout(arg string) (time.Duration, *response.Value) {
+	seconds, ok := parseFloat(arg)
+	if !ok || seconds*1000 > float64(math.MaxInt64/int64(time.Millisecond)) {
+		reply := response.NewError("timeout is not a float or out of range")
+		return 0, &reply
+	}
+	if seconds < 0 {
+		reply := response.NewError("timeout is negative")
+		return 0, &reply
+	}
+	return time.Duration(seconds * 1000 * float64(time.Millisecond)), nil
+}
@@ -0,0 +1,135 @@
+package commandhandler
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/response"
+)
+
+// The COMMAND family is served entirely from the registry
+
+func (h *CommandHandler) handleCommand(client *client.Client, command *Command) response.Value {
+	reply := []response.Value{}
+	for _, spec := range h.registry.All() {
+		reply = append(reply, commandInfo(spec))
+	}
+	return response.NewArray(reply...)
+}
+
+func (h *CommandHandler) handleCommandCount(client *client.Client, command *Command) response.Value {
+	return response.NewInteger(int64(h.registry.Count()))
+}
+
+func (h *CommandHandler) handleCommandList(client *client.Client, command *Command) response.Value {
+	names := []string{}
+	for _, spec := range h.registry.All() {
+		names = append(names, spec.Name)
+	}
+	return response.NewBulkStringArray(names)
+}
+
+func (h *CommandHandler) handleCommandInfo(client *client.Client, command *Command) response.Value {
+	reply := []response.Value{}
+	for _, name := range command.Args[1:] {
+		spec := h.lookupSpecByName(name)
+		if spec == nil {
+			reply = append(reply, response.NewNullArray())
+			continue
+		}
+		reply = append(reply, commandInfo(spec))
+	}
+	return response.NewArray(reply...)
+}
+
+// handleCommandDocs has no documentation to offer, but clients like
+// redis-cli ask for it so every known command gets an empty entry
+func (h *CommandHandler) handleCommandDocs(client *client.Client, command *Command) response.Value {
+	reply := []response.Value{}
+	for _, name := range command.Args[1:] {
+		if spec := h.lookupSpecByName(name); spec != nil {
+			reply = append(reply, response.NewBulkString(spec.FullName()), response.NewMap())
+		}
+	}
+	return response.NewMap(reply...)
+}
+
+func (h *CommandHandler) handleCommandGetKeys(client *client.Client, command *Command) response.Value {
+	target := &Command{Name: strings.ToUpper(command.Args[1]), Args: command.Args[2:]}
+	spec, ok := h.registry.Resolve(target)
+	if spec == nil || !ok {
+		return response.NewError("Invalid command specified")
+	}
+	if !spec.checkArity(len(target.Args) + 1) {
+		return response.NewError("Invalid number of arguments specified for command")
+	}
+	if !spec.HasKeys() {
+		return response.NewError("The command has no key arguments")
+	}
+
+	return response.NewBulkStringArray(spec.Keys(target.Args))
+}
+
+func (h *CommandHandler) handleCommandHelp(client *client.Client, command *Command) response.Value {
+	return helpReply("COMMAND",
+		"(no subcommand)",
+		"    Return details about all Redis commands.",
+		"COUNT",
+		"    Return the total number of commands in this Redis server.",
+		"LIST",
+		"    Return a list of all commands in this Redis server.",
+		"INFO [<command-name> ...]",
+		"    Return details about multiple Redis commands.",
+		"DOCS [<command-name> ...]",
+		"    Return documentation details about multiple Redis commands.",
+		"GETKEYS <full-command>",
+		"    Return the keys from a full Redis command.",
+	)
+}
+
+// lookupSpecByName understands "config|get" style subcommand names
+func (h *CommandHandler) lookupSpecByName(name string) *CommandSpec {
+	container, subcommand, isSubcommand := strings.Cut(strings.ToLower(name), "|")
+	spec := h.registry.Lookup(container)
+	if spec == nil || !isSubcommand {
+		return spec
+	}
+	return spec.Subcommands[subcommand]
+}
+
+func commandInfo(spec *CommandSpec) response.Value {
+	flags := []response.Value{}
+	for _, flag := range flagNames {
+		if spec.Has(flag.flag) {
+			flags = append(flags, response.NewSimpleString(flag.name))
+		}
+	}
+
+	subcommands := []response.Value{}
+	for _, name := range sortedSubcommands(spec) {
+		subcommands = append(subcommands, commandInfo(spec.Subcommands[name]))
+	}
+
+	return response.NewArray(
+		response.NewBulkString(spec.FullName()),
+		response.NewInteger(int64(spec.Arity)),
+		response.NewSet(flags...),
+		response.NewInteger(int64(spec.FirstKey)),
+		response.NewInteger(int64(spec.LastKey)),
+		response.NewInteger(int64(spec.Step)),
+		response.NewSet(),
+		response.NewArray(),
+		response.NewArray(),
+		response.NewArray(subcommands...),
+	)
+}
+
+func sortedSubcommands(spec *CommandSpec) []string {
+	names := make([]string, 0, len(spec.Subcommands))
+	for name := range spec.Subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
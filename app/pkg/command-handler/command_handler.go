@@ -1,206 +1,189 @@
 package commandhandler
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
 	"github.com/codecrafters-io/redis-starter-go/app/pkg/command"
 	"github.com/codecrafters-io/redis-starter-go/app/pkg/config"
-	redisparser "github.com/codecrafters-io/redis-starter-go/app/pkg/redis-parser"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/persistence"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/pubsub"
 	"github.com/codecrafters-io/redis-starter-go/app/pkg/response"
 	"github.com/codecrafters-io/redis-starter-go/app/pkg/storage"
 )
 
+// Error messages shared by many commands, worded like redis words them
+const (
+	errSyntax     = "syntax error"
+	errNotInteger = "value is not an integer or out of range"
+)
+
+// maxEchoedLen caps what an error echoes back of the command it rejects
+const maxEchoedLen = 128
+
+var newlines = strings.NewReplacer("\r", " ", "\n", " ")
+
 type CommandHandler struct {
-	parser  *redisparser.RedisParser
-	storage storage.StorageInterface
-	config  config.RedisConfig
+	storage  storage.StorageInterface
+	config   config.RedisConfig
+	registry *Registry
+	blocking *blockingState
+	watching *watchState
+	pubsub   *pubsub.Hub
+	rdb      *persistence.RDB
+	aof      *persistence.AOF
 }
 
-func NewCommandHandler(storage storage.StorageInterface, config config.RedisConfig) *CommandHandler {
-	return &CommandHandler{
-		parser:  redisparser.NewRedisParser(),
-		storage: storage,
-		config:  config,
+func NewCommandHandler(storage storage.StorageInterface, rdb *persistence.RDB, aof *persistence.AOF, config config.RedisConfig) *CommandHandler {
+	handler := &CommandHandler{
+		storage:  storage,
+		config:   config,
+		blocking: newBlockingState(),
+		watching: newWatchState(),
+		pubsub:   pubsub.NewHub(),
+		rdb:      rdb,
+		aof:      aof,
 	}
+	handler.registry = handler.newRegistry()
+	return handler
 }
 
-func (h *CommandHandler) Handle(data []byte, length int) (*response.Response, error) {
-	if length <= 0 {
-		return nil, fmt.Errorf("empty command")
+func (h *CommandHandler) HandleCommand(client *client.Client, command *Command) response.Value {
+	spec, errorResponse := h.lookupCommand(command)
+	if spec == nil {
+		if client.InMulti {
+			client.MultiFailed = true
+		}
+		return errorResponse
 	}
-
-	command, err := h.parser.Parse(data[:length])
-	if err != nil {
-		fmt.Printf("Error parsing command: %v\n", err)
-		return nil, fmt.Errorf("invalid command")
+	if inSubscribedMode(client) && !subscribedModeCommands[strings.ToLower(command.Name)] {
+		return subscribedModeError(command)
+	}
+	if client.InMulti && !isTransactionCommand(command) {
+		return h.queueCommand(spec, client, command)
 	}
 
-	switch command.Name {
-	case "PING":
-		return h.createSuccessResponse(*command, "PONG"), nil
-
-	case "ECHO":
-		if err := h.validateArgsCount(command, 1, 1); err != nil {
-			return h.createErrorResponse(*command, err.Error()), nil
-		}
-		return h.createSuccessResponse(*command, command.Args[0]), nil
-
-	case "GET":
-		if err := h.validateArgsCount(command, 1, 1); err != nil {
-			return h.createErrorResponse(*command, err.Error()), nil
-		}
-
-		value, err := h.Get(command.Args[0])
-
-		if err != nil {
-			return h.createErrorResponse(*command, err.Error()), nil
-		}
-		return h.createSuccessResponse(*command, value), nil
-
-	case "SET":
-		if err := h.validateArgsCount(command, 2, 4); err != nil {
-			return h.createErrorResponse(*command, err.Error()), nil
-		}
-		if len(command.Args) > 2 && strings.ToUpper(command.Args[2]) == "PX" {
-
-			expeire, err := strconv.Atoi(command.Args[3])
-			expeire64 := int64(expeire)
-
-			if err != nil {
-				return h.createErrorResponse(*command, err.Error()), nil
-			}
-
-			if err := h.Set(command.Args[0], command.Args[1], &expeire64); err != nil {
-				return h.createErrorResponse(*command, err.Error()), nil
-			}
-
-		} else {
-			if err := h.Set(command.Args[0], command.Args[1], nil); err != nil {
-				return h.createErrorResponse(*command, err.Error()), nil
-			}
-		}
-
-		return h.createSuccessResponse(*command, ""), nil
-
-	case "CONFIG":
-		if err := h.validateArgsCount(command, 2, 2); err != nil {
-			return h.createErrorResponse(*command, err.Error()), nil
-		}
-
-		subCommand := strings.ToUpper(command.Args[0])
-		if subCommand == "GET" {
-			return h.handleConfigGet(command)
-		}
-
-		return h.createErrorResponse(*command, "unknown CONFIG subcommand"), nil
-
-	case "KEYS":
-		if err := h.validateArgsCount(command, 1, 1); err != nil {
-			return h.createErrorResponse(*command, err.Error()), nil
-		}
-
-		subCommand := strings.ToUpper(command.Args[0])
-		if subCommand == "*" {
-			return h.handleKeysGet(command)
-		}
-
-		return h.createErrorResponse(*command, "unknown KEYS subcommand"), nil
-
-	case "INFO":
-		if err := h.validateArgsCount(command, 1, 1); err != nil {
-			return h.createErrorResponse(*command, err.Error()), nil
-		}
-
-		subCommand := strings.ToUpper(command.Args[0])
-		if subCommand == "REPLICATION" {
-			return h.handleInfoReplication(command)
-		}
+	reply := h.execute(spec, client, command)
+	h.serveBlockedClients()
+	// the writes are in the AOF before anyone sees their replies
+	h.aof.Flush()
+	return reply
+}
 
-		return h.createErrorResponse(*command, "unknown INFO subcommand"), nil
-	default:
-		return h.createErrorResponse(*command, "unknown command"), nil
+// ReplayCommand runs a command read back from the AOF, a command that
+// does not exist means the file can not be loaded
+func (h *CommandHandler) ReplayCommand(client *client.Client, command *Command) error {
+	if spec, _ := h.registry.Resolve(command); spec == nil {
+		return fmt.Errorf("unknown command '%s'", command.Name)
 	}
+	h.HandleCommand(client, command)
+	return nil
 }
 
-func (h *CommandHandler) handleConfigGet(command *command.Command) (*response.Response, error) {
-	parameter := strings.ToLower(command.Args[1])
+// CloseClient forgets a client whose connection is gone
+func (h *CommandHandler) CloseClient(client *client.Client) {
+	h.pubsub.UnsubscribeAll(client)
+	h.unwatchAll(client)
+}
 
-	switch parameter {
-	case "dir":
-		return h.createMultiDataResponse(*command, []string{"dir", h.config.Dir}, false), nil
+// execute runs the handler holding the keyspace locks the command needs,
+// commands with keys lock only those, other data commands lock everything
+func (h *CommandHandler) execute(spec *CommandSpec, client *client.Client, command *Command) response.Value {
+	var reply response.Value
+	run := func() {
+		reply = h.run(spec, client, command)
+	}
 
-	case "dbfilename":
-		return h.createMultiDataResponse(*command, []string{"dbfilename", h.config.DbFileName}, false), nil
+	switch {
+	case spec.HasKeys():
+		h.storage.Atomic(spec.Keys(command.Args), run)
+	case spec.Has(FlagWrite | FlagReadonly):
+		h.storage.AtomicAll(run)
 	default:
-		return h.createMultiDataResponse(*command, []string{}, false), nil
+		run()
 	}
-}
 
-func (h *CommandHandler) Set(key, value string, experie *int64) error {
-	return h.storage.Set(key, value, experie)
+	return reply
 }
 
-func (h *CommandHandler) Get(key string) (string, error) {
-	return h.storage.Get(key)
+// run calls the handler, the locks are held already. Write commands that
+// did not fail touch their keys for the transactions watching them, count
+// as a change for the save points and go to the AOF. A command that blocked
+// did nothing yet, serving it does all of that later.
+func (h *CommandHandler) run(spec *CommandSpec, client *client.Client, command *Command) response.Value {
+	reply := spec.Handler(client, command)
+	if spec.Has(FlagWrite) && reply.Type != response.Error && client.Blocked == nil {
+		h.touchKeys(spec.Keys(command.Args))
+		h.rdb.AddDirty(1)
+		h.propagate(spec, client, command, reply)
+	}
+	return reply
 }
-func (h *CommandHandler) handleKeysGet(command *command.Command) (*response.Response, error) {
-	keys := h.storage.GetAllKeys()
-	if len(keys) == 0 {
-		return h.createMultiDataResponse(*command, []string{}, false), nil
+
+// lookupCommand resolves the spec of a command and validates its arity,
+// on failure the spec is nil and the error reply is returned instead
+func (h *CommandHandler) lookupCommand(command *Command) (*CommandSpec, response.Value) {
+	spec, ok := h.registry.Resolve(command)
+	if spec == nil {
+		return nil, response.NewError(unknownCommandMessage(command))
+	}
+	if !ok {
+		return nil, response.NewError(newlines.Replace(fmt.Sprintf("unknown subcommand '%s'. Try %s HELP.", truncate(command.Args[0], maxEchoedLen), strings.ToUpper(spec.Name))))
+	}
+	if !spec.checkArity(len(command.Args) + 1) {
+		return nil, wrongArgsCount(spec)
 	}
 
-	return h.createMultiDataResponse(*command, keys, false), nil
+	return spec, response.Value{}
 }
 
-func (h *CommandHandler) handleInfoReplication(command *command.Command) (*response.Response, error) {
-
-	data := []string{
-		"role:" + h.config.Role,
-		"master_replid:" + h.config.ReplicationId,
-		"master_repl_offset:" + fmt.Sprintf("%d", h.config.ReplicationOffset),
+// unknownCommandMessage echoes at most 128 bytes of the name and of the
+// arguments like redis, with newlines turned into spaces so a client can
+// not break the error line
+func unknownCommandMessage(command *Command) string {
+	var args strings.Builder
+	for _, arg := range command.Args {
+		if args.Len() >= maxEchoedLen {
+			break
+		}
+		fmt.Fprintf(&args, "'%s' ", truncate(arg, maxEchoedLen-args.Len()))
 	}
-	return h.createMultiDataResponse(*command, data, true), nil
+	message := fmt.Sprintf("unknown command '%s', with args beginning with: %s", truncate(command.Name, maxEchoedLen), args.String())
+	return newlines.Replace(message)
 }
-func (h *CommandHandler) createSuccessResponse(command command.Command, data string) *response.Response {
-	return &response.Response{
-		Command: command,
-		Status:  "OK",
-		Data:    []string{data},
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
 	}
+	return s
 }
 
-func (h *CommandHandler) createErrorResponse(command command.Command, errorMsg string) *response.Response {
-	return &response.Response{
-		Command: command,
-		Status:  "ERR",
-		Error:   errorMsg,
+// errorReply turns a storage error into its reply, WRONGTYPE has its own
+// error code
+func errorReply(err error) response.Value {
+	if errors.Is(err, storage.ErrWrongType) {
+		return response.NewErrorCode("WRONGTYPE", err.Error())
 	}
+	return response.NewError(err.Error())
 }
 
-func (h *CommandHandler) createMultiDataResponse(command command.Command, data []string, isBulkString bool) *response.Response {
-	return &response.Response{
-		Command:           command,
-		Status:            "OK",
-		Data:              data,
-		IsMulti:           true,
-		IsBulkStringArray: isBulkString,
-	}
+func wrongArgsCount(spec *CommandSpec) response.Value {
+	return response.NewError(fmt.Sprintf("wrong number of arguments for '%s' command", spec.FullName()))
 }
 
-func (h *CommandHandler) validateArgsCount(command *command.Command, expectedMin, expectedMax int) error {
-	argsCount := len(command.Args)
-	if expectedMax == -1 { // for unlimited args
-		if argsCount < expectedMin {
-			return fmt.Errorf("wrong number of arguments for '%s' command expected at least %d", command.Name, expectedMin)
-		}
+// parseInt is as strict as string2ll of redis, "+1", "01" or " 1" are
+// not integers so that every integer has exactly one representation
+func parseInt(arg string) (int64, bool) {
+	digits := strings.TrimPrefix(arg, "-")
+	if digits == "" || digits[0] < '0' || digits[0] > '9' || (digits[0] == '0' && len(arg) > 1) {
+		return 0, false
 	}
-	if argsCount < expectedMin || argsCount > expectedMax {
-		return fmt.Errorf("wrong number of arguments for '%s' command expected between %d and %d got %d", command.Name, expectedMin, expectedMax, argsCount)
-	}
-
-	return nil
+	value, err := strconv.ParseInt(arg, 10, 64)
+	return value, err == nil
 }
 
 type Command = command.Command
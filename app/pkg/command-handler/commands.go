@@ -0,0 +1,242 @@
+package commandhandler
+
+// newRegistry is the command table, every command the server knows is
+// declared here with the metadata the COMMAND command reports
+func (h *CommandHandler) newRegistry() *Registry {
+	registry := NewRegistry()
+
+	// server
+	registry.Register(&CommandSpec{Name: "ping", Arity: -1, Flags: FlagFast | FlagStale, Handler: h.handlePing})
+	registry.Register(&CommandSpec{Name: "echo", Arity: 2, Flags: FlagFast | FlagStale, Handler: h.handleEcho})
+	registry.Register(&CommandSpec{Name: "hello", Arity: -1, Flags: FlagNoScript | FlagLoading | FlagStale | FlagFast, Handler: h.handleHello})
+	registry.Register(&CommandSpec{Name: "info", Arity: -1, Flags: FlagLoading | FlagStale, Handler: h.handleInfo})
+	registry.Register(&CommandSpec{Name: "config", Arity: -2, Subcommands: map[string]*CommandSpec{
+		"get":  {Name: "get", Arity: -3, Flags: FlagAdmin | FlagNoScript | FlagLoading | FlagStale, Handler: h.handleConfigGet},
+		"set":  {Name: "set", Arity: -4, Flags: FlagAdmin | FlagNoScript | FlagLoading | FlagStale, Handler: h.handleConfigSet},
+		"help": {Name: "help", Arity: 2, Flags: FlagLoading | FlagStale, Handler: h.handleConfigHelp},
+	}})
+	registry.Register(&CommandSpec{Name: "client", Arity: -2, Subcommands: map[string]*CommandSpec{
+		"id":      {Name: "id", Arity: 2, Flags: FlagNoScript | FlagLoading | FlagStale, Handler: h.handleClientId},
+		"getname": {Name: "getname", Arity: 2, Flags: FlagNoScript | FlagLoading | FlagStale, Handler: h.handleClientGetName},
+		"setname": {Name: "setname", Arity: 3, Flags: FlagNoScript | FlagLoading | FlagStale, Handler: h.handleClientSetName},
+		"help":    {Name: "help", Arity: 2, Flags: FlagLoading | FlagStale, Handler: h.handleClientHelp},
+	}})
+	registry.Register(&CommandSpec{Name: "command", Arity: -1, Flags: FlagLoading | FlagStale, Handler: h.handleCommand, Subcommands: map[string]*CommandSpec{
+		"count":   {Name: "count", Arity: 2, Flags: FlagLoading | FlagStale, Handler: h.handleCommandCount},
+		"info":    {Name: "info", Arity: -2, Flags: FlagLoading | FlagStale, Handler: h.handleCommandInfo},
+		"list":    {Name: "list", Arity: 2, Flags: FlagLoading | FlagStale, Handler: h.handleCommandList},
+		"docs":    {Name: "docs", Arity: -2, Flags: FlagLoading | FlagStale, Handler: h.handleCommandDocs},
+		"getkeys": {Name: "getkeys", Arity: -3, Flags: FlagLoading | FlagStale, Handler: h.handleCommandGetKeys},
+		"help":    {Name: "help", Arity: 2, Flags: FlagLoading | FlagStale, Handler: h.handleCommandHelp},
+	}})
+
+	// persistence
+	registry.Register(&CommandSpec{Name: "save", Arity: 1, Flags: FlagAdmin | FlagNoScript | FlagNoMulti, Handler: h.handleSave})
+	registry.Register(&CommandSpec{Name: "bgsave", Arity: -1, Flags: FlagAdmin | FlagNoScript | FlagNoMulti, Handler: h.handleBGSave})
+	registry.Register(&CommandSpec{Name: "bgrewriteaof", Arity: 1, Flags: FlagAdmin | FlagNoScript | FlagNoMulti, Handler: h.handleBGRewriteAOF})
+	registry.Register(&CommandSpec{Name: "lastsave", Arity: 1, Flags: FlagLoading | FlagStale | FlagFast, Handler: h.handleLastSave})
+
+	// strings
+	registry.Register(&CommandSpec{Name: "get", Arity: 2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleGet})
+	registry.Register(&CommandSpec{Name: "set", Arity: -3, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleSet})
+	registry.Register(&CommandSpec{Name: "setnx", Arity: 3, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleSetNX})
+	registry.Register(&CommandSpec{Name: "setex", Arity: 4, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleSetEX})
+	registry.Register(&CommandSpec{Name: "psetex", Arity: 4, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handlePSetEX})
+	registry.Register(&CommandSpec{Name: "getset", Arity: 3, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleGetSet})
+	registry.Register(&CommandSpec{Name: "getdel", Arity: 2, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleGetDel})
+	registry.Register(&CommandSpec{Name: "getex", Arity: -2, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleGetEX})
+	registry.Register(&CommandSpec{Name: "incr", Arity: 2, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleIncr})
+	registry.Register(&CommandSpec{Name: "decr", Arity: 2, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleDecr})
+	registry.Register(&CommandSpec{Name: "incrby", Arity: 3, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleIncrBy})
+	registry.Register(&CommandSpec{Name: "decrby", Arity: 3, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleDecrBy})
+	registry.Register(&CommandSpec{Name: "incrbyfloat", Arity: 3, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleIncrByFloat})
+	registry.Register(&CommandSpec{Name: "append", Arity: 3, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleAppend})
+	registry.Register(&CommandSpec{Name: "strlen", Arity: 2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleStrlen})
+	registry.Register(&CommandSpec{Name: "getrange", Arity: 4, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleGetRange})
+	registry.Register(&CommandSpec{Name: "substr", Arity: 4, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleGetRange})
+	registry.Register(&CommandSpec{Name: "setrange", Arity: 4, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleSetRange})
+	registry.Register(&CommandSpec{Name: "mget", Arity: -2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: -1, Step: 1, Handler: h.handleMGet})
+	registry.Register(&CommandSpec{Name: "mset", Arity: -3, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: -1, Step: 2, Handler: h.handleMSet})
+	registry.Register(&CommandSpec{Name: "msetnx", Arity: -3, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: -1, Step: 2, Handler: h.handleMSetNX})
+
+	// expire
+	registry.Register(&CommandSpec{Name: "expire", Arity: -3, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleExpire})
+	registry.Register(&CommandSpec{Name: "pexpire", Arity: -3, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handlePExpire})
+	registry.Register(&CommandSpec{Name: "expireat", Arity: -3, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleExpireAt})
+	registry.Register(&CommandSpec{Name: "pexpireat", Arity: -3, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handlePExpireAt})
+	registry.Register(&CommandSpec{Name: "ttl", Arity: 2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleTTL})
+	registry.Register(&CommandSpec{Name: "pttl", Arity: 2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handlePTTL})
+	registry.Register(&CommandSpec{Name: "expiretime", Arity: 2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleExpireTime})
+	registry.Register(&CommandSpec{Name: "pexpiretime", Arity: 2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handlePExpireTime})
+	registry.Register(&CommandSpec{Name: "persist", Arity: 2, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handlePersist})
+
+	// keyspace
+	registry.Register(&CommandSpec{Name: "keys", Arity: 2, Flags: FlagReadonly, Handler: h.handleKeys})
+	registry.Register(&CommandSpec{Name: "scan", Arity: -2, Flags: FlagReadonly, Handler: h.handleScan})
+	registry.Register(&CommandSpec{Name: "del", Arity: -2, Flags: FlagWrite, FirstKey: 1, LastKey: -1, Step: 1, Handler: h.handleDel})
+	registry.Register(&CommandSpec{Name: "unlink", Arity: -2, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: -1, Step: 1, Handler: h.handleDel})
+	registry.Register(&CommandSpec{Name: "exists", Arity: -2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: -1, Step: 1, Handler: h.handleExists})
+	registry.Register(&CommandSpec{Name: "touch", Arity: -2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: -1, Step: 1, Handler: h.handleExists})
+	registry.Register(&CommandSpec{Name: "type", Arity: 2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleType})
+	registry.Register(&CommandSpec{Name: "rename", Arity: 3, Flags: FlagWrite, FirstKey: 1, LastKey: 2, Step: 1, Handler: h.handleRename})
+	registry.Register(&CommandSpec{Name: "renamenx", Arity: 3, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 2, Step: 1, Handler: h.handleRenameNX})
+	registry.Register(&CommandSpec{Name: "copy", Arity: -3, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: 2, Step: 1, Handler: h.handleCopy})
+	registry.Register(&CommandSpec{Name: "object", Arity: -2, Subcommands: map[string]*CommandSpec{
+		"encoding": {Name: "encoding", Arity: 3, Flags: FlagReadonly, FirstKey: 2, LastKey: 2, Step: 1, Handler: h.handleObjectEncoding},
+		"help":     {Name: "help", Arity: 2, Flags: FlagLoading | FlagStale, Handler: h.handleObjectHelp},
+	}})
+
+	// lists
+	registry.Register(&CommandSpec{Name: "lpush", Arity: -3, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleLPush})
+	registry.Register(&CommandSpec{Name: "rpush", Arity: -3, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleRPush})
+	registry.Register(&CommandSpec{Name: "lpushx", Arity: -3, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleLPushX})
+	registry.Register(&CommandSpec{Name: "rpushx", Arity: -3, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleRPushX})
+	registry.Register(&CommandSpec{Name: "lpop", Arity: -2, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleLPop})
+	registry.Register(&CommandSpec{Name: "rpop", Arity: -2, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleRPop})
+	registry.Register(&CommandSpec{Name: "llen", Arity: 2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleLLen})
+	registry.Register(&CommandSpec{Name: "lrange", Arity: 4, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleLRange})
+	registry.Register(&CommandSpec{Name: "lindex", Arity: 3, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleLIndex})
+	registry.Register(&CommandSpec{Name: "lset", Arity: 4, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleLSet})
+	registry.Register(&CommandSpec{Name: "lrem", Arity: 4, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleLRem})
+	registry.Register(&CommandSpec{Name: "ltrim", Arity: 4, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleLTrim})
+	registry.Register(&CommandSpec{Name: "linsert", Arity: 5, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleLInsert})
+	registry.Register(&CommandSpec{Name: "lpos", Arity: -3, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleLPos})
+	registry.Register(&CommandSpec{Name: "lmove", Arity: 5, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: 2, Step: 1, Handler: h.handleLMove})
+	registry.Register(&CommandSpec{Name: "rpoplpush", Arity: 3, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: 2, Step: 1, Handler: h.handleRPopLPush})
+	registry.Register(&CommandSpec{Name: "lmpop", Arity: -4, Flags: FlagWrite, KeysFunc: numkeysKeys(0), Handler: h.handleLMPop})
+	registry.Register(&CommandSpec{Name: "blpop", Arity: -3, Flags: FlagWrite | FlagBlocking, FirstKey: 1, LastKey: -2, Step: 1, Handler: h.handleBLPop})
+	registry.Register(&CommandSpec{Name: "brpop", Arity: -3, Flags: FlagWrite | FlagBlocking, FirstKey: 1, LastKey: -2, Step: 1, Handler: h.handleBRPop})
+	registry.Register(&CommandSpec{Name: "blmove", Arity: 6, Flags: FlagWrite | FlagDenyOOM | FlagBlocking, FirstKey: 1, LastKey: 2, Step: 1, Handler: h.handleBLMove})
+	registry.Register(&CommandSpec{Name: "brpoplpush", Arity: 4, Flags: FlagWrite | FlagDenyOOM | FlagBlocking, FirstKey: 1, LastKey: 2, Step: 1, Handler: h.handleBRPopLPush})
+	registry.Register(&CommandSpec{Name: "blmpop", Arity: -5, Flags: FlagWrite | FlagBlocking, KeysFunc: numkeysKeys(1), Handler: h.handleBLMPop})
+
+	// hashes
+	registry.Register(&CommandSpec{Name: "hset", Arity: -4, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleHSet})
+	registry.Register(&CommandSpec{Name: "hmset", Arity: -4, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleHSet})
+	registry.Register(&CommandSpec{Name: "hsetnx", Arity: 4, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleHSetNX})
+	registry.Register(&CommandSpec{Name: "hget", Arity: 3, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleHGet})
+	registry.Register(&CommandSpec{Name: "hmget", Arity: -3, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleHMGet})
+	registry.Register(&CommandSpec{Name: "hgetall", Arity: 2, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleHGetAll})
+	registry.Register(&CommandSpec{Name: "hkeys", Arity: 2, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleHKeys})
+	registry.Register(&CommandSpec{Name: "hvals", Arity: 2, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleHVals})
+	registry.Register(&CommandSpec{Name: "hlen", Arity: 2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleHLen})
+	registry.Register(&CommandSpec{Name: "hstrlen", Arity: 3, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleHStrlen})
+	registry.Register(&CommandSpec{Name: "hexists", Arity: 3, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleHExists})
+	registry.Register(&CommandSpec{Name: "hdel", Arity: -3, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleHDel})
+	registry.Register(&CommandSpec{Name: "hincrby", Arity: 4, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleHIncrBy})
+	registry.Register(&CommandSpec{Name: "hincrbyfloat", Arity: 4, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleHIncrByFloat})
+	registry.Register(&CommandSpec{Name: "hrandfield", Arity: -2, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleHRandField})
+	registry.Register(&CommandSpec{Name: "hscan", Arity: -3, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleHScan})
+	registry.Register(&CommandSpec{Name: "hexpire", Arity: -6, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleHExpire})
+	registry.Register(&CommandSpec{Name: "hpexpire", Arity: -6, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleHPExpire})
+	registry.Register(&CommandSpec{Name: "hexpireat", Arity: -6, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleHExpireAt})
+	registry.Register(&CommandSpec{Name: "hpexpireat", Arity: -6, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleHPExpireAt})
+	registry.Register(&CommandSpec{Name: "httl", Arity: -5, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleHTTL})
+	registry.Register(&CommandSpec{Name: "hpttl", Arity: -5, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleHPTTL})
+	registry.Register(&CommandSpec{Name: "hexpiretime", Arity: -5, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleHExpireTime})
+	registry.Register(&CommandSpec{Name: "hpexpiretime", Arity: -5, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleHPExpireTime})
+	registry.Register(&CommandSpec{Name: "hpersist", Arity: -5, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleHPersist})
+
+	// sets
+	registry.Register(&CommandSpec{Name: "sadd", Arity: -3, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleSAdd})
+	registry.Register(&CommandSpec{Name: "srem", Arity: -3, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleSRem})
+	registry.Register(&CommandSpec{Name: "smembers", Arity: 2, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleSMembers})
+	registry.Register(&CommandSpec{Name: "sismember", Arity: 3, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleSIsMember})
+	registry.Register(&CommandSpec{Name: "smismember", Arity: -3, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleSMIsMember})
+	registry.Register(&CommandSpec{Name: "scard", Arity: 2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleSCard})
+	registry.Register(&CommandSpec{Name: "spop", Arity: -2, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleSPop})
+	registry.Register(&CommandSpec{Name: "srandmember", Arity: -2, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleSRandMember})
+	registry.Register(&CommandSpec{Name: "smove", Arity: 4, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 2, Step: 1, Handler: h.handleSMove})
+	registry.Register(&CommandSpec{Name: "sscan", Arity: -3, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleSScan})
+	registry.Register(&CommandSpec{Name: "sinter", Arity: -2, Flags: FlagReadonly, FirstKey: 1, LastKey: -1, Step: 1, Handler: h.handleSInter})
+	registry.Register(&CommandSpec{Name: "sinterstore", Arity: -3, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: -1, Step: 1, Handler: h.handleSInterStore})
+	registry.Register(&CommandSpec{Name: "sunion", Arity: -2, Flags: FlagReadonly, FirstKey: 1, LastKey: -1, Step: 1, Handler: h.handleSUnion})
+	registry.Register(&CommandSpec{Name: "sunionstore", Arity: -3, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: -1, Step: 1, Handler: h.handleSUnionStore})
+	registry.Register(&CommandSpec{Name: "sdiff", Arity: -2, Flags: FlagReadonly, FirstKey: 1, LastKey: -1, Step: 1, Handler: h.handleSDiff})
+	registry.Register(&CommandSpec{Name: "sdiffstore", Arity: -3, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: -1, Step: 1, Handler: h.handleSDiffStore})
+	registry.Register(&CommandSpec{Name: "sintercard", Arity: -3, Flags: FlagReadonly, KeysFunc: numkeysKeys(0), Handler: h.handleSInterCard})
+
+	// sorted sets
+	registry.Register(&CommandSpec{Name: "zadd", Arity: -4, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleZAdd})
+	registry.Register(&CommandSpec{Name: "zincrby", Arity: 4, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleZIncrBy})
+	registry.Register(&CommandSpec{Name: "zcard", Arity: 2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleZCard})
+	registry.Register(&CommandSpec{Name: "zscore", Arity: 3, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleZScore})
+	registry.Register(&CommandSpec{Name: "zmscore", Arity: -3, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleZMScore})
+	registry.Register(&CommandSpec{Name: "zrank", Arity: -3, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleZRank})
+	registry.Register(&CommandSpec{Name: "zrevrank", Arity: -3, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleZRevRank})
+	registry.Register(&CommandSpec{Name: "zcount", Arity: 4, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleZCount})
+	registry.Register(&CommandSpec{Name: "zlexcount", Arity: 4, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleZLexCount})
+	registry.Register(&CommandSpec{Name: "zrange", Arity: -4, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleZRange})
+	registry.Register(&CommandSpec{Name: "zrangestore", Arity: -5, Flags: FlagWrite | FlagDenyOOM, FirstKey: 1, LastKey: 2, Step: 1, Handler: h.handleZRangeStore})
+	registry.Register(&CommandSpec{Name: "zrevrange", Arity: -4, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleZRevRange})
+	registry.Register(&CommandSpec{Name: "zrangebyscore", Arity: -4, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleZRangeByScore})
+	registry.Register(&CommandSpec{Name: "zrevrangebyscore", Arity: -4, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleZRevRangeByScore})
+	registry.Register(&CommandSpec{Name: "zrangebylex", Arity: -4, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleZRangeByLex})
+	registry.Register(&CommandSpec{Name: "zrevrangebylex", Arity: -4, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleZRevRangeByLex})
+	registry.Register(&CommandSpec{Name: "zrem", Arity: -3, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleZRem})
+	registry.Register(&CommandSpec{Name: "zremrangebyrank", Arity: 4, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleZRemRangeByRank})
+	registry.Register(&CommandSpec{Name: "zremrangebyscore", Arity: 4, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleZRemRangeByScore})
+	registry.Register(&CommandSpec{Name: "zremrangebylex", Arity: 4, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleZRemRangeByLex})
+	registry.Register(&CommandSpec{Name: "zpopmin", Arity: -2, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleZPopMin})
+	registry.Register(&CommandSpec{Name: "zpopmax", Arity: -2, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleZPopMax})
+	registry.Register(&CommandSpec{Name: "bzpopmin", Arity: -3, Flags: FlagWrite | FlagFast | FlagBlocking, FirstKey: 1, LastKey: -2, Step: 1, Handler: h.handleBZPopMin})
+	registry.Register(&CommandSpec{Name: "bzpopmax", Arity: -3, Flags: FlagWrite | FlagFast | FlagBlocking, FirstKey: 1, LastKey: -2, Step: 1, Handler: h.handleBZPopMax})
+	registry.Register(&CommandSpec{Name: "zrandmember", Arity: -2, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleZRandMember})
+	registry.Register(&CommandSpec{Name: "zscan", Arity: -3, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleZScan})
+	registry.Register(&CommandSpec{Name: "zunionstore", Arity: -4, Flags: FlagWrite | FlagDenyOOM, KeysFunc: storeNumkeysKeys, Handler: h.handleZUnionStore})
+	registry.Register(&CommandSpec{Name: "zinterstore", Arity: -4, Flags: FlagWrite | FlagDenyOOM, KeysFunc: storeNumkeysKeys, Handler: h.handleZInterStore})
+	registry.Register(&CommandSpec{Name: "zdiffstore", Arity: -4, Flags: FlagWrite | FlagDenyOOM, KeysFunc: storeNumkeysKeys, Handler: h.handleZDiffStore})
+	registry.Register(&CommandSpec{Name: "zunion", Arity: -3, Flags: FlagReadonly, KeysFunc: numkeysKeys(0), Handler: h.handleZUnion})
+	registry.Register(&CommandSpec{Name: "zinter", Arity: -3, Flags: FlagReadonly, KeysFunc: numkeysKeys(0), Handler: h.handleZInter})
+	registry.Register(&CommandSpec{Name: "zdiff", Arity: -3, Flags: FlagReadonly, KeysFunc: numkeysKeys(0), Handler: h.handleZDiff})
+
+	// streams
+	registry.Register(&CommandSpec{Name: "xadd", Arity: -5, Flags: FlagWrite | FlagDenyOOM | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleXAdd})
+	registry.Register(&CommandSpec{Name: "xlen", Arity: 2, Flags: FlagReadonly | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleXLen})
+	registry.Register(&CommandSpec{Name: "xrange", Arity: -4, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleXRange})
+	registry.Register(&CommandSpec{Name: "xrevrange", Arity: -4, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleXRevRange})
+	registry.Register(&CommandSpec{Name: "xdel", Arity: -3, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleXDel})
+	registry.Register(&CommandSpec{Name: "xtrim", Arity: -4, Flags: FlagWrite, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleXTrim})
+	registry.Register(&CommandSpec{Name: "xread", Arity: -4, Flags: FlagReadonly | FlagBlocking, KeysFunc: streamsKeys, Handler: h.handleXRead})
+	registry.Register(&CommandSpec{Name: "xreadgroup", Arity: -7, Flags: FlagWrite | FlagBlocking, KeysFunc: streamsKeys, Handler: h.handleXReadGroup})
+	registry.Register(&CommandSpec{Name: "xack", Arity: -4, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleXAck})
+	registry.Register(&CommandSpec{Name: "xpending", Arity: -3, Flags: FlagReadonly, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleXPending})
+	registry.Register(&CommandSpec{Name: "xclaim", Arity: -6, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleXClaim})
+	registry.Register(&CommandSpec{Name: "xautoclaim", Arity: -6, Flags: FlagWrite | FlagFast, FirstKey: 1, LastKey: 1, Step: 1, Handler: h.handleXAutoClaim})
+	registry.Register(&CommandSpec{Name: "xgroup", Arity: -2, Subcommands: map[string]*CommandSpec{
+		"create":         {Name: "create", Arity: -5, Flags: FlagWrite | FlagDenyOOM, FirstKey: 2, LastKey: 2, Step: 1, Handler: h.handleXGroupCreate},
+		"setid":          {Name: "setid", Arity: -5, Flags: FlagWrite, FirstKey: 2, LastKey: 2, Step: 1, Handler: h.handleXGroupSetID},
+		"destroy":        {Name: "destroy", Arity: 4, Flags: FlagWrite, FirstKey: 2, LastKey: 2, Step: 1, Handler: h.handleXGroupDestroy},
+		"createconsumer": {Name: "createconsumer", Arity: 5, Flags: FlagWrite | FlagDenyOOM, FirstKey: 2, LastKey: 2, Step: 1, Handler: h.handleXGroupCreateConsumer},
+		"delconsumer":    {Name: "delconsumer", Arity: 5, Flags: FlagWrite, FirstKey: 2, LastKey: 2, Step: 1, Handler: h.handleXGroupDelConsumer},
+		"help":           {Name: "help", Arity: 2, Flags: FlagLoading | FlagStale, Handler: h.handleXGroupHelp},
+	}})
+	registry.Register(&CommandSpec{Name: "xinfo", Arity: -2, Subcommands: map[string]*CommandSpec{
+		"stream":    {Name: "stream", Arity: -3, Flags: FlagReadonly, FirstKey: 2, LastKey: 2, Step: 1, Handler: h.handleXInfoStream},
+		"groups":    {Name: "groups", Arity: 3, Flags: FlagReadonly, FirstKey: 2, LastKey: 2, Step: 1, Handler: h.handleXInfoGroups},
+		"consumers": {Name: "consumers", Arity: 4, Flags: FlagReadonly, FirstKey: 2, LastKey: 2, Step: 1, Handler: h.handleXInfoConsumers},
+		"help":      {Name: "help", Arity: 2, Flags: FlagLoading | FlagStale, Handler: h.handleXInfoHelp},
+	}})
+
+	// pub/sub
+	registry.Register(&CommandSpec{Name: "subscribe", Arity: -2, Flags: FlagPubSub | FlagNoScript | FlagNoMulti | FlagLoading | FlagStale, Handler: h.handleSubscribe})
+	registry.Register(&CommandSpec{Name: "unsubscribe", Arity: -1, Flags: FlagPubSub | FlagNoScript | FlagNoMulti | FlagLoading | FlagStale, Handler: h.handleUnsubscribe})
+	registry.Register(&CommandSpec{Name: "psubscribe", Arity: -2, Flags: FlagPubSub | FlagNoScript | FlagNoMulti | FlagLoading | FlagStale, Handler: h.handlePSubscribe})
+	registry.Register(&CommandSpec{Name: "punsubscribe", Arity: -1, Flags: FlagPubSub | FlagNoScript | FlagNoMulti | FlagLoading | FlagStale, Handler: h.handlePUnsubscribe})
+	registry.Register(&CommandSpec{Name: "publish", Arity: 3, Flags: FlagPubSub | FlagLoading | FlagStale | FlagFast, Handler: h.handlePublish})
+	registry.Register(&CommandSpec{Name: "pubsub", Arity: -2, Subcommands: map[string]*CommandSpec{
+		"channels": {Name: "channels", Arity: -2, Flags: FlagPubSub | FlagLoading | FlagStale, Handler: h.handlePubSubChannels},
+		"numsub":   {Name: "numsub", Arity: -2, Flags: FlagPubSub | FlagLoading | FlagStale, Handler: h.handlePubSubNumSub},
+		"numpat":   {Name: "numpat", Arity: 2, Flags: FlagPubSub | FlagLoading | FlagStale, Handler: h.handlePubSubNumPat},
+		"help":     {Name: "help", Arity: 2, Flags: FlagLoading | FlagStale, Handler: h.handlePubSubHelp},
+	}})
+
+	// transactions
+	registry.Register(&CommandSpec{Name: "multi", Arity: 1, Flags: FlagNoScript | FlagLoading | FlagStale | FlagFast, Handler: h.handleMulti})
+	registry.Register(&CommandSpec{Name: "exec", Arity: 1, Flags: FlagNoScript | FlagLoading | FlagStale, Handler: h.handleExec})
+	registry.Register(&CommandSpec{Name: "discard", Arity: 1, Flags: FlagNoScript | FlagLoading | FlagStale | FlagFast, Handler: h.handleDiscard})
+	registry.Register(&CommandSpec{Name: "watch", Arity: -2, Flags: FlagNoScript | FlagLoading | FlagStale | FlagFast, FirstKey: 1, LastKey: -1, Step: 1, Handler: h.handleWatch})
+	registry.Register(&CommandSpec{Name: "unwatch", Arity: 1, Flags: FlagNoScript | FlagLoading | FlagStale | FlagFast, Handler: h.handleUnwatch})
+
+	return registry
+}
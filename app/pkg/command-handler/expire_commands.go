@@ -0,0 +1,152 @@
+package commandhandler
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/response"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/storage"
+)
+
+func (h *CommandHandler) handleExpire(client *client.Client, command *Command) response.Value {
+	return h.expireGeneric(command, time.Now().UnixMilli(), time.Second)
+}
+
+func (h *CommandHandler) handlePExpire(client *client.Client, command *Command) response.Value {
+	return h.expireGeneric(command, time.Now().UnixMilli(), time.Millisecond)
+}
+
+func (h *CommandHandler) handleExpireAt(client *client.Client, command *Command) response.Value {
+	return h.expireGeneric(command, 0, time.Second)
+}
+
+func (h *CommandHandler) handlePExpireAt(client *client.Client, command *Command) response.Value {
+	return h.expireGeneric(command, 0, time.Millisecond)
+}
+
+// expireGeneric implements the EXPIRE family, basetime is the unix time
+// in milliseconds the given amount of units is added to
+func (h *CommandHandler) expireGeneric(command *Command, basetime int64, unit time.Duration) response.Value {
+	key := command.Args[0]
+	amount, ok := parseInt(command.Args[1])
+	if !ok {
+		return response.NewError(errNotInteger)
+	}
+
+	nx, xx, gt, lt := false, false, false, false
+	for _, arg := range command.Args[2:] {
+		switch strings.ToUpper(arg) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		default:
+			return response.NewError(fmt.Sprintf("Unsupported option %s", arg))
+		}
+	}
+	if nx && (xx || gt || lt) {
+		return response.NewError("NX and XX, GT or LT options at the same time are not compatible")
+	}
+	if gt && lt {
+		return response.NewError("GT and LT options at the same time are not compatible")
+	}
+
+	multiplier := int64(unit / time.Millisecond)
+	if amount > math.MaxInt64/multiplier || amount < math.MinInt64/multiplier {
+		return invalidExpireTime(command)
+	}
+	when := amount * multiplier
+	if (when > 0 && basetime > math.MaxInt64-when) || (when < 0 && basetime < math.MinInt64-when) {
+		return invalidExpireTime(command)
+	}
+	when += basetime
+
+	current, err := h.storage.ExpireDate(key)
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		return response.NewInteger(0)
+	}
+	if err != nil {
+		return errorReply(err)
+	}
+
+	// a key without TTL counts as one that never expires
+	hasTTL := current != -1
+	switch {
+	case nx && hasTTL,
+		xx && !hasTTL,
+		gt && (!hasTTL || when <= current),
+		lt && hasTTL && when >= current:
+		return response.NewInteger(0)
+	}
+
+	if err := h.storage.SetExpireDate(key, when); err != nil {
+		return errorReply(err)
+	}
+	return response.NewInteger(1)
+}
+
+func invalidExpireTime(command *Command) response.Value {
+	return response.NewError(fmt.Sprintf("invalid expire time in '%s' command", strings.ToLower(command.Name)))
+}
+
+func (h *CommandHandler) handleTTL(client *client.Client, command *Command) response.Value {
+	return h.ttlGeneric(command.Args[0], false, time.Second)
+}
+
+func (h *CommandHandler) handlePTTL(client *client.Client, command *Command) response.Value {
+	return h.ttlGeneric(command.Args[0], false, time.Millisecond)
+}
+
+func (h *CommandHandler) handleExpireTime(client *client.Client, command *Command) response.Value {
+	return h.ttlGeneric(command.Args[0], true, time.Second)
+}
+
+func (h *CommandHandler) handlePExpireTime(client *client.Client, command *Command) response.Value {
+	return h.ttlGeneric(command.Args[0], true, time.Millisecond)
+}
+
+// ttlGeneric replies -2 for missing keys, -1 for keys without TTL and
+// otherwise the remaining time or the absolute unix time of expiry
+func (h *CommandHandler) ttlGeneric(key string, absolute bool, unit time.Duration) response.Value {
+	when, err := h.storage.ExpireDate(key)
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		return response.NewInteger(-2)
+	}
+	if err != nil {
+		return errorReply(err)
+	}
+	if when == -1 {
+		return response.NewInteger(-1)
+	}
+
+	millis := when
+	if !absolute {
+		millis = max(when-time.Now().UnixMilli(), 0)
+	}
+	if unit == time.Second {
+		if absolute {
+			return response.NewInteger(millis / 1000)
+		}
+		return response.NewInteger((millis + 500) / 1000)
+	}
+	return response.NewInteger(millis)
+}
+
+func (h *CommandHandler) handlePersist(client *client.Client, command *Command) response.Value {
+	persisted, err := h.storage.Persist(command.Args[0])
+	if err != nil && !errors.Is(err, storage.ErrKeyNotFound) {
+		return errorReply(err)
+	}
+	if !persisted {
+		return response.NewInteger(0)
+	}
+	return response.NewInteger(1)
+}
@@ -0,0 +1,597 @@
+package commandhandler
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/glob"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/response"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/storage"
+)
+
+// field TTLs are limited to 48 bits of milliseconds like redis does
+const maxFieldExpireTime = 1<<48 - 1
+
+// HSET key field value [field value ...]
+func (h *CommandHandler) handleHSet(client *client.Client, command *Command) response.Value {
+	if len(command.Args)%2 != 1 {
+		return wrongArgsCount(h.registry.Lookup(strings.ToLower(command.Name)))
+	}
+
+	hash, err := h.storage.LookupOrCreateHash(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	created := 0
+	for i := 1; i < len(command.Args); i += 2 {
+		if hash.Set(command.Args[i], command.Args[i+1]) {
+			created++
+		}
+	}
+
+	if strings.ToLower(command.Name) == "hmset" {
+		return response.NewOK()
+	}
+	return response.NewInteger(int64(created))
+}
+
+func (h *CommandHandler) handleHSetNX(client *client.Client, command *Command) response.Value {
+	hash, err := h.storage.LookupOrCreateHash(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if _, exists := hash.Get(command.Args[1]); exists {
+		return response.NewInteger(0)
+	}
+	hash.Set(command.Args[1], command.Args[2])
+	return response.NewInteger(1)
+}
+
+func (h *CommandHandler) handleHGet(client *client.Client, command *Command) response.Value {
+	hash, err := h.storage.LookupHash(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if hash == nil {
+		return response.NewNull()
+	}
+	value, ok := hash.Get(command.Args[1])
+	if !ok {
+		return response.NewNull()
+	}
+	return response.NewBulkString(value)
+}
+
+func (h *CommandHandler) handleHMGet(client *client.Client, command *Command) response.Value {
+	hash, err := h.storage.LookupHash(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+
+	values := make([]response.Value, 0, len(command.Args)-1)
+	for _, field := range command.Args[1:] {
+		value, ok := "", false
+		if hash != nil {
+			value, ok = hash.Get(field)
+		}
+		if !ok {
+			values = append(values, response.NewNull())
+			continue
+		}
+		values = append(values, response.NewBulkString(value))
+	}
+	return response.NewArray(values...)
+}
+
+func (h *CommandHandler) handleHGetAll(client *client.Client, command *Command) response.Value {
+	hash, err := h.storage.LookupHash(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if hash == nil {
+		return response.NewMap()
+	}
+
+	pairs := make([]response.Value, 0, hash.Len()*2)
+	hash.Each(func(field, value string) bool {
+		pairs = append(pairs, response.NewBulkString(field), response.NewBulkString(value))
+		return true
+	})
+	return response.NewMap(pairs...)
+}
+
+func (h *CommandHandler) handleHKeys(client *client.Client, command *Command) response.Value {
+	return h.hashElements(command.Args[0], true)
+}
+
+func (h *CommandHandler) handleHVals(client *client.Client, command *Command) response.Value {
+	return h.hashElements(command.Args[0], false)
+}
+
+// hashElements is HKEYS or HVALS
+func (h *CommandHandler) hashElements(key string, fields bool) response.Value {
+	hash, err := h.storage.LookupHash(key)
+	if err != nil {
+		return errorReply(err)
+	}
+	if hash == nil {
+		return response.NewArray()
+	}
+
+	elements := make([]string, 0, hash.Len())
+	hash.Each(func(field, value string) bool {
+		if fields {
+			elements = append(elements, field)
+		} else {
+			elements = append(elements, value)
+		}
+		return true
+	})
+	return response.NewBulkStringArray(elements)
+}
+
+func (h *CommandHandler) handleHLen(client *client.Client, command *Command) response.Value {
+	hash, err := h.storage.LookupHash(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if hash == nil {
+		return response.NewInteger(0)
+	}
+	return response.NewInteger(int64(hash.Len()))
+}
+
+func (h *CommandHandler) handleHStrlen(client *client.Client, command *Command) response.Value {
+	hash, err := h.storage.LookupHash(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if hash == nil {
+		return response.NewInteger(0)
+	}
+	value, _ := hash.Get(command.Args[1])
+	return response.NewInteger(int64(len(value)))
+}
+
+func (h *CommandHandler) handleHExists(client *client.Client, command *Command) response.Value {
+	hash, err := h.storage.LookupHash(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if hash == nil {
+		return response.NewInteger(0)
+	}
+	if _, ok := hash.Get(command.Args[1]); !ok {
+		return response.NewInteger(0)
+	}
+	return response.NewInteger(1)
+}
+
+func (h *CommandHandler) handleHDel(client *client.Client, command *Command) response.Value {
+	key := command.Args[0]
+	hash, err := h.storage.LookupHash(key)
+	if err != nil {
+		return errorReply(err)
+	}
+	if hash == nil {
+		return response.NewInteger(0)
+	}
+
+	deleted := 0
+	for _, field := range command.Args[1:] {
+		if hash.Delete(field) {
+			deleted++
+		}
+	}
+	h.storage.DeleteIfEmpty(key)
+	return response.NewInteger(int64(deleted))
+}
+
+// HINCRBY key field increment, the field keeps its TTL
+func (h *CommandHandler) handleHIncrBy(client *client.Client, command *Command) response.Value {
+	increment, ok := parseInt(command.Args[2])
+	if !ok {
+		return response.NewError(errNotInteger)
+	}
+
+	hash, err := h.storage.LookupOrCreateHash(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+
+	field := command.Args[1]
+	current := int64(0)
+	if value, exists := hash.Get(field); exists {
+		if current, ok = parseInt(value); !ok {
+			h.storage.DeleteIfEmpty(command.Args[0])
+			return response.NewError("hash value is not an integer")
+		}
+	}
+	if (increment < 0 && current < math.MinInt64-increment) || (increment > 0 && current > math.MaxInt64-increment) {
+		h.storage.DeleteIfEmpty(command.Args[0])
+		return response.NewError("increment or decrement would overflow")
+	}
+
+	current += increment
+	setKeepingTTL(hash, field, strconv.FormatInt(current, 10))
+	return response.NewInteger(current)
+}
+
+// HINCRBYFLOAT key field increment, the field keeps its TTL
+func (h *CommandHandler) handleHIncrByFloat(client *client.Client, command *Command) response.Value {
+	increment, ok := parseFloat(command.Args[2])
+	if !ok {
+		return response.NewError("value is not a valid float")
+	}
+
+	hash, err := h.storage.LookupOrCreateHash(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+
+	field := command.Args[1]
+	current := float64(0)
+	if value, exists := hash.Get(field); exists {
+		if current, ok = parseFloat(value); !ok {
+			h.storage.DeleteIfEmpty(command.Args[0])
+			return response.NewError("hash value is not a float")
+		}
+	}
+
+	current += increment
+	if math.IsNaN(current) || math.IsInf(current, 0) {
+		h.storage.DeleteIfEmpty(command.Args[0])
+		return response.NewError("increment would produce NaN or Infinity")
+	}
+
+	formatted := strconv.FormatFloat(current, 'f', -1, 64)
+	setKeepingTTL(hash, field, formatted)
+	return response.NewBulkString(formatted)
+}
+
+func setKeepingTTL(hash *storage.Hash, field, value string) {
+	if !hash.Update(field, value) {
+		hash.Set(field, value)
+	}
+}
+
+// HRANDFIELD key [count [WITHVALUES]]
+//
+// a positive count returns distinct fields, a negative one may return the
+// same field many times
+func (h *CommandHandler) handleHRandField(client *client.Client, command *Command) response.Value {
+	if len(command.Args) > 3 || (len(command.Args) == 3 && strings.ToUpper(command.Args[2]) != "WITHVALUES") {
+		return response.NewError(errSyntax)
+	}
+
+	count, hasCount := int64(1), len(command.Args) > 1
+	if hasCount {
+		var ok bool
+		if count, ok = parseInt(command.Args[1]); !ok {
+			return response.NewError(errNotInteger)
+		}
+		if count < -math.MaxInt64/2 || count > math.MaxInt64/2 {
+			return response.NewError("value is out of range")
+		}
+	}
+	withValues := len(command.Args) == 3
+
+	hash, err := h.storage.LookupHash(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if hash == nil {
+		if hasCount {
+			return response.NewArray()
+		}
+		return response.NewNull()
+	}
+
+	fields, values := []string{}, []string{}
+	hash.Each(func(field, value string) bool {
+		fields = append(fields, field)
+		values = append(values, value)
+		return true
+	})
+
+	picked := []int{}
+	if count < 0 {
+		for i := int64(0); i < -count; i++ {
+			picked = append(picked, rand.Intn(len(fields)))
+		}
+	} else {
+		picked = rand.Perm(len(fields))[:min(int(count), len(fields))]
+	}
+
+	if !hasCount {
+		return response.NewBulkString(fields[picked[0]])
+	}
+
+	reply := []response.Value{}
+	for _, i := range picked {
+		switch {
+		case !withValues:
+			reply = append(reply, response.NewBulkString(fields[i]))
+		case client.Protocol == response.ProtocolRESP3:
+			reply = append(reply, response.NewArray(response.NewBulkString(fields[i]), response.NewBulkString(values[i])))
+		default:
+			reply = append(reply, response.NewBulkString(fields[i]), response.NewBulkString(values[i]))
+		}
+	}
+	return response.NewArray(reply...)
+}
+
+// HSCAN key cursor [MATCH pattern] [COUNT count] [NOVALUES]
+func (h *CommandHandler) handleHScan(client *client.Client, command *Command) response.Value {
+	cursor, err := strconv.ParseUint(command.Args[1], 10, 64)
+	if err != nil {
+		return response.NewError("invalid cursor")
+	}
+
+	pattern := ""
+	count := int64(10)
+	noValues := false
+	for i := 2; i < len(command.Args); i++ {
+		option := strings.ToUpper(command.Args[i])
+		if option == "NOVALUES" {
+			noValues = true
+			continue
+		}
+		if i+1 >= len(command.Args) {
+			return response.NewError(errSyntax)
+		}
+		switch option {
+		case "MATCH":
+			pattern = command.Args[i+1]
+		case "COUNT":
+			var ok bool
+			if count, ok = parseInt(command.Args[i+1]); !ok {
+				return response.NewError(errNotInteger)
+			}
+			if count < 1 {
+				return response.NewError(errSyntax)
+			}
+		default:
+			return response.NewError(errSyntax)
+		}
+		i++
+	}
+
+	hash, err := h.storage.LookupHash(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+
+	next, pairs := uint64(0), []string{}
+	if hash != nil {
+		next, pairs = hash.Scan(cursor, int(min(count, math.MaxInt32)))
+	}
+
+	elements := []string{}
+	for i := 0; i < len(pairs); i += 2 {
+		if pattern != "" && pattern != "*" && !glob.Match(pattern, pairs[i], false) {
+			continue
+		}
+		elements = append(elements, pairs[i])
+		if !noValues {
+			elements = append(elements, pairs[i+1])
+		}
+	}
+
+	return response.NewArray(
+		response.NewBulkString(strconv.FormatUint(next, 10)),
+		response.NewBulkStringArray(elements),
+	)
+}
+
+func (h *CommandHandler) handleHExpire(client *client.Client, command *Command) response.Value {
+	return h.hexpireGeneric(command, time.Now().UnixMilli(), time.Second)
+}
+
+func (h *CommandHandler) handleHPExpire(client *client.Client, command *Command) response.Value {
+	return h.hexpireGeneric(command, time.Now().UnixMilli(), time.Millisecond)
+}
+
+func (h *CommandHandler) handleHExpireAt(client *client.Client, command *Command) response.Value {
+	return h.hexpireGeneric(command, 0, time.Second)
+}
+
+func (h *CommandHandler) handleHPExpireAt(client *client.Client, command *Command) response.Value {
+	return h.hexpireGeneric(command, 0, time.Millisecond)
+}
+
+// hexpireGeneric is the HEXPIRE family,
+// HEXPIRE key seconds [NX | XX | GT | LT] FIELDS numfields field [field ...]
+//
+// Every field gets -2 when it does not exist, 0 when the condition was not
+// met, 1 when the TTL was set and 2 when the time already passed and the
+// field was deleted.
+func (h *CommandHandler) hexpireGeneric(command *Command, basetime int64, unit time.Duration) response.Value {
+	key := command.Args[0]
+	amount, ok := parseInt(command.Args[1])
+	if !ok {
+		return response.NewError(errNotInteger)
+	}
+	if amount < 0 {
+		return response.NewError("invalid expire time, must be >= 0")
+	}
+	multiplier := int64(unit / time.Millisecond)
+	if amount > (maxFieldExpireTime-basetime)/multiplier {
+		return invalidExpireTime(command)
+	}
+	when := basetime + amount*multiplier
+
+	condition := ""
+	fieldsAt := 2
+	if len(command.Args) > 2 {
+		switch option := strings.ToUpper(command.Args[2]); option {
+		case "NX", "XX", "GT", "LT":
+			condition = option
+			fieldsAt = 3
+		}
+	}
+	fields, errorResponse := parseFieldsArgument(command.Args, fieldsAt)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	hash, err := h.storage.LookupHash(key)
+	if err != nil {
+		return errorReply(err)
+	}
+
+	now := time.Now().UnixMilli()
+	results := make([]response.Value, 0, len(fields))
+	for _, field := range fields {
+		current, exists := int64(0), false
+		if hash != nil {
+			current, exists = hash.ExpireAt(field)
+		}
+		if !exists {
+			results = append(results, response.NewInteger(-2))
+			continue
+		}
+
+		// a field without TTL counts as one that never expires
+		met := true
+		switch condition {
+		case "NX":
+			met = current == 0
+		case "XX":
+			met = current != 0
+		case "GT":
+			met = current != 0 && when > current
+		case "LT":
+			met = current == 0 || when < current
+		}
+		if !met {
+			results = append(results, response.NewInteger(0))
+			continue
+		}
+
+		// the AOF replays past dates as they are, the fields expire once
+		// it is loaded
+		if when <= now && !h.storage.Loading() {
+			hash.Delete(field)
+			results = append(results, response.NewInteger(2))
+			continue
+		}
+		hash.SetExpireAt(field, when)
+		results = append(results, response.NewInteger(1))
+	}
+
+	h.storage.TrackHashExpires(key)
+	h.storage.DeleteIfEmpty(key)
+	return response.NewArray(results...)
+}
+
+func (h *CommandHandler) handleHTTL(client *client.Client, command *Command) response.Value {
+	return h.httlGeneric(command, false, time.Second)
+}
+
+func (h *CommandHandler) handleHPTTL(client *client.Client, command *Command) response.Value {
+	return h.httlGeneric(command, false, time.Millisecond)
+}
+
+func (h *CommandHandler) handleHExpireTime(client *client.Client, command *Command) response.Value {
+	return h.httlGeneric(command, true, time.Second)
+}
+
+func (h *CommandHandler) handleHPExpireTime(client *client.Client, command *Command) response.Value {
+	return h.httlGeneric(command, true, time.Millisecond)
+}
+
+// httlGeneric is HTTL and its variants, every field gets -2 when it does
+// not exist and -1 when it has no TTL
+func (h *CommandHandler) httlGeneric(command *Command, absolute bool, unit time.Duration) response.Value {
+	fields, errorResponse := parseFieldsArgument(command.Args, 1)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	hash, err := h.storage.LookupHash(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+
+	divisor := int64(unit / time.Millisecond)
+	now := time.Now().UnixMilli()
+	results := make([]response.Value, 0, len(fields))
+	for _, field := range fields {
+		when, exists := int64(0), false
+		if hash != nil {
+			when, exists = hash.ExpireAt(field)
+		}
+		switch {
+		case !exists:
+			results = append(results, response.NewInteger(-2))
+		case when == 0:
+			results = append(results, response.NewInteger(-1))
+		case absolute:
+			results = append(results, response.NewInteger(when/divisor))
+		default:
+			// like TTL, a remaining part of a second counts as a second
+			results = append(results, response.NewInteger((max(when-now, 0)+divisor-1)/divisor))
+		}
+	}
+	return response.NewArray(results...)
+}
+
+// HPERSIST key FIELDS numfields field [field ...]
+func (h *CommandHandler) handleHPersist(client *client.Client, command *Command) response.Value {
+	fields, errorResponse := parseFieldsArgument(command.Args, 1)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	hash, err := h.storage.LookupHash(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+
+	results := make([]response.Value, 0, len(fields))
+	for _, field := range fields {
+		when, exists := int64(0), false
+		if hash != nil {
+			when, exists = hash.ExpireAt(field)
+		}
+		switch {
+		case !exists:
+			results = append(results, response.NewInteger(-2))
+		case when == 0:
+			results = append(results, response.NewInteger(-1))
+		default:
+			hash.SetExpireAt(field, 0)
+			results = append(results, response.NewInteger(1))
+		}
+	}
+	return response.NewArray(results...)
+}
+
+// parseFieldsArgument parses FIELDS numfields field [field ...] which
+// has to start at args[at] and run to the end
+func parseFieldsArgument(args []string, at int) ([]string, *response.Value) {
+	fail := func(message string) ([]string, *response.Value) {
+		reply := response.NewError(message)
+		return nil, &reply
+	}
+
+	if at+1 >= len(args) || strings.ToUpper(args[at]) != "FIELDS" {
+		return fail("Mandatory argument FIELDS is missing or not at the right position")
+	}
+	numFields, ok := parseInt(args[at+1])
+	if !ok {
+		return fail(errNotInteger)
+	}
+	if numFields <= 0 {
+		return fail("Parameter `numFields` should be greater than 0")
+	}
+	if numFields != int64(len(args)-at-2) {
+		return fail("The `numfields` parameter must match the number of arguments")
+	}
+	return args[at+2:], nil
+}
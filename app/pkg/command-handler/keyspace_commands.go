@@ -0,0 +1,195 @@
+package commandhandler
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/glob"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/response"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/storage"
+)
+
+func (h *CommandHandler) handleKeys(client *client.Client, command *Command) response.Value {
+	pattern := command.Args[0]
+	keys := []string{}
+	for _, key := range h.storage.GetAllKeys() {
+		if pattern == "*" || glob.Match(pattern, key, false) {
+			keys = append(keys, key)
+		}
+	}
+	return response.NewBulkStringArray(keys)
+}
+
+// SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+//
+// MATCH and TYPE filter the keys after they were collected, so a call
+// can return fewer keys than COUNT or none at all with a cursor to go on
+func (h *CommandHandler) handleScan(client *client.Client, command *Command) response.Value {
+	cursor, err := strconv.ParseUint(command.Args[0], 10, 64)
+	if err != nil {
+		return response.NewError("invalid cursor")
+	}
+
+	pattern, keyType := "", ""
+	count := int64(10)
+	for i := 1; i < len(command.Args); i += 2 {
+		if i+1 >= len(command.Args) {
+			return response.NewError(errSyntax)
+		}
+		value := command.Args[i+1]
+		switch strings.ToUpper(command.Args[i]) {
+		case "MATCH":
+			pattern = value
+		case "COUNT":
+			var ok bool
+			count, ok = parseInt(value)
+			if !ok {
+				return response.NewError(errNotInteger)
+			}
+			if count < 1 {
+				return response.NewError(errSyntax)
+			}
+		case "TYPE":
+			keyType = strings.ToLower(value)
+		default:
+			return response.NewError(errSyntax)
+		}
+	}
+
+	next, scanned, err := h.storage.Scan(cursor, int(min(count, math.MaxInt32)))
+	if err != nil {
+		return errorReply(err)
+	}
+
+	keys := []string{}
+	for _, key := range scanned {
+		if pattern != "" && pattern != "*" && !glob.Match(pattern, key, false) {
+			continue
+		}
+		if keyType != "" && h.storage.Type(key) != keyType {
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	return response.NewArray(
+		response.NewBulkString(strconv.FormatUint(next, 10)),
+		response.NewBulkStringArray(keys),
+	)
+}
+
+// handleDel serves UNLINK as well, values are freed by the garbage
+// collector anyway so there is nothing to do in the background
+func (h *CommandHandler) handleDel(client *client.Client, command *Command) response.Value {
+	deleted := int64(0)
+	for _, key := range command.Args {
+		if h.storage.Delete(key) {
+			deleted++
+		}
+	}
+	return response.NewInteger(deleted)
+}
+
+// handleExists serves TOUCH as well, there is no access time to update
+func (h *CommandHandler) handleExists(client *client.Client, command *Command) response.Value {
+	count := int64(0)
+	for _, key := range command.Args {
+		if h.storage.Exists(key) {
+			count++
+		}
+	}
+	return response.NewInteger(count)
+}
+
+func (h *CommandHandler) handleType(client *client.Client, command *Command) response.Value {
+	return response.NewSimpleString(h.storage.Type(command.Args[0]))
+}
+
+func (h *CommandHandler) handleRename(client *client.Client, command *Command) response.Value {
+	err := h.storage.Rename(command.Args[0], command.Args[1])
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		return response.NewError("no such key")
+	}
+	if err != nil {
+		return errorReply(err)
+	}
+	h.signalKeyAsReady(command.Args[1])
+	return response.NewOK()
+}
+
+func (h *CommandHandler) handleRenameNX(client *client.Client, command *Command) response.Value {
+	src, dst := command.Args[0], command.Args[1]
+	if !h.storage.Exists(src) {
+		return response.NewError("no such key")
+	}
+	if h.storage.Exists(dst) {
+		return response.NewInteger(0)
+	}
+	if err := h.storage.Rename(src, dst); err != nil {
+		return errorReply(err)
+	}
+	h.signalKeyAsReady(dst)
+	return response.NewInteger(1)
+}
+
+// COPY source destination [DB destination-db] [REPLACE]
+func (h *CommandHandler) handleCopy(client *client.Client, command *Command) response.Value {
+	replace := false
+	for i := 2; i < len(command.Args); i++ {
+		switch strings.ToUpper(command.Args[i]) {
+		case "REPLACE":
+			replace = true
+		case "DB":
+			// there is a single database
+			if i+1 >= len(command.Args) {
+				return response.NewError(errSyntax)
+			}
+			db, ok := parseInt(command.Args[i+1])
+			if !ok {
+				return response.NewError(errNotInteger)
+			}
+			if db != 0 {
+				return response.NewError("DB index is out of range")
+			}
+			i++
+		default:
+			return response.NewError(errSyntax)
+		}
+	}
+
+	if command.Args[0] == command.Args[1] {
+		return response.NewError("source and destination objects are the same")
+	}
+
+	copied, err := h.storage.Copy(command.Args[0], command.Args[1], replace)
+	if errors.Is(err, storage.ErrKeyNotFound) || (err == nil && !copied) {
+		return response.NewInteger(0)
+	}
+	if err != nil {
+		return errorReply(err)
+	}
+	h.signalKeyAsReady(command.Args[1])
+	return response.NewInteger(1)
+}
+
+func (h *CommandHandler) handleObjectEncoding(client *client.Client, command *Command) response.Value {
+	encoding, err := h.storage.Encoding(command.Args[1])
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		return response.NewNull()
+	}
+	if err != nil {
+		return errorReply(err)
+	}
+	return response.NewBulkString(encoding)
+}
+
+func (h *CommandHandler) handleObjectHelp(client *client.Client, command *Command) response.Value {
+	return helpReply("OBJECT",
+		"ENCODING <key>",
+		"    Return the kind of internal representation used in order to store the value",
+		"    associated with a <key>.",
+	)
+}
@@ -0,0 +1,625 @@
+package commandhandler
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/response"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/storage"
+)
+
+const errMustBePositive = "value is out of range, must be positive"
+
+func (h *CommandHandler) handleLPush(client *client.Client, command *Command) response.Value {
+	return h.pushGeneric(command, true, false)
+}
+
+func (h *CommandHandler) handleRPush(client *client.Client, command *Command) response.Value {
+	return h.pushGeneric(command, false, false)
+}
+
+func (h *CommandHandler) handleLPushX(client *client.Client, command *Command) response.Value {
+	return h.pushGeneric(command, true, true)
+}
+
+func (h *CommandHandler) handleRPushX(client *client.Client, command *Command) response.Value {
+	return h.pushGeneric(command, false, true)
+}
+
+// pushGeneric is the push commands, xx only pushes to lists that exist
+func (h *CommandHandler) pushGeneric(command *Command, head bool, xx bool) response.Value {
+	key := command.Args[0]
+	list, err := h.storage.LookupList(key)
+	if err != nil {
+		return errorReply(err)
+	}
+	if list == nil && xx {
+		return response.NewInteger(0)
+	}
+
+	length, err := h.pushList(key, command.Args[1:], head)
+	if err != nil {
+		return errorReply(err)
+	}
+	return response.NewInteger(int64(length))
+}
+
+// pushList pushes values one by one to the list at key, creating it when
+// missing, and returns the new length
+func (h *CommandHandler) pushList(key string, values []string, head bool) (int, error) {
+	list, err := h.storage.LookupOrCreateList(key)
+	if err != nil {
+		return 0, err
+	}
+	for _, value := range values {
+		if head {
+			list.PushHead(value)
+		} else {
+			list.PushTail(value)
+		}
+	}
+	h.signalKeyAsReady(key)
+	return list.Len(), nil
+}
+
+func (h *CommandHandler) handleLPop(client *client.Client, command *Command) response.Value {
+	return h.popGeneric(command, true)
+}
+
+func (h *CommandHandler) handleRPop(client *client.Client, command *Command) response.Value {
+	return h.popGeneric(command, false)
+}
+
+// popGeneric is LPOP and RPOP, which reply with a single element or with
+// an array once a count is given
+func (h *CommandHandler) popGeneric(command *Command, head bool) response.Value {
+	if len(command.Args) > 2 {
+		return wrongArgsCount(h.registry.Lookup(strings.ToLower(command.Name)))
+	}
+
+	count := int64(-1)
+	if len(command.Args) == 2 {
+		var ok bool
+		if count, ok = parseInt(command.Args[1]); !ok || count < 0 {
+			return response.NewError(errMustBePositive)
+		}
+	}
+
+	key := command.Args[0]
+	list, err := h.storage.LookupList(key)
+	if err != nil {
+		return errorReply(err)
+	}
+	if list == nil {
+		if count >= 0 {
+			return response.NewNullArray()
+		}
+		return response.NewNull()
+	}
+
+	if count < 0 {
+		value := popList(list, head)
+		h.storage.DeleteIfEmpty(key)
+		return response.NewBulkString(value)
+	}
+
+	values := []string{}
+	for ; count > 0 && list.Len() > 0; count-- {
+		values = append(values, popList(list, head))
+	}
+	h.storage.DeleteIfEmpty(key)
+	return response.NewBulkStringArray(values)
+}
+
+func popList(list *storage.List, head bool) string {
+	if head {
+		value, _ := list.PopHead()
+		return value
+	}
+	value, _ := list.PopTail()
+	return value
+}
+
+func (h *CommandHandler) handleLLen(client *client.Client, command *Command) response.Value {
+	list, err := h.storage.LookupList(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if list == nil {
+		return response.NewInteger(0)
+	}
+	return response.NewInteger(int64(list.Len()))
+}
+
+func (h *CommandHandler) handleLRange(client *client.Client, command *Command) response.Value {
+	start, end, ok := parseRange(command.Args[1], command.Args[2])
+	if !ok {
+		return response.NewError(errNotInteger)
+	}
+
+	list, err := h.storage.LookupList(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if list == nil {
+		return response.NewArray()
+	}
+	return response.NewBulkStringArray(list.Range(start, end))
+}
+
+func (h *CommandHandler) handleLIndex(client *client.Client, command *Command) response.Value {
+	index, ok := parseListIndex(command.Args[1])
+	if !ok {
+		return response.NewError(errNotInteger)
+	}
+
+	list, err := h.storage.LookupList(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if list == nil {
+		return response.NewNull()
+	}
+	value, ok := list.Index(index)
+	if !ok {
+		return response.NewNull()
+	}
+	return response.NewBulkString(value)
+}
+
+func (h *CommandHandler) handleLSet(client *client.Client, command *Command) response.Value {
+	index, ok := parseListIndex(command.Args[1])
+	if !ok {
+		return response.NewError(errNotInteger)
+	}
+
+	list, err := h.storage.LookupList(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if list == nil {
+		return response.NewError("no such key")
+	}
+	if !list.Set(index, command.Args[2]) {
+		return response.NewError("index out of range")
+	}
+	return response.NewOK()
+}
+
+func (h *CommandHandler) handleLRem(client *client.Client, command *Command) response.Value {
+	count, ok := parseListIndex(command.Args[1])
+	if !ok {
+		return response.NewError(errNotInteger)
+	}
+
+	key := command.Args[0]
+	list, err := h.storage.LookupList(key)
+	if err != nil {
+		return errorReply(err)
+	}
+	if list == nil {
+		return response.NewInteger(0)
+	}
+
+	removed := list.Remove(count, command.Args[2])
+	h.storage.DeleteIfEmpty(key)
+	return response.NewInteger(int64(removed))
+}
+
+func (h *CommandHandler) handleLTrim(client *client.Client, command *Command) response.Value {
+	start, end, ok := parseRange(command.Args[1], command.Args[2])
+	if !ok {
+		return response.NewError(errNotInteger)
+	}
+
+	key := command.Args[0]
+	list, err := h.storage.LookupList(key)
+	if err != nil {
+		return errorReply(err)
+	}
+	if list == nil {
+		return response.NewOK()
+	}
+
+	list.Trim(start, end)
+	h.storage.DeleteIfEmpty(key)
+	return response.NewOK()
+}
+
+// LINSERT key BEFORE | AFTER pivot element
+func (h *CommandHandler) handleLInsert(client *client.Client, command *Command) response.Value {
+	var before bool
+	switch strings.ToUpper(command.Args[1]) {
+	case "BEFORE":
+		before = true
+	case "AFTER":
+		before = false
+	default:
+		return response.NewError(errSyntax)
+	}
+
+	list, err := h.storage.LookupList(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if list == nil {
+		return response.NewInteger(0)
+	}
+	return response.NewInteger(int64(list.Insert(command.Args[2], command.Args[3], before)))
+}
+
+// LPOS key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+func (h *CommandHandler) handleLPos(client *client.Client, command *Command) response.Value {
+	rank, count, maxLen := int64(1), int64(-1), int64(0)
+	for i := 2; i < len(command.Args); i += 2 {
+		option := strings.ToUpper(command.Args[i])
+		if i+1 >= len(command.Args) || (option != "RANK" && option != "COUNT" && option != "MAXLEN") {
+			return response.NewError(errSyntax)
+		}
+		value, ok := parseInt(command.Args[i+1])
+		if !ok {
+			return response.NewError(errNotInteger)
+		}
+
+		switch option {
+		case "RANK":
+			if value == 0 {
+				return response.NewError("RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the last match")
+			}
+			if value == math.MinInt64 {
+				return response.NewError("value is out of range, value must between -9223372036854775807 and 9223372036854775807")
+			}
+			rank = value
+		case "COUNT":
+			if value < 0 {
+				return response.NewError("COUNT can't be negative")
+			}
+			count = value
+		case "MAXLEN":
+			if value < 0 {
+				return response.NewError("MAXLEN can't be negative")
+			}
+			maxLen = value
+		}
+	}
+
+	list, err := h.storage.LookupList(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if list == nil {
+		if count >= 0 {
+			return response.NewArray()
+		}
+		return response.NewNull()
+	}
+
+	element := command.Args[1]
+	reverse := rank < 0
+	skip := rank - 1
+	if reverse {
+		skip = -rank - 1
+	}
+
+	matches := []response.Value{}
+	compared := int64(0)
+	list.Each(reverse, func(index int, value string) bool {
+		if maxLen != 0 && compared >= maxLen {
+			return false
+		}
+		compared++
+		if value != element {
+			return true
+		}
+		if skip > 0 {
+			skip--
+			return true
+		}
+		matches = append(matches, response.NewInteger(int64(index)))
+		// COUNT 0 means every match
+		return count == 0 || int64(len(matches)) < max(count, 1)
+	})
+
+	if count >= 0 {
+		return response.NewArray(matches...)
+	}
+	if len(matches) == 0 {
+		return response.NewNull()
+	}
+	return matches[0]
+}
+
+// LMOVE source destination LEFT | RIGHT LEFT | RIGHT
+func (h *CommandHandler) handleLMove(client *client.Client, command *Command) response.Value {
+	from, ok := parseDirection(command.Args[2])
+	if !ok {
+		return response.NewError(errSyntax)
+	}
+	to, ok := parseDirection(command.Args[3])
+	if !ok {
+		return response.NewError(errSyntax)
+	}
+	return h.moveGeneric(command.Args[0], command.Args[1], from, to)
+}
+
+func (h *CommandHandler) handleRPopLPush(client *client.Client, command *Command) response.Value {
+	return h.moveGeneric(command.Args[0], command.Args[1], false, true)
+}
+
+// moveGeneric pops from one end of src and pushes to one end of dst, the
+// ends are the head when the flags are set
+func (h *CommandHandler) moveGeneric(src, dst string, fromHead, toHead bool) response.Value {
+	list, err := h.storage.LookupList(src)
+	if err != nil {
+		return errorReply(err)
+	}
+	if list == nil {
+		return response.NewNull()
+	}
+	// the destination is checked first so a wrong type loses nothing
+	if _, err := h.storage.LookupList(dst); err != nil {
+		return errorReply(err)
+	}
+
+	value := popList(list, fromHead)
+	h.storage.DeleteIfEmpty(src)
+	if _, err := h.pushList(dst, []string{value}, toHead); err != nil {
+		return errorReply(err)
+	}
+	return response.NewBulkString(value)
+}
+
+// LMPOP numkeys key [key ...] LEFT | RIGHT [COUNT count]
+func (h *CommandHandler) handleLMPop(client *client.Client, command *Command) response.Value {
+	keys, head, count, errorResponse := parseMPopArgs(command.Args)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	for _, key := range keys {
+		reply, ok, err := h.mpopFrom(key, head, count)
+		if err != nil {
+			return errorReply(err)
+		}
+		if ok {
+			return reply
+		}
+	}
+	return response.NewNullArray()
+}
+
+// mpopFrom pops up to count elements from the list at key, false when
+// there is no list
+func (h *CommandHandler) mpopFrom(key string, head bool, count int64) (response.Value, bool, error) {
+	list, err := h.storage.LookupList(key)
+	if err != nil || list == nil {
+		return response.Value{}, false, err
+	}
+
+	values := []string{}
+	for ; count > 0 && list.Len() > 0; count-- {
+		values = append(values, popList(list, head))
+	}
+	h.storage.DeleteIfEmpty(key)
+	return response.NewArray(response.NewBulkString(key), response.NewBulkStringArray(values)), true, nil
+}
+
+// BLPOP key [key ...] timeout
+func (h *CommandHandler) handleBLPop(client *client.Client, command *Command) response.Value {
+	return h.blockingPopGeneric(client, command, true)
+}
+
+// BRPOP key [key ...] timeout
+func (h *CommandHandler) handleBRPop(client *client.Client, command *Command) response.Value {
+	return h.blockingPopGeneric(client, command, false)
+}
+
+func (h *CommandHandler) blockingPopGeneric(client *client.Client, command *Command, head bool) response.Value {
+	keys := command.Args[:len(command.Args)-1]
+	timeout, errorResponse := parseTimeout(command.Args[len(command.Args)-1])
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	pop := func(key string) (response.Value, bool, error) {
+		list, err := h.storage.LookupList(key)
+		if err != nil || list == nil {
+			return response.Value{}, false, err
+		}
+		value := popList(list, head)
+		h.storage.DeleteIfEmpty(key)
+		return response.NewArray(response.NewBulkString(key), response.NewBulkString(value)), true, nil
+	}
+
+	for _, key := range keys {
+		reply, ok, err := pop(key)
+		if err != nil {
+			return errorReply(err)
+		}
+		if ok {
+			return reply
+		}
+	}
+
+	popCommand := "RPOP"
+	if head {
+		popCommand = "LPOP"
+	}
+	return h.block(client, &blockedClient{
+		keys:         keys,
+		timeout:      timeout,
+		serve:        serveIgnoringErrors(pop),
+		timeoutReply: response.NewNullArray(),
+		command: func(key string) *Command {
+			return newCommand(popCommand, key)
+		},
+	})
+}
+
+// BLMOVE source destination LEFT | RIGHT LEFT | RIGHT timeout
+func (h *CommandHandler) handleBLMove(client *client.Client, command *Command) response.Value {
+	from, ok := parseDirection(command.Args[2])
+	if !ok {
+		return response.NewError(errSyntax)
+	}
+	to, ok := parseDirection(command.Args[3])
+	if !ok {
+		return response.NewError(errSyntax)
+	}
+	return h.blockingMoveGeneric(client, command.Args[0], command.Args[1], from, to, command.Args[4])
+}
+
+// BRPOPLPUSH source destination timeout
+func (h *CommandHandler) handleBRPopLPush(client *client.Client, command *Command) response.Value {
+	return h.blockingMoveGeneric(client, command.Args[0], command.Args[1], false, true, command.Args[2])
+}
+
+func (h *CommandHandler) blockingMoveGeneric(client *client.Client, src, dst string, fromHead, toHead bool, timeoutArg string) response.Value {
+	timeout, errorResponse := parseTimeout(timeoutArg)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	reply := h.moveGeneric(src, dst, fromHead, toHead)
+	if reply.Type != response.Null {
+		return reply
+	}
+
+	return h.block(client, &blockedClient{
+		keys:     []string{src},
+		lockKeys: []string{dst},
+		timeout:  timeout,
+		serve: func(key string) (response.Value, bool) {
+			reply := h.moveGeneric(src, dst, fromHead, toHead)
+			return reply, reply.Type != response.Null
+		},
+		timeoutReply: response.NewNull(),
+		command: func(key string) *Command {
+			return newCommand("LMOVE", src, dst, directionName(fromHead), directionName(toHead))
+		},
+	})
+}
+
+// BLMPOP timeout numkeys key [key ...] LEFT | RIGHT [COUNT count]
+func (h *CommandHandler) handleBLMPop(client *client.Client, command *Command) response.Value {
+	timeout, errorResponse := parseTimeout(command.Args[0])
+	if errorResponse != nil {
+		return *errorResponse
+	}
+	keys, head, count, errorResponse := parseMPopArgs(command.Args[1:])
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	for _, key := range keys {
+		reply, ok, err := h.mpopFrom(key, head, count)
+		if err != nil {
+			return errorReply(err)
+		}
+		if ok {
+			return reply
+		}
+	}
+
+	return h.block(client, &blockedClient{
+		keys:    keys,
+		timeout: timeout,
+		serve: serveIgnoringErrors(func(key string) (response.Value, bool, error) {
+			return h.mpopFrom(key, head, count)
+		}),
+		timeoutReply: response.NewNullArray(),
+		command: func(key string) *Command {
+			return newCommand("LMPOP", "1", key, directionName(head), "COUNT", strconv.FormatInt(count, 10))
+		},
+	})
+}
+
+// serveIgnoringErrors keeps a client blocked while the ready key holds
+// something that is not a list, like redis does
+func serveIgnoringErrors(pop func(key string) (response.Value, bool, error)) func(key string) (response.Value, bool) {
+	return func(key string) (response.Value, bool) {
+		reply, ok, err := pop(key)
+		return reply, ok && err == nil
+	}
+}
+
+// parseMPopArgs parses the arguments LMPOP and BLMPOP share, which start
+// at numkeys
+func parseMPopArgs(args []string) ([]string, bool, int64, *response.Value) {
+	fail := func(message string) ([]string, bool, int64, *response.Value) {
+		reply := response.NewError(message)
+		return nil, false, 0, &reply
+	}
+
+	numKeys, ok := parseInt(args[0])
+	if !ok {
+		return fail(errNotInteger)
+	}
+	if numKeys <= 0 {
+		return fail("numkeys should be greater than 0")
+	}
+	if numKeys > int64(len(args)-2) {
+		return fail("Number of keys can't be greater than number of args")
+	}
+
+	keys := args[1 : 1+numKeys]
+	rest := args[1+numKeys:]
+	head, ok := parseDirection(rest[0])
+	if !ok {
+		return fail(errSyntax)
+	}
+
+	count := int64(1)
+	switch {
+	case len(rest) == 1:
+	case len(rest) == 3 && strings.ToUpper(rest[1]) == "COUNT":
+		if count, ok = parseInt(rest[2]); !ok || count <= 0 {
+			return fail("count should be greater than 0")
+		}
+	default:
+		return fail(errSyntax)
+	}
+	return keys, head, count, nil
+}
+
+// parseDirection is true for LEFT, the head of a list
+func parseDirection(arg string) (bool, bool) {
+	switch strings.ToUpper(arg) {
+	case "LEFT":
+		return true, true
+	case "RIGHT":
+		return false, true
+	}
+	return false, false
+}
+
+// directionName is the argument parseDirection parses
+func directionName(head bool) string {
+	if head {
+		return "LEFT"
+	}
+	return "RIGHT"
+}
+
+func parseRange(startArg, endArg string) (int, int, bool) {
+	start, ok := parseListIndex(startArg)
+	if !ok {
+		return 0, 0, false
+	}
+	end, ok := parseListIndex(endArg)
+	return start, end, ok
+}
+
+// parseListIndex clamps indexes to the int range, no list is that long
+func parseListIndex(arg string) (int, bool) {
+	value, ok := parseInt(arg)
+	if !ok {
+		return 0, false
+	}
+	if strconv.IntSize == 32 {
+		value = min(max(value, math.MinInt32), math.MaxInt32)
+	}
+	return int(value), true
+}
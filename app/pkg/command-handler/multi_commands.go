@@ -0,0 +1,125 @@
+package commandhandler
+
+import (
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/response"
+)
+
+// transactionCommands run right away inside MULTI instead of being queued
+var transactionCommands = map[string]bool{
+	"multi":   true,
+	"exec":    true,
+	"discard": true,
+	"watch":   true,
+	"quit":    true,
+	"reset":   true,
+}
+
+// queueCommand adds a command to the transaction, a command that can not
+// be queued fails the whole transaction
+func (h *CommandHandler) queueCommand(spec *CommandSpec, client *client.Client, command *Command) response.Value {
+	if spec.Has(FlagNoMulti) {
+		client.MultiFailed = true
+		return response.NewError("Command not allowed inside a transaction")
+	}
+	client.Queued = append(client.Queued, command)
+	return response.NewSimpleString("QUEUED")
+}
+
+func (h *CommandHandler) handleMulti(client *client.Client, command *Command) response.Value {
+	if client.InMulti {
+		return response.NewError("MULTI calls can not be nested")
+	}
+	client.InMulti = true
+	return response.NewOK()
+}
+
+func (h *CommandHandler) handleDiscard(client *client.Client, command *Command) response.Value {
+	if !client.InMulti {
+		return response.NewError("DISCARD without MULTI")
+	}
+	h.discardTransaction(client)
+	return response.NewOK()
+}
+
+// handleExec runs the queued commands as one, it takes the locks of all of
+// them itself so no other client sees the keys halfway through
+func (h *CommandHandler) handleExec(client *client.Client, command *Command) response.Value {
+	if !client.InMulti {
+		return response.NewError("EXEC without MULTI")
+	}
+	defer h.discardTransaction(client)
+	if client.MultiFailed {
+		return response.NewErrorCode("EXECABORT", "Transaction discarded because of previous errors.")
+	}
+
+	specs := make([]*CommandSpec, len(client.Queued))
+	keys := []string{}
+	lockAll := false
+	for i, queued := range client.Queued {
+		specs[i], _ = h.registry.Resolve(queued)
+		if specs[i].HasKeys() {
+			keys = append(keys, specs[i].Keys(queued.Args)...)
+		} else if specs[i].Has(FlagWrite | FlagReadonly) {
+			lockAll = true
+		}
+	}
+	for key := range client.Watched {
+		keys = append(keys, key)
+	}
+
+	var reply response.Value
+	run := func() {
+		if h.watchedKeysChanged(client) {
+			reply = response.NewNullArray()
+			return
+		}
+		replies := make([]response.Value, len(client.Queued))
+		for i, queued := range client.Queued {
+			replies[i] = h.run(specs[i], client, queued)
+		}
+		reply = response.NewArray(replies...)
+		if len(client.Propagated) > 0 {
+			commands := append([]*Command{newCommand("MULTI")}, client.Propagated...)
+			h.aof.Append(append(commands, newCommand("EXEC"))...)
+		}
+	}
+
+	if lockAll {
+		h.storage.AtomicAll(run)
+	} else {
+		h.storage.Atomic(keys, run)
+	}
+	return reply
+}
+
+func (h *CommandHandler) discardTransaction(client *client.Client) {
+	client.InMulti = false
+	client.Queued = nil
+	client.MultiFailed = false
+	client.Propagated = nil
+	h.unwatchAll(client)
+}
+
+// handleWatch runs under the locks of its keys, what exists now is what
+// EXEC compares with
+func (h *CommandHandler) handleWatch(client *client.Client, command *Command) response.Value {
+	if client.InMulti {
+		return response.NewError("WATCH inside MULTI is not allowed")
+	}
+	for _, key := range command.Args {
+		h.watch(client, key, h.storage.Exists(key))
+	}
+	return response.NewOK()
+}
+
+func (h *CommandHandler) handleUnwatch(client *client.Client, command *Command) response.Value {
+	h.unwatchAll(client)
+	return response.NewOK()
+}
+
+func isTransactionCommand(command *Command) bool {
+	return transactionCommands[strings.ToLower(command.Name)]
+}
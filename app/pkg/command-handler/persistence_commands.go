@@ -0,0 +1,49 @@
+package commandhandler
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/persistence"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/response"
+)
+
+func (h *CommandHandler) handleSave(client *client.Client, command *Command) response.Value {
+	if err := h.rdb.Save(); err != nil {
+		return saveErrorReply(err)
+	}
+	return response.NewOK()
+}
+
+// BGSAVE [SCHEDULE], there is nothing a save would wait for so SCHEDULE
+// changes nothing
+func (h *CommandHandler) handleBGSave(client *client.Client, command *Command) response.Value {
+	if len(command.Args) > 1 || (len(command.Args) == 1 && strings.ToUpper(command.Args[0]) != "SCHEDULE") {
+		return response.NewError(errSyntax)
+	}
+	if err := h.rdb.BackgroundSave(); err != nil {
+		return saveErrorReply(err)
+	}
+	return response.NewSimpleString("Background saving started")
+}
+
+// handleBGRewriteAOF rewrites the AOF from the keyspace, there is no save
+// it would wait for so it is never only scheduled
+func (h *CommandHandler) handleBGRewriteAOF(client *client.Client, command *Command) response.Value {
+	if err := h.aof.BackgroundRewrite(); err != nil {
+		return response.NewError(err.Error())
+	}
+	return response.NewSimpleString("Background append only file rewriting started")
+}
+
+func (h *CommandHandler) handleLastSave(client *client.Client, command *Command) response.Value {
+	return response.NewInteger(h.rdb.LastSave().Unix())
+}
+
+func saveErrorReply(err error) response.Value {
+	if errors.Is(err, persistence.ErrSaveInProgress) {
+		return response.NewError(err.Error())
+	}
+	return response.NewError("Error saving DB on disk: " + err.Error())
+}
@@ -0,0 +1,270 @@
+package commandhandler
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/response"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/storage"
+)
+
+// propagate logs a write command that succeeded to the AOF. The commands
+// of a transaction wait on the client until EXEC logs them together.
+func (h *CommandHandler) propagate(spec *CommandSpec, client *client.Client, command *Command, reply response.Value) {
+	if !h.aof.Enabled() {
+		return
+	}
+	commands := h.propagated(spec, command, reply)
+	if client.InMulti {
+		client.Propagated = append(client.Propagated, commands...)
+		return
+	}
+	h.aof.Append(commands...)
+}
+
+// propagated is what replaying the command has to run to end up where it
+// did now, it runs right after the command under the same locks. Relative
+// times become absolute and what was random or generated is taken from
+// the reply, the other commands are logged as they came.
+func (h *CommandHandler) propagated(spec *CommandSpec, command *Command, reply response.Value) []*Command {
+	args := command.Args
+	switch spec.Name {
+	case "set":
+		options, errorResponse := parseExpireOptions(command, args[2:], true)
+		if errorResponse != nil || !options.HasExpire {
+			break
+		}
+		rewritten := []string{args[0], args[1]}
+		switch {
+		case options.NX:
+			rewritten = append(rewritten, "NX")
+		case options.XX:
+			rewritten = append(rewritten, "XX")
+		}
+		if options.Get {
+			rewritten = append(rewritten, "GET")
+		}
+		// a SET that did not happen does not happen again either, its
+		// TTL does not matter
+		when := options.ExpireAt
+		if date, err := h.storage.ExpireDate(args[0]); err == nil && date >= 0 {
+			when = date
+		}
+		return []*Command{newCommand("SET", append(rewritten, "PXAT", strconv.FormatInt(when, 10))...)}
+	case "setex", "psetex":
+		when, _ := h.storage.ExpireDate(args[0])
+		return []*Command{newCommand("SET", args[0], args[2], "PXAT", strconv.FormatInt(when, 10))}
+	case "getex":
+		options, errorResponse := parseExpireOptions(command, args[1:], false)
+		if errorResponse != nil || reply.Type != response.BulkString {
+			return nil
+		}
+		switch {
+		case options.HasExpire:
+			return h.propagatedExpire(args[0])
+		case options.Persist:
+			return []*Command{newCommand("PERSIST", args[0])}
+		}
+		return nil
+	case "expire", "pexpire":
+		if reply.Int != 1 {
+			return nil
+		}
+		return h.propagatedExpire(args[0])
+	case "hexpire", "hpexpire", "hexpireat", "hpexpireat":
+		return h.propagatedHExpire(command, reply)
+	case "spop":
+		members := []string{}
+		switch reply.Type {
+		case response.BulkString:
+			members = append(members, reply.Str)
+		case response.Set, response.Array:
+			for _, member := range reply.Array {
+				members = append(members, member.Str)
+			}
+		}
+		if len(members) == 0 {
+			return nil
+		}
+		return []*Command{newCommand("SREM", append([]string{args[0]}, members...)...)}
+	case "xadd":
+		if reply.Type != response.BulkString {
+			return nil
+		}
+		_, _, i, _ := parseXAddOptions(args)
+		rewritten := append([]string{}, args...)
+		rewritten[i] = reply.Str
+		return []*Command{newCommand(command.Name, rewritten...)}
+	case "xclaim":
+		return h.propagatedXClaim(command, reply)
+	case "xautoclaim":
+		return propagatedXAutoClaim(command, reply)
+	}
+	return []*Command{command}
+}
+
+// propagatedExpire logs the TTL a key has now, or its deletion when the
+// time given was already over
+func (h *CommandHandler) propagatedExpire(key string) []*Command {
+	when, err := h.storage.ExpireDate(key)
+	if err != nil {
+		return []*Command{newCommand("DEL", key)}
+	}
+	if when < 0 {
+		return []*Command{newCommand("PERSIST", key)}
+	}
+	return []*Command{newCommand("PEXPIREAT", key, strconv.FormatInt(when, 10))}
+}
+
+// propagatedHExpire logs the fields whose TTL was set with the date they
+// got and deletes the fields whose date was already over, replaying it
+// later must not give them back a TTL
+func (h *CommandHandler) propagatedHExpire(command *Command, reply response.Value) []*Command {
+	fieldsAt := 2
+	switch strings.ToUpper(command.Args[2]) {
+	case "NX", "XX", "GT", "LT":
+		fieldsAt = 3
+	}
+	fields, errorResponse := parseFieldsArgument(command.Args, fieldsAt)
+	if errorResponse != nil || len(fields) != len(reply.Array) {
+		return nil
+	}
+
+	key := command.Args[0]
+	hash, _ := h.storage.LookupHash(key)
+	deleted := []string{}
+	dates := []int64{}
+	fieldsAtDate := map[int64][]string{}
+	for i, result := range reply.Array {
+		switch result.Int {
+		case 1:
+			if hash == nil {
+				continue
+			}
+			when, ok := hash.ExpireAt(fields[i])
+			if !ok {
+				continue
+			}
+			if _, seen := fieldsAtDate[when]; !seen {
+				dates = append(dates, when)
+			}
+			fieldsAtDate[when] = append(fieldsAtDate[when], fields[i])
+		case 2:
+			deleted = append(deleted, fields[i])
+		}
+	}
+
+	commands := []*Command{}
+	if len(deleted) > 0 {
+		commands = append(commands, newCommand("HDEL", append([]string{key}, deleted...)...))
+	}
+	for _, when := range dates {
+		changed := fieldsAtDate[when]
+		args := []string{key, strconv.FormatInt(when, 10), "FIELDS", strconv.Itoa(len(changed))}
+		commands = append(commands, newCommand("HPEXPIREAT", append(args, changed...)...))
+	}
+	return commands
+}
+
+// propagatedXClaim splits XCLAIM in the IDs that were claimed, which are
+// claimed again no matter how idle they are, and the others, which are
+// given again with a min-idle-time no entry reaches. That second part
+// still acknowledges deleted entries and forces entries into the PEL.
+func (h *CommandHandler) propagatedXClaim(command *Command, reply response.Value) []*Command {
+	i := 4
+	for ; i < len(command.Args); i++ {
+		if _, ok := parseStreamID(command.Args[i], 0); !ok {
+			break
+		}
+	}
+	ids, options := command.Args[4:i], []string{}
+	for ; i < len(command.Args); i++ {
+		switch option := strings.ToUpper(command.Args[i]); option {
+		case "FORCE", "JUSTID":
+			options = append(options, option)
+		case "IDLE":
+			idle, _ := parseInt(command.Args[i+1])
+			options = append(options, "TIME", strconv.FormatInt(time.Now().UnixMilli()-idle, 10))
+			i++
+		default:
+			options = append(options, option, command.Args[i+1])
+			i++
+		}
+	}
+
+	claimed := claimedIDs(reply.Array)
+	isClaimed := make(map[storage.StreamID]bool, len(claimed))
+	for _, id := range claimed {
+		parsed, _ := parseStreamID(id, 0)
+		isClaimed[parsed] = true
+	}
+	others := []string{}
+	for _, id := range ids {
+		if parsed, _ := parseStreamID(id, 0); !isClaimed[parsed] {
+			others = append(others, id)
+		}
+	}
+
+	key, group, consumer := command.Args[0], command.Args[1], command.Args[2]
+	commands := []*Command{}
+	if len(claimed) > 0 {
+		args := append([]string{key, group, consumer, "0"}, claimed...)
+		commands = append(commands, newCommand("XCLAIM", append(args, options...)...))
+	}
+	if len(others) > 0 {
+		args := append([]string{key, group, consumer, strconv.FormatInt(math.MaxInt64, 10)}, others...)
+		commands = append(commands, newCommand("XCLAIM", append(args, options...)...))
+	}
+	return commands
+}
+
+// propagatedXAutoClaim is XCLAIM of what was claimed and XACK of the
+// deleted entries it found
+func propagatedXAutoClaim(command *Command, reply response.Value) []*Command {
+	key, group, consumer := command.Args[0], command.Args[1], command.Args[2]
+	justID := false
+	for _, arg := range command.Args[5:] {
+		if strings.ToUpper(arg) == "JUSTID" {
+			justID = true
+		}
+	}
+
+	commands := []*Command{}
+	if claimed := claimedIDs(reply.Array[1].Array); len(claimed) > 0 {
+		args := append([]string{key, group, consumer, "0"}, claimed...)
+		if justID {
+			args = append(args, "JUSTID")
+		}
+		commands = append(commands, newCommand("XCLAIM", args...))
+	} else {
+		commands = append(commands, newCommand("XGROUP", "CREATECONSUMER", key, group, consumer))
+	}
+	if deleted := reply.Array[2].Array; len(deleted) > 0 {
+		args := []string{key, group}
+		for _, id := range deleted {
+			args = append(args, id.Str)
+		}
+		commands = append(commands, newCommand("XACK", args...))
+	}
+	return commands
+}
+
+// claimedIDs takes the IDs from the entries or, with JUSTID, the IDs
+// XCLAIM replied with
+func claimedIDs(entries []response.Value) []string {
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Type == response.Array {
+			entry = entry.Array[0]
+		}
+		ids = append(ids, entry.Str)
+	}
+	return ids
+}
+
+func newCommand(name string, args ...string) *Command {
+	return &Command{Name: name, Args: args}
+}
@@ -0,0 +1,145 @@
+package commandhandler
+
+import (
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/response"
+)
+
+// subscribedModeCommands are the only commands a RESP2 client with
+// subscriptions can run, its connection carries messages instead of
+// replies. RESP3 tells them apart with the push type so it has no limit.
+var subscribedModeCommands = map[string]bool{
+	"subscribe":    true,
+	"unsubscribe":  true,
+	"psubscribe":   true,
+	"punsubscribe": true,
+	"ssubscribe":   true,
+	"sunsubscribe": true,
+	"ping":         true,
+	"quit":         true,
+	"reset":        true,
+}
+
+func inSubscribedMode(client *client.Client) bool {
+	return client.Protocol == response.ProtocolRESP2 && client.Subscriptions() > 0
+}
+
+// subscriptionReply is what every (un)subscribe confirms for each channel,
+// pushed so that it stays in order with the messages
+func subscriptionReply(client *client.Client, kind string, channel response.Value) {
+	client.Push(response.NewPush(
+		response.NewBulkString(kind),
+		channel,
+		response.NewInteger(int64(client.Subscriptions())),
+	))
+}
+
+func (h *CommandHandler) handleSubscribe(client *client.Client, command *Command) response.Value {
+	for _, channel := range command.Args {
+		h.pubsub.Subscribe(client, channel)
+		subscriptionReply(client, "subscribe", response.NewBulkString(channel))
+	}
+	return response.NewNoReply()
+}
+
+func (h *CommandHandler) handlePSubscribe(client *client.Client, command *Command) response.Value {
+	for _, pattern := range command.Args {
+		h.pubsub.PSubscribe(client, pattern)
+		subscriptionReply(client, "psubscribe", response.NewBulkString(pattern))
+	}
+	return response.NewNoReply()
+}
+
+// handleUnsubscribe without channels unsubscribes from all of them, a
+// client without any still gets one confirmation
+func (h *CommandHandler) handleUnsubscribe(client *client.Client, command *Command) response.Value {
+	channels := command.Args
+	if len(channels) == 0 {
+		if len(client.Channels) == 0 {
+			subscriptionReply(client, "unsubscribe", response.NewNull())
+			return response.NewNoReply()
+		}
+		for channel := range client.Channels {
+			channels = append(channels, channel)
+		}
+	}
+
+	for _, channel := range channels {
+		h.pubsub.Unsubscribe(client, channel)
+		subscriptionReply(client, "unsubscribe", response.NewBulkString(channel))
+	}
+	return response.NewNoReply()
+}
+
+func (h *CommandHandler) handlePUnsubscribe(client *client.Client, command *Command) response.Value {
+	patterns := command.Args
+	if len(patterns) == 0 {
+		if len(client.Patterns) == 0 {
+			subscriptionReply(client, "punsubscribe", response.NewNull())
+			return response.NewNoReply()
+		}
+		for pattern := range client.Patterns {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	for _, pattern := range patterns {
+		h.pubsub.PUnsubscribe(client, pattern)
+		subscriptionReply(client, "punsubscribe", response.NewBulkString(pattern))
+	}
+	return response.NewNoReply()
+}
+
+func (h *CommandHandler) handlePublish(client *client.Client, command *Command) response.Value {
+	return response.NewInteger(int64(h.pubsub.Publish(command.Args[0], command.Args[1])))
+}
+
+func (h *CommandHandler) handlePubSubChannels(client *client.Client, command *Command) response.Value {
+	if len(command.Args) > 2 {
+		return wrongArgsCount(h.registry.Lookup("pubsub").Subcommands["channels"])
+	}
+	pattern := ""
+	if len(command.Args) == 2 {
+		pattern = command.Args[1]
+	}
+
+	reply := []response.Value{}
+	for _, channel := range h.pubsub.Channels(pattern) {
+		reply = append(reply, response.NewBulkString(channel))
+	}
+	return response.NewArray(reply...)
+}
+
+func (h *CommandHandler) handlePubSubNumSub(client *client.Client, command *Command) response.Value {
+	reply := []response.Value{}
+	for _, channel := range command.Args[1:] {
+		reply = append(reply,
+			response.NewBulkString(channel),
+			response.NewInteger(int64(h.pubsub.NumSub(channel))),
+		)
+	}
+	return response.NewArray(reply...)
+}
+
+func (h *CommandHandler) handlePubSubNumPat(client *client.Client, command *Command) response.Value {
+	return response.NewInteger(int64(h.pubsub.NumPat()))
+}
+
+func (h *CommandHandler) handlePubSubHelp(client *client.Client, command *Command) response.Value {
+	return helpReply("PUBSUB",
+		"CHANNELS [<pattern>]",
+		"    Return the currently active channels matching a <pattern> (default: '*').",
+		"NUMPAT",
+		"    Return number of subscriptions to patterns.",
+		"NUMSUB [<channel> ...]",
+		"    Return the number of subscribers for the specified channels, excluding",
+		"    pattern subscriptions(default: no channels).",
+	)
+}
+
+func subscribedModeError(command *Command) response.Value {
+	return response.NewError("Can't execute '" + strings.ToLower(command.Name) +
+		"': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context")
+}
@@ -0,0 +1,199 @@
+package commandhandler
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/response"
+)
+
+type CommandFlag uint
+
+const (
+	FlagWrite CommandFlag = 1 << iota
+	FlagReadonly
+	FlagDenyOOM
+	FlagAdmin
+	FlagPubSub
+	FlagNoScript
+	FlagBlocking
+	FlagLoading
+	FlagStale
+	FlagFast
+	FlagNoMulti
+)
+
+var flagNames = []struct {
+	flag CommandFlag
+	name string
+}{
+	{FlagWrite, "write"},
+	{FlagReadonly, "readonly"},
+	{FlagDenyOOM, "denyoom"},
+	{FlagAdmin, "admin"},
+	{FlagPubSub, "pubsub"},
+	{FlagNoScript, "noscript"},
+	{FlagBlocking, "blocking"},
+	{FlagLoading, "loading"},
+	{FlagStale, "stale"},
+	{FlagFast, "fast"},
+	{FlagNoMulti, "no_multi"},
+}
+
+type HandlerFunc func(client *client.Client, command *Command) response.Value
+
+// CommandSpec describes a command the way the COMMAND command reports it.
+// Arity counts the command name itself and a negative arity means at
+// least that many. Key positions are indexes in that same argv, LastKey
+// is negative when counting from the end.
+type CommandSpec struct {
+	Name     string
+	Arity    int
+	Flags    CommandFlag
+	FirstKey int
+	LastKey  int
+	Step     int
+	// KeysFunc is for commands whose keys can not be described by
+	// positions, like the ones with a numkeys argument
+	KeysFunc func(args []string) []string
+	Handler  HandlerFunc
+
+	// containers like CONFIG dispatch on their first argument
+	Subcommands map[string]*CommandSpec
+	parent      *CommandSpec
+}
+
+func (s *CommandSpec) Has(flag CommandFlag) bool {
+	return s.Flags&flag != 0
+}
+
+// FullName is "config|get" for subcommands like redis names them
+func (s *CommandSpec) FullName() string {
+	if s.parent != nil {
+		return s.parent.Name + "|" + s.Name
+	}
+	return s.Name
+}
+
+// Keys returns the key arguments of a command, args do not include the name
+func (s *CommandSpec) Keys(args []string) []string {
+	if s.KeysFunc != nil {
+		return s.KeysFunc(args)
+	}
+	if s.FirstKey == 0 {
+		return nil
+	}
+
+	argv := len(args) + 1
+	last := s.LastKey
+	if last < 0 {
+		last = argv + last
+	}
+
+	keys := []string{}
+	for i := s.FirstKey; i <= last && i < argv; i += s.Step {
+		keys = append(keys, args[i-1])
+	}
+	return keys
+}
+
+func (s *CommandSpec) HasKeys() bool {
+	return s.FirstKey != 0 || s.KeysFunc != nil
+}
+
+func (s *CommandSpec) checkArity(argv int) bool {
+	return (s.Arity > 0 && argv == s.Arity) || (s.Arity < 0 && argv >= -s.Arity)
+}
+
+type Registry struct {
+	commands map[string]*CommandSpec
+}
+
+func NewRegistry() *Registry {
+	return &Registry{commands: make(map[string]*CommandSpec)}
+}
+
+func (r *Registry) Register(spec *CommandSpec) {
+	for _, subcommand := range spec.Subcommands {
+		subcommand.parent = spec
+	}
+	r.commands[spec.Name] = spec
+}
+
+func (r *Registry) Lookup(name string) *CommandSpec {
+	return r.commands[strings.ToLower(name)]
+}
+
+func (r *Registry) Count() int {
+	return len(r.commands)
+}
+
+// All returns the commands sorted by name so replies are stable
+func (r *Registry) All() []*CommandSpec {
+	specs := make([]*CommandSpec, 0, len(r.commands))
+	for _, spec := range r.commands {
+		specs = append(specs, spec)
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+	return specs
+}
+
+// Resolve finds the spec that handles the command, descending into
+// containers. It returns the container and false for unknown subcommands.
+// Containers called without arguments, like COMMAND, resolve to themselves.
+func (r *Registry) Resolve(command *Command) (*CommandSpec, bool) {
+	spec := r.Lookup(command.Name)
+	if spec == nil {
+		return nil, false
+	}
+	if spec.Subcommands == nil || len(command.Args) == 0 {
+		return spec, true
+	}
+
+	subcommand, ok := spec.Subcommands[strings.ToLower(command.Args[0])]
+	if !ok {
+		return spec, false
+	}
+	return subcommand, true
+}
+
+// numkeysKeys is the KeysFunc of commands like LMPOP that take numkeys
+// followed by the keys, numkeys is at offset of the arguments
+func numkeysKeys(offset int) func(args []string) []string {
+	return func(args []string) []string {
+		if len(args) <= offset {
+			return nil
+		}
+		numKeys, ok := parseInt(args[offset])
+		if !ok || numKeys <= 0 || numKeys > int64(len(args)-offset-1) {
+			return nil
+		}
+		return args[offset+1 : offset+1+int(numKeys)]
+	}
+}
+
+// storeNumkeysKeys is the KeysFunc of commands like ZUNIONSTORE that take
+// a destination before numkeys
+func storeNumkeysKeys(args []string) []string {
+	return append([]string{args[0]}, numkeysKeys(1)(args)...)
+}
+
+// streamsKeys is the KeysFunc of XREAD and XREADGROUP, the keys are the
+// first half of the arguments after STREAMS
+func streamsKeys(args []string) []string {
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "GROUP":
+			// the group and consumer names could be STREAMS
+			i += 2
+		case "STREAMS":
+			rest := args[i+1:]
+			if len(rest)%2 != 0 {
+				return nil
+			}
+			return rest[:len(rest)/2]
+		}
+	}
+	return nil
+}
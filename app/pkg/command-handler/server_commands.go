@@ -0,0 +1,350 @@
+package commandhandler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/config"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/response"
+)
+
+func (h *CommandHandler) handlePing(client *client.Client, command *Command) response.Value {
+	if len(command.Args) > 1 {
+		return wrongArgsCount(h.registry.Lookup("ping"))
+	}
+	// subscribed RESP2 connections can not tell replies from messages,
+	// so PING answers in the shape of a message there
+	if inSubscribedMode(client) {
+		message := ""
+		if len(command.Args) == 1 {
+			message = command.Args[0]
+		}
+		return response.NewArray(response.NewBulkString("pong"), response.NewBulkString(message))
+	}
+	if len(command.Args) == 1 {
+		return response.NewBulkString(command.Args[0])
+	}
+	return response.NewSimpleString("PONG")
+}
+
+func (h *CommandHandler) handleEcho(client *client.Client, command *Command) response.Value {
+	return response.NewBulkString(command.Args[0])
+}
+
+// handleHello switches the protocol of the connection and replies with
+// the server properties, which RESP3 clients receive as a map
+func (h *CommandHandler) handleHello(client *client.Client, command *Command) response.Value {
+	protocol := client.Protocol
+	if len(command.Args) > 0 {
+		version, err := strconv.Atoi(command.Args[0])
+		if err != nil {
+			return response.NewError("Protocol version is not an integer or out of range")
+		}
+		if version != response.ProtocolRESP2 && version != response.ProtocolRESP3 {
+			return response.NewErrorCode("NOPROTO", "unsupported protocol version")
+		}
+		protocol = version
+	}
+
+	name := client.Name
+	for i := 1; i < len(command.Args); i++ {
+		option := strings.ToUpper(command.Args[i])
+		switch {
+		case option == "AUTH" && i+2 < len(command.Args):
+			// there are no users besides default and it has no password
+			if command.Args[i+1] != "default" {
+				return response.NewErrorCode("WRONGPASS", "invalid username-password pair or user is disabled.")
+			}
+			i += 2
+		case option == "SETNAME" && i+1 < len(command.Args):
+			name = command.Args[i+1]
+			if !isValidClientName(name) {
+				return response.NewError("Client names cannot contain spaces, newlines or special characters.")
+			}
+			i++
+		default:
+			return response.NewError(fmt.Sprintf("Syntax error in HELLO option '%s'", command.Args[i]))
+		}
+	}
+
+	client.SetProtocol(protocol)
+	client.Name = name
+
+	return response.NewMap(
+		response.NewBulkString("server"), response.NewBulkString("redis"),
+		response.NewBulkString("version"), response.NewBulkString(config.RedisVersion),
+		response.NewBulkString("proto"), response.NewInteger(int64(protocol)),
+		response.NewBulkString("id"), response.NewInteger(client.Id),
+		response.NewBulkString("mode"), response.NewBulkString("standalone"),
+		response.NewBulkString("role"), response.NewBulkString(h.config.Role),
+		response.NewBulkString("modules"), response.NewArray(),
+	)
+}
+
+func (h *CommandHandler) handleInfo(client *client.Client, command *Command) response.Value {
+	sections := map[string]func() []string{
+		"server":      h.infoServer,
+		"persistence": h.infoPersistence,
+		"replication": h.infoReplication,
+		"stats":       h.infoStats,
+		"keyspace":    h.infoKeyspace,
+	}
+	order := []string{"server", "persistence", "stats", "replication", "keyspace"}
+
+	requested := []string{}
+	for _, arg := range command.Args {
+		section := strings.ToLower(arg)
+		if section == "all" || section == "everything" || section == "default" {
+			requested = order
+			break
+		}
+		requested = append(requested, section)
+	}
+	if len(requested) == 0 {
+		requested = order
+	}
+
+	lines := []string{}
+	for _, section := range requested {
+		builder, ok := sections[section]
+		if !ok {
+			continue
+		}
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, builder()...)
+	}
+
+	return response.NewVerbatim("txt", strings.Join(lines, "\r\n")+"\r\n")
+}
+
+func (h *CommandHandler) infoServer() []string {
+	return []string{
+		"# Server",
+		"redis_version:" + config.RedisVersion,
+		"redis_mode:standalone",
+		"tcp_port:" + h.config.Port,
+	}
+}
+
+func (h *CommandHandler) infoPersistence() []string {
+	status := h.rdb.Status()
+	aofStatus := h.aof.Status()
+	lines := []string{
+		"# Persistence",
+		"loading:0",
+		"rdb_changes_since_last_save:" + strconv.FormatInt(status.Changes, 10),
+		"rdb_bgsave_in_progress:" + boolInfo(status.InProgress),
+		"rdb_last_save_time:" + strconv.FormatInt(status.LastSave.Unix(), 10),
+		"rdb_last_bgsave_status:" + okInfo(status.LastOK),
+		"rdb_last_bgsave_time_sec:" + durationInfo(status.LastDuration),
+		"rdb_current_bgsave_time_sec:" + durationInfo(status.CurrentDuration),
+		"aof_enabled:" + boolInfo(aofStatus.Enabled),
+		"aof_rewrite_in_progress:" + boolInfo(aofStatus.Rewriting),
+		"aof_rewrite_scheduled:0",
+		"aof_last_rewrite_time_sec:" + durationInfo(aofStatus.LastRewriteDuration),
+		"aof_current_rewrite_time_sec:" + durationInfo(aofStatus.CurrentRewriteDuration),
+		"aof_last_bgrewrite_status:" + okInfo(aofStatus.LastRewriteOK),
+		"aof_last_write_status:" + okInfo(aofStatus.LastWriteOK),
+	}
+	if aofStatus.Enabled {
+		lines = append(lines,
+			"aof_current_size:"+strconv.FormatInt(aofStatus.CurrentSize, 10),
+			"aof_base_size:"+strconv.FormatInt(aofStatus.BaseSize, 10),
+		)
+	}
+	return lines
+}
+
+// boolInfo is how INFO writes flags
+func boolInfo(value bool) string {
+	if value {
+		return "1"
+	}
+	return "0"
+}
+
+// okInfo is how INFO writes the outcome of the last save or write
+func okInfo(ok bool) string {
+	if ok {
+		return "ok"
+	}
+	return "err"
+}
+
+// durationInfo writes whole seconds, a negative duration is -1 like redis
+// writes a time it does not have
+func durationInfo(duration time.Duration) string {
+	if duration < 0 {
+		return "-1"
+	}
+	return strconv.FormatInt(int64(duration/time.Second), 10)
+}
+
+func (h *CommandHandler) infoReplication() []string {
+	return []string{
+		"# Replication",
+		"role:" + h.config.Role,
+		"master_replid:" + h.config.ReplicationId,
+		"master_repl_offset:" + fmt.Sprintf("%d", h.config.ReplicationOffset),
+	}
+}
+
+func (h *CommandHandler) infoStats() []string {
+	return []string{
+		"# Stats",
+		"expired_keys:" + strconv.FormatInt(h.storage.ExpiredKeys(), 10),
+	}
+}
+
+func (h *CommandHandler) infoKeyspace() []string {
+	lines := []string{"# Keyspace"}
+	if keys := h.storage.KeyCount(); keys > 0 {
+		lines = append(lines, fmt.Sprintf("db0:keys=%d,expires=%d,avg_ttl=0", keys, h.storage.ExpiresCount()))
+	}
+	return lines
+}
+
+func (h *CommandHandler) handleConfigGet(client *client.Client, command *Command) response.Value {
+	rewritePercentage, rewriteMinSize := h.aof.AutoRewrite()
+	parameters := map[string]string{
+		"dir":                         h.config.Dir,
+		"dbfilename":                  h.config.DbFileName,
+		"save":                        config.FormatSaveRules(h.rdb.Rules()),
+		"appendonly":                  config.YesNo(h.aof.Enabled()),
+		"appendfsync":                 h.aof.Fsync(),
+		"aof-load-truncated":          config.YesNo(h.config.AOFLoadTruncated),
+		"appendfilename":              config.AppendFilename,
+		"appenddirname":               config.AppendDirname,
+		"auto-aof-rewrite-percentage": strconv.FormatInt(rewritePercentage, 10),
+		"auto-aof-rewrite-min-size":   strconv.FormatInt(rewriteMinSize, 10),
+	}
+
+	reply := []response.Value{}
+	for _, arg := range command.Args[1:] {
+		parameter := strings.ToLower(arg)
+		if value, ok := parameters[parameter]; ok {
+			reply = append(reply, response.NewBulkString(parameter), response.NewBulkString(value))
+		}
+	}
+	return response.NewMap(reply...)
+}
+
+// handleConfigSet applies every parameter or none of them, save and the
+// AOF policies are the ones that can change at runtime
+func (h *CommandHandler) handleConfigSet(client *client.Client, command *Command) response.Value {
+	args := command.Args[1:]
+	if len(args)%2 != 0 {
+		return wrongArgsCount(h.registry.Lookup("config").Subcommands["set"])
+	}
+
+	var saveRules []config.SaveRule
+	appendFsync := ""
+	rewritePercentage, rewriteMinSize := h.aof.AutoRewrite()
+	for i := 0; i < len(args); i += 2 {
+		parameter := strings.ToLower(args[i])
+		switch parameter {
+		case "save":
+			rules, err := config.ParseSaveRules(args[i+1])
+			if err != nil {
+				return response.NewError(fmt.Sprintf("CONFIG SET failed (possibly related to argument '%s') - %s", parameter, err))
+			}
+			saveRules = rules
+		case "appendfsync":
+			policy, err := config.ParseAppendFsync(args[i+1])
+			if err != nil {
+				return response.NewError(fmt.Sprintf("CONFIG SET failed (possibly related to argument '%s') - %s", parameter, err))
+			}
+			appendFsync = policy
+		case "auto-aof-rewrite-percentage":
+			percentage, err := config.ParsePercentage(args[i+1])
+			if err != nil {
+				return response.NewError(fmt.Sprintf("CONFIG SET failed (possibly related to argument '%s') - %s", parameter, err))
+			}
+			rewritePercentage = percentage
+		case "auto-aof-rewrite-min-size":
+			size, err := config.ParseMemory(args[i+1])
+			if err != nil {
+				return response.NewError(fmt.Sprintf("CONFIG SET failed (possibly related to argument '%s') - %s", parameter, err))
+			}
+			rewriteMinSize = size
+		default:
+			return response.NewError(fmt.Sprintf("Unknown option or number of arguments for CONFIG SET - '%s'", args[i]))
+		}
+	}
+
+	if saveRules != nil {
+		h.rdb.SetRules(saveRules)
+	}
+	if appendFsync != "" {
+		h.aof.SetFsync(appendFsync)
+	}
+	h.aof.SetAutoRewrite(rewritePercentage, rewriteMinSize)
+	return response.NewOK()
+}
+
+func (h *CommandHandler) handleConfigHelp(client *client.Client, command *Command) response.Value {
+	return helpReply("CONFIG",
+		"GET <pattern>",
+		"    Return parameters matching the glob-like <pattern> and their values.",
+		"SET <directive> <value>",
+		"    Set the configuration <directive> to <value>.",
+	)
+}
+
+func (h *CommandHandler) handleClientId(client *client.Client, command *Command) response.Value {
+	return response.NewInteger(client.Id)
+}
+
+func (h *CommandHandler) handleClientGetName(client *client.Client, command *Command) response.Value {
+	if client.Name == "" {
+		return response.NewNull()
+	}
+	return response.NewBulkString(client.Name)
+}
+
+func (h *CommandHandler) handleClientSetName(client *client.Client, command *Command) response.Value {
+	if !isValidClientName(command.Args[1]) {
+		return response.NewError("Client names cannot contain spaces, newlines or special characters.")
+	}
+	client.Name = command.Args[1]
+	return response.NewOK()
+}
+
+func (h *CommandHandler) handleClientHelp(client *client.Client, command *Command) response.Value {
+	return helpReply("CLIENT",
+		"GETNAME",
+		"    Return the name of the current connection.",
+		"ID",
+		"    Return the ID of the current connection.",
+		"SETNAME <name>",
+		"    Assign the name <name> to the current connection.",
+	)
+}
+
+func isValidClientName(name string) bool {
+	for _, c := range name {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func helpReply(container string, lines ...string) response.Value {
+	reply := []response.Value{
+		response.NewSimpleString(container + " <subcommand> [<arg> [value] [opt] ...]. Subcommands are:"),
+	}
+	for _, line := range lines {
+		reply = append(reply, response.NewSimpleString(line))
+	}
+	reply = append(reply,
+		response.NewSimpleString("HELP"),
+		response.NewSimpleString("    Print this help."),
+	)
+	return response.NewArray(reply...)
+}
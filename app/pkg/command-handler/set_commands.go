@@ -0,0 +1,424 @@
+package commandhandler
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/glob"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/response"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/storage"
+)
+
+func (h *CommandHandler) handleSAdd(client *client.Client, command *Command) response.Value {
+	set, err := h.storage.LookupOrCreateSet(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	added := 0
+	for _, member := range command.Args[1:] {
+		if set.Add(member) {
+			added++
+		}
+	}
+	return response.NewInteger(int64(added))
+}
+
+func (h *CommandHandler) handleSRem(client *client.Client, command *Command) response.Value {
+	key := command.Args[0]
+	set, err := h.storage.LookupSet(key)
+	if err != nil {
+		return errorReply(err)
+	}
+	if set == nil {
+		return response.NewInteger(0)
+	}
+
+	removed := 0
+	for _, member := range command.Args[1:] {
+		if set.Remove(member) {
+			removed++
+		}
+	}
+	h.storage.DeleteIfEmpty(key)
+	return response.NewInteger(int64(removed))
+}
+
+func (h *CommandHandler) handleSMembers(client *client.Client, command *Command) response.Value {
+	set, err := h.storage.LookupSet(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if set == nil {
+		return response.NewSet()
+	}
+	return response.NewBulkStringSet(set.Members())
+}
+
+func (h *CommandHandler) handleSIsMember(client *client.Client, command *Command) response.Value {
+	set, err := h.storage.LookupSet(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if set == nil || !set.Contains(command.Args[1]) {
+		return response.NewInteger(0)
+	}
+	return response.NewInteger(1)
+}
+
+func (h *CommandHandler) handleSMIsMember(client *client.Client, command *Command) response.Value {
+	set, err := h.storage.LookupSet(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+
+	results := make([]response.Value, 0, len(command.Args)-1)
+	for _, member := range command.Args[1:] {
+		if set != nil && set.Contains(member) {
+			results = append(results, response.NewInteger(1))
+		} else {
+			results = append(results, response.NewInteger(0))
+		}
+	}
+	return response.NewArray(results...)
+}
+
+func (h *CommandHandler) handleSCard(client *client.Client, command *Command) response.Value {
+	set, err := h.storage.LookupSet(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if set == nil {
+		return response.NewInteger(0)
+	}
+	return response.NewInteger(int64(set.Len()))
+}
+
+// SPOP key [count]
+func (h *CommandHandler) handleSPop(client *client.Client, command *Command) response.Value {
+	if len(command.Args) > 2 {
+		return response.NewError(errSyntax)
+	}
+	count := int64(-1)
+	if len(command.Args) == 2 {
+		var ok bool
+		if count, ok = parseInt(command.Args[1]); !ok || count < 0 {
+			return response.NewError(errMustBePositive)
+		}
+	}
+
+	key := command.Args[0]
+	set, err := h.storage.LookupSet(key)
+	if err != nil {
+		return errorReply(err)
+	}
+	if set == nil {
+		if count >= 0 {
+			return response.NewSet()
+		}
+		return response.NewNull()
+	}
+
+	if count < 0 {
+		member := set.Random()
+		set.Remove(member)
+		h.storage.DeleteIfEmpty(key)
+		return response.NewBulkString(member)
+	}
+
+	popped := []string{}
+	for ; count > 0 && set.Len() > 0; count-- {
+		member := set.Random()
+		set.Remove(member)
+		popped = append(popped, member)
+	}
+	h.storage.DeleteIfEmpty(key)
+	return response.NewBulkStringSet(popped)
+}
+
+// SRANDMEMBER key [count]
+//
+// a positive count returns distinct members, a negative one may return
+// the same member many times
+func (h *CommandHandler) handleSRandMember(client *client.Client, command *Command) response.Value {
+	if len(command.Args) > 2 {
+		return response.NewError(errSyntax)
+	}
+	count, hasCount := int64(1), len(command.Args) == 2
+	if hasCount {
+		var ok bool
+		if count, ok = parseInt(command.Args[1]); !ok {
+			return response.NewError(errNotInteger)
+		}
+		if count < -math.MaxInt64/2 {
+			return response.NewError("value is out of range")
+		}
+	}
+
+	set, err := h.storage.LookupSet(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if set == nil {
+		if hasCount {
+			return response.NewArray()
+		}
+		return response.NewNull()
+	}
+	if !hasCount {
+		return response.NewBulkString(set.Random())
+	}
+
+	if count < 0 {
+		members := make([]string, 0, min(-count, 1024))
+		for i := int64(0); i < -count; i++ {
+			members = append(members, set.Random())
+		}
+		return response.NewBulkStringArray(members)
+	}
+
+	members := set.Members()
+	rand.Shuffle(len(members), func(i, j int) {
+		members[i], members[j] = members[j], members[i]
+	})
+	return response.NewBulkStringArray(members[:min(int(min(count, math.MaxInt32)), len(members))])
+}
+
+// SMOVE source destination member
+func (h *CommandHandler) handleSMove(client *client.Client, command *Command) response.Value {
+	src, dst, member := command.Args[0], command.Args[1], command.Args[2]
+	srcSet, err := h.storage.LookupSet(src)
+	if err != nil {
+		return errorReply(err)
+	}
+	if _, err := h.storage.LookupSet(dst); err != nil {
+		return errorReply(err)
+	}
+	if srcSet == nil || !srcSet.Contains(member) {
+		return response.NewInteger(0)
+	}
+	if src == dst {
+		return response.NewInteger(1)
+	}
+
+	srcSet.Remove(member)
+	h.storage.DeleteIfEmpty(src)
+	dstSet, err := h.storage.LookupOrCreateSet(dst)
+	if err != nil {
+		return errorReply(err)
+	}
+	dstSet.Add(member)
+	return response.NewInteger(1)
+}
+
+// SSCAN key cursor [MATCH pattern] [COUNT count]
+func (h *CommandHandler) handleSScan(client *client.Client, command *Command) response.Value {
+	cursor, err := strconv.ParseUint(command.Args[1], 10, 64)
+	if err != nil {
+		return response.NewError("invalid cursor")
+	}
+
+	pattern := ""
+	count := int64(10)
+	for i := 2; i < len(command.Args); i += 2 {
+		if i+1 >= len(command.Args) {
+			return response.NewError(errSyntax)
+		}
+		switch strings.ToUpper(command.Args[i]) {
+		case "MATCH":
+			pattern = command.Args[i+1]
+		case "COUNT":
+			var ok bool
+			if count, ok = parseInt(command.Args[i+1]); !ok {
+				return response.NewError(errNotInteger)
+			}
+			if count < 1 {
+				return response.NewError(errSyntax)
+			}
+		default:
+			return response.NewError(errSyntax)
+		}
+	}
+
+	set, err := h.storage.LookupSet(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+
+	next, scanned := uint64(0), []string{}
+	if set != nil {
+		next, scanned = set.Scan(cursor, int(min(count, math.MaxInt32)))
+	}
+
+	members := []string{}
+	for _, member := range scanned {
+		if pattern == "" || pattern == "*" || glob.Match(pattern, member, false) {
+			members = append(members, member)
+		}
+	}
+
+	return response.NewArray(
+		response.NewBulkString(strconv.FormatUint(next, 10)),
+		response.NewBulkStringArray(members),
+	)
+}
+
+func (h *CommandHandler) handleSInter(client *client.Client, command *Command) response.Value {
+	return h.setAlgebra(command.Args, "", setInter)
+}
+
+func (h *CommandHandler) handleSInterStore(client *client.Client, command *Command) response.Value {
+	return h.setAlgebra(command.Args[1:], command.Args[0], setInter)
+}
+
+func (h *CommandHandler) handleSUnion(client *client.Client, command *Command) response.Value {
+	return h.setAlgebra(command.Args, "", setUnion)
+}
+
+func (h *CommandHandler) handleSUnionStore(client *client.Client, command *Command) response.Value {
+	return h.setAlgebra(command.Args[1:], command.Args[0], setUnion)
+}
+
+func (h *CommandHandler) handleSDiff(client *client.Client, command *Command) response.Value {
+	return h.setAlgebra(command.Args, "", setDiff)
+}
+
+func (h *CommandHandler) handleSDiffStore(client *client.Client, command *Command) response.Value {
+	return h.setAlgebra(command.Args[1:], command.Args[0], setDiff)
+}
+
+// setAlgebra applies operation to the sets at keys, the result is
+// replied or stored at dst when it is given
+func (h *CommandHandler) setAlgebra(keys []string, dst string, operation func(sets []*storage.Set) *storage.Set) response.Value {
+	sets, err := h.lookupSets(keys)
+	if err != nil {
+		return errorReply(err)
+	}
+
+	result := operation(sets)
+	if dst == "" {
+		return response.NewBulkStringSet(result.Members())
+	}
+	h.storage.StoreSet(dst, result)
+	return response.NewInteger(int64(result.Len()))
+}
+
+// SINTERCARD numkeys key [key ...] [LIMIT limit]
+func (h *CommandHandler) handleSInterCard(client *client.Client, command *Command) response.Value {
+	numKeys, ok := parseInt(command.Args[0])
+	if !ok {
+		return response.NewError(errNotInteger)
+	}
+	if numKeys <= 0 {
+		return response.NewError("numkeys should be greater than 0")
+	}
+	if numKeys > int64(len(command.Args)-1) {
+		return response.NewError("Number of keys can't be greater than number of args")
+	}
+
+	limit := int64(0)
+	rest := command.Args[1+numKeys:]
+	switch {
+	case len(rest) == 0:
+	case len(rest) == 2 && strings.ToUpper(rest[0]) == "LIMIT":
+		if limit, ok = parseInt(rest[1]); !ok {
+			return response.NewError(errNotInteger)
+		}
+		if limit < 0 {
+			return response.NewError("LIMIT can't be negative")
+		}
+	default:
+		return response.NewError(errSyntax)
+	}
+
+	sets, err := h.lookupSets(command.Args[1 : 1+numKeys])
+	if err != nil {
+		return errorReply(err)
+	}
+	return response.NewInteger(int64(intersect(sets, int(min(limit, math.MaxInt32)), nil)))
+}
+
+// lookupSets returns the sets at keys with nil for missing keys, any key
+// of another type fails the whole command
+func (h *CommandHandler) lookupSets(keys []string) ([]*storage.Set, error) {
+	sets := make([]*storage.Set, 0, len(keys))
+	for _, key := range keys {
+		set, err := h.storage.LookupSet(key)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+	}
+	return sets, nil
+}
+
+func setInter(sets []*storage.Set) *storage.Set {
+	result := storage.NewSet()
+	intersect(sets, 0, func(member string) {
+		result.Add(member)
+	})
+	return result
+}
+
+// intersect counts the members all sets share, stopping at limit unless
+// it is 0, and passes every one of them to found when it is set
+func intersect(sets []*storage.Set, limit int, found func(member string)) int {
+	for _, set := range sets {
+		if set == nil {
+			return 0
+		}
+	}
+
+	// walking the smallest set does the least lookups
+	sorted := append([]*storage.Set{}, sets...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Len() < sorted[j].Len() })
+
+	count := 0
+	sorted[0].Each(func(member string) bool {
+		for _, other := range sorted[1:] {
+			if !other.Contains(member) {
+				return true
+			}
+		}
+		count++
+		if found != nil {
+			found(member)
+		}
+		return limit == 0 || count < limit
+	})
+	return count
+}
+
+func setUnion(sets []*storage.Set) *storage.Set {
+	result := storage.NewSet()
+	for _, set := range sets {
+		if set == nil {
+			continue
+		}
+		set.Each(func(member string) bool {
+			result.Add(member)
+			return true
+		})
+	}
+	return result
+}
+
+func setDiff(sets []*storage.Set) *storage.Set {
+	result := storage.NewSet()
+	if sets[0] == nil {
+		return result
+	}
+	sets[0].Each(func(member string) bool {
+		for _, other := range sets[1:] {
+			if other != nil && other.Contains(member) {
+				return true
+			}
+		}
+		result.Add(member)
+		return true
+	})
+	return result
+}
@@ -0,0 +1,1428 @@
+package commandhandler
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/response"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/storage"
+)
+
+const (
+	errInvalidStreamID = "Invalid stream ID specified as stream command argument"
+	errXAddIDTooSmall  = "The ID specified in XADD is equal or smaller than the target stream top item"
+	errXGroupNoKey     = "The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically."
+
+	// approximate trimming without LIMIT stops after 100 nodes like redis
+	defaultTrimLimit = 100 * 100
+)
+
+// streamTrim is the MAXLEN | MINID [= | ~] threshold [LIMIT count] part
+// of XADD and XTRIM
+type streamTrim struct {
+	strategy string
+	approx   bool
+	maxLen   int64
+	minID    storage.StreamID
+	limit    int64
+	hasLimit bool
+}
+
+// parse reads the strategy starting at args[i] and returns the index
+// after its arguments
+func (t *streamTrim) parse(args []string, i int) (int, *response.Value) {
+	fail := func(message string) (int, *response.Value) {
+		reply := response.NewError(message)
+		return 0, &reply
+	}
+
+	strategy := strings.ToUpper(args[i])
+	if t.strategy != "" && t.strategy != strategy {
+		return fail("syntax error, MAXLEN and MINID options at the same time are not compatible")
+	}
+	t.strategy = strategy
+	i++
+	if i < len(args) && (args[i] == "~" || args[i] == "=") {
+		t.approx = args[i] == "~"
+		i++
+	}
+	if i >= len(args) {
+		return fail(errSyntax)
+	}
+
+	if strategy == "MAXLEN" {
+		var ok bool
+		if t.maxLen, ok = parseInt(args[i]); !ok {
+			return fail(errNotInteger)
+		}
+		if t.maxLen < 0 {
+			return fail("The MAXLEN argument must be >= 0.")
+		}
+	} else {
+		var ok bool
+		if t.minID, ok = parseStreamID(args[i], 0); !ok {
+			return fail(errInvalidStreamID)
+		}
+	}
+	i++
+
+	if i+1 < len(args) && strings.ToUpper(args[i]) == "LIMIT" {
+		var ok bool
+		if t.limit, ok = parseInt(args[i+1]); !ok {
+			return fail(errNotInteger)
+		}
+		if t.limit < 0 {
+			return fail("The LIMIT argument must be >= 0.")
+		}
+		t.hasLimit = true
+		i += 2
+	}
+	if t.hasLimit && !t.approx {
+		return fail("syntax error, LIMIT cannot be used without the special ~ option")
+	}
+	return i, nil
+}
+
+// apply trims stream and returns how many entries were removed
+func (t *streamTrim) apply(stream *storage.Stream) int {
+	limit := 0
+	if t.approx {
+		limit = defaultTrimLimit
+		if t.hasLimit {
+			limit = int(min(t.limit, math.MaxInt32))
+		}
+	}
+
+	switch t.strategy {
+	case "MAXLEN":
+		return stream.TrimMaxLen(int(min(t.maxLen, math.MaxInt32)), t.approx, limit)
+	case "MINID":
+		return stream.TrimMinID(t.minID, t.approx, limit)
+	}
+	return 0
+}
+
+// XADD key [NOMKSTREAM] [MAXLEN | MINID [= | ~] threshold [LIMIT count]]
+// <* | id> field value [field value ...]
+func (h *CommandHandler) handleXAdd(client *client.Client, command *Command) response.Value {
+	args := command.Args
+	noMkStream, trim, i, errorResponse := parseXAddOptions(args)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	if i >= len(args) || (len(args)-i-1)%2 != 0 || len(args)-i-1 == 0 {
+		return wrongArgsCount(h.registry.Lookup("xadd"))
+	}
+
+	key := args[0]
+	stream, err := h.storage.LookupStream(key)
+	if err != nil {
+		return errorReply(err)
+	}
+	if stream == nil && noMkStream {
+		return response.NewNull()
+	}
+
+	lastID := storage.StreamID{}
+	if stream != nil {
+		lastID = stream.LastID
+	}
+	id, errorResponse := nextStreamID(lastID, args[i])
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	if stream, err = h.storage.LookupOrCreateStream(key); err != nil {
+		return errorReply(err)
+	}
+	stream.Add(id, append([]string{}, args[i+1:]...))
+	trim.apply(stream)
+	h.signalKeyAsReady(key)
+	return response.NewBulkString(id.String())
+}
+
+// parseXAddOptions reads the options before the ID of XADD and returns
+// the index of the ID
+func parseXAddOptions(args []string) (bool, streamTrim, int, *response.Value) {
+	noMkStream := false
+	trim := streamTrim{}
+	i := 1
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NOMKSTREAM":
+			noMkStream = true
+		case "MAXLEN", "MINID":
+			next, errorResponse := trim.parse(args, i)
+			if errorResponse != nil {
+				return false, streamTrim{}, 0, errorResponse
+			}
+			i = next - 1
+		default:
+			return noMkStream, trim, i, nil
+		}
+	}
+	return noMkStream, trim, i, nil
+}
+
+// nextStreamID resolves the ID given to XADD, "*" and "ms-*" are filled
+// in from the clock and the last ID of the stream
+func nextStreamID(lastID storage.StreamID, arg string) (storage.StreamID, *response.Value) {
+	fail := func(message string) (storage.StreamID, *response.Value) {
+		reply := response.NewError(message)
+		return storage.StreamID{}, &reply
+	}
+
+	if lastID == storage.MaxStreamID {
+		return fail("The stream has exhausted the last possible ID, unable to add more items")
+	}
+
+	if arg == "*" {
+		now := uint64(time.Now().UnixMilli())
+		if now > lastID.Ms {
+			return storage.StreamID{Ms: now}, nil
+		}
+		id, _ := lastID.Next()
+		return id, nil
+	}
+
+	if msArg, ok := strings.CutSuffix(arg, "-*"); ok {
+		ms, err := strconv.ParseUint(msArg, 10, 64)
+		if err != nil {
+			return fail(errInvalidStreamID)
+		}
+		switch {
+		case ms > lastID.Ms:
+			return storage.StreamID{Ms: ms}, nil
+		case ms < lastID.Ms || lastID.Seq == math.MaxUint64:
+			return fail(errXAddIDTooSmall)
+		}
+		return storage.StreamID{Ms: ms, Seq: lastID.Seq + 1}, nil
+	}
+
+	id, ok := parseStreamID(arg, 0)
+	if !ok {
+		return fail(errInvalidStreamID)
+	}
+	if id.IsZero() {
+		return fail("The ID specified in XADD must be greater than 0-0")
+	}
+	if !lastID.Less(id) {
+		return fail(errXAddIDTooSmall)
+	}
+	return id, nil
+}
+
+func (h *CommandHandler) handleXLen(client *client.Client, command *Command) response.Value {
+	stream, err := h.storage.LookupStream(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if stream == nil {
+		return response.NewInteger(0)
+	}
+	return response.NewInteger(int64(stream.Len()))
+}
+
+// XRANGE key start end [COUNT count]
+func (h *CommandHandler) handleXRange(client *client.Client, command *Command) response.Value {
+	return h.xrangeGeneric(command, command.Args[1], command.Args[2], false)
+}
+
+// XREVRANGE key end start [COUNT count]
+func (h *CommandHandler) handleXRevRange(client *client.Client, command *Command) response.Value {
+	return h.xrangeGeneric(command, command.Args[2], command.Args[1], true)
+}
+
+func (h *CommandHandler) xrangeGeneric(command *Command, startArg, endArg string, reverse bool) response.Value {
+	start, errorResponse := parseRangeStreamID(startArg, true)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+	end, errorResponse := parseRangeStreamID(endArg, false)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	count := int64(0)
+	switch {
+	case len(command.Args) == 3:
+	case len(command.Args) == 5 && strings.ToUpper(command.Args[3]) == "COUNT":
+		var ok bool
+		if count, ok = parseInt(command.Args[4]); !ok {
+			return response.NewError(errNotInteger)
+		}
+		// COUNT 0 or less is an empty range and not an unlimited one
+		if count <= 0 {
+			return response.NewArray()
+		}
+	default:
+		return response.NewError(errSyntax)
+	}
+
+	stream, err := h.storage.LookupStream(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if stream == nil {
+		return response.NewArray()
+	}
+	return entriesReply(stream.Range(start, end, reverse, int(min(count, math.MaxInt32))))
+}
+
+func (h *CommandHandler) handleXDel(client *client.Client, command *Command) response.Value {
+	ids := make([]storage.StreamID, 0, len(command.Args)-1)
+	for _, arg := range command.Args[1:] {
+		id, ok := parseStreamID(arg, 0)
+		if !ok {
+			return response.NewError(errInvalidStreamID)
+		}
+		ids = append(ids, id)
+	}
+
+	stream, err := h.storage.LookupStream(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if stream == nil {
+		return response.NewInteger(0)
+	}
+
+	deleted := 0
+	for _, id := range ids {
+		if stream.Delete(id) {
+			deleted++
+		}
+	}
+	return response.NewInteger(int64(deleted))
+}
+
+// XTRIM key MAXLEN | MINID [= | ~] threshold [LIMIT count]
+func (h *CommandHandler) handleXTrim(client *client.Client, command *Command) response.Value {
+	strategy := strings.ToUpper(command.Args[1])
+	if strategy != "MAXLEN" && strategy != "MINID" {
+		return response.NewError(errSyntax)
+	}
+	trim := streamTrim{}
+	next, errorResponse := trim.parse(command.Args, 1)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+	if next != len(command.Args) {
+		return response.NewError(errSyntax)
+	}
+
+	stream, err := h.storage.LookupStream(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if stream == nil {
+		return response.NewInteger(0)
+	}
+	return response.NewInteger(int64(trim.apply(stream)))
+}
+
+// streamsArgs are the arguments XREAD and XREADGROUP share
+type streamsArgs struct {
+	count   int64
+	block   time.Duration
+	blocked bool
+	noAck   bool
+	keys    []string
+	ids     []string
+}
+
+// parseStreamsArgs parses [COUNT count] [BLOCK milliseconds] [NOACK]
+// STREAMS key [key ...] id [id ...], NOACK only for XREADGROUP
+func parseStreamsArgs(name string, args []string, group bool) (streamsArgs, *response.Value) {
+	fail := func(message string) (streamsArgs, *response.Value) {
+		reply := response.NewError(message)
+		return streamsArgs{}, &reply
+	}
+
+	parsed := streamsArgs{}
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(args[i])
+		switch {
+		case option == "STREAMS":
+			rest := args[i+1:]
+			if len(rest) == 0 || len(rest)%2 != 0 {
+				return fail(fmt.Sprintf("Unbalanced '%s' list of streams: for each stream key an ID or '$' must be specified.", name))
+			}
+			parsed.keys, parsed.ids = rest[:len(rest)/2], rest[len(rest)/2:]
+			return parsed, nil
+		case option == "COUNT" && i+1 < len(args):
+			var ok bool
+			if parsed.count, ok = parseInt(args[i+1]); !ok {
+				return fail(errNotInteger)
+			}
+			i++
+		case option == "BLOCK" && i+1 < len(args):
+			ms, ok := parseInt(args[i+1])
+			if !ok {
+				return fail("timeout is not an integer or out of range")
+			}
+			if ms < 0 {
+				return fail("timeout is negative")
+			}
+			parsed.block = time.Duration(min(ms, math.MaxInt64/int64(time.Millisecond))) * time.Millisecond
+			parsed.blocked = true
+			i++
+		case option == "NOACK" && group:
+			parsed.noAck = true
+		default:
+			return fail(errSyntax)
+		}
+	}
+	return fail(errSyntax)
+}
+
+// XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+func (h *CommandHandler) handleXRead(client *client.Client, command *Command) response.Value {
+	args, errorResponse := parseStreamsArgs("xread", command.Args, false)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	// the IDs are resolved once, "$" keeps meaning the last ID before the
+	// command even when it blocks
+	after := make([]storage.StreamID, len(args.keys))
+	for i, key := range args.keys {
+		stream, err := h.storage.LookupStream(key)
+		if err != nil {
+			return errorReply(err)
+		}
+
+		switch arg := args.ids[i]; arg {
+		case "$":
+			if stream != nil {
+				after[i] = stream.LastID
+			}
+		case "+":
+			// the last entry itself is read
+			if stream != nil {
+				after[i] = stream.LastID
+				if last, ok := stream.Last(); ok {
+					after[i], _ = last.ID.Prev()
+				}
+			}
+		case ">":
+			return response.NewError("The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option.")
+		default:
+			id, ok := parseStreamID(arg, 0)
+			if !ok {
+				return response.NewError(errInvalidStreamID)
+			}
+			after[i] = id
+		}
+	}
+
+	count := int(max(min(args.count, math.MaxInt32), 0))
+	read := func(i int) ([]storage.StreamEntry, error) {
+		stream, err := h.storage.LookupStream(args.keys[i])
+		if err != nil || stream == nil {
+			return nil, err
+		}
+		start, ok := after[i].Next()
+		if !ok {
+			return nil, nil
+		}
+		return stream.Range(start, storage.MaxStreamID, false, count), nil
+	}
+
+	pairs := []response.Value{}
+	for i, key := range args.keys {
+		entries, err := read(i)
+		if err != nil {
+			return errorReply(err)
+		}
+		if len(entries) > 0 {
+			pairs = append(pairs, response.NewBulkString(key), entriesReply(entries))
+		}
+	}
+	if len(pairs) > 0 {
+		return streamsReply(client, pairs)
+	}
+	if !args.blocked {
+		return response.NewNullArray()
+	}
+
+	return h.block(client, &blockedClient{
+		keys:    args.keys,
+		timeout: args.block,
+		serve: func(key string) (response.Value, bool) {
+			for i := range args.keys {
+				if args.keys[i] != key {
+					continue
+				}
+				entries, err := read(i)
+				if err != nil || len(entries) == 0 {
+					return response.Value{}, false
+				}
+				return streamsReply(client, []response.Value{response.NewBulkString(key), entriesReply(entries)}), true
+			}
+			return response.Value{}, false
+		},
+		timeoutReply: response.NewNullArray(),
+	})
+}
+
+// XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds]
+// [NOACK] STREAMS key [key ...] id [id ...]
+func (h *CommandHandler) handleXReadGroup(client *client.Client, command *Command) response.Value {
+	if strings.ToUpper(command.Args[0]) != "GROUP" {
+		return response.NewError("Missing GROUP option for XREADGROUP")
+	}
+	groupName, consumerName := command.Args[1], command.Args[2]
+	args, errorResponse := parseStreamsArgs("xreadgroup", command.Args[3:], true)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	// every group has to exist before anything is read
+	history := false
+	after := make([]storage.StreamID, len(args.keys))
+	for i, key := range args.keys {
+		stream, err := h.storage.LookupStream(key)
+		if err != nil {
+			return errorReply(err)
+		}
+		if stream == nil || stream.Groups[groupName] == nil {
+			return response.NewErrorCode("NOGROUP", fmt.Sprintf("No such key '%s' or consumer group '%s' in XREADGROUP with GROUP option", key, groupName))
+		}
+
+		switch arg := args.ids[i]; arg {
+		case ">":
+			continue
+		case "$":
+			return response.NewError("The $ ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set.")
+		default:
+			id, ok := parseStreamID(arg, 0)
+			if !ok {
+				return response.NewError(errInvalidStreamID)
+			}
+			after[i] = id
+			history = true
+		}
+	}
+
+	count := int(max(min(args.count, math.MaxInt32), 0))
+	// read serves key i, the bool is false when it has nothing new for the
+	// consumer
+	read := func(i int) (response.Value, bool) {
+		stream, _ := h.storage.LookupStream(args.keys[i])
+		if stream == nil || stream.Groups[groupName] == nil {
+			return response.Value{}, false
+		}
+		group := stream.Groups[groupName]
+		now := time.Now().UnixMilli()
+		consumer, _ := group.Consumer(consumerName, true, now)
+		consumer.SeenTime = now
+
+		if args.ids[i] != ">" {
+			return consumerHistory(stream, group, consumer, after[i], count), true
+		}
+
+		start, ok := group.LastID.Next()
+		if !ok {
+			return response.Value{}, false
+		}
+		entries := stream.Range(start, storage.MaxStreamID, false, count)
+		if len(entries) == 0 {
+			return response.Value{}, false
+		}
+		for _, entry := range entries {
+			stream.Deliver(group, entry.ID)
+			if !args.noAck {
+				group.AddPending(entry.ID, consumer, now)
+			}
+		}
+		consumer.ActiveTime = now
+		return entriesReply(entries), true
+	}
+
+	pairs := []response.Value{}
+	for i, key := range args.keys {
+		if entries, ok := read(i); ok {
+			pairs = append(pairs, response.NewBulkString(key), entries)
+		}
+	}
+	if len(pairs) > 0 {
+		return streamsReply(client, pairs)
+	}
+	if !args.blocked || history {
+		return response.NewNullArray()
+	}
+
+	return h.block(client, &blockedClient{
+		keys:    args.keys,
+		timeout: args.block,
+		serve: func(key string) (response.Value, bool) {
+			for i := range args.keys {
+				if args.keys[i] != key {
+					continue
+				}
+				entries, ok := read(i)
+				if !ok {
+					return response.Value{}, false
+				}
+				return streamsReply(client, []response.Value{response.NewBulkString(key), entries}), true
+			}
+			return response.Value{}, false
+		},
+		timeoutReply: response.NewNullArray(),
+		command: func(key string) *Command {
+			read := []string{"GROUP", groupName, consumerName}
+			if args.count > 0 {
+				read = append(read, "COUNT", strconv.FormatInt(args.count, 10))
+			}
+			if args.noAck {
+				read = append(read, "NOACK")
+			}
+			return newCommand("XREADGROUP", append(read, "STREAMS", key, ">")...)
+		},
+	})
+}
+
+// consumerHistory replies with the entries pending for consumer after the
+// given ID, deleted entries come with a nil body
+func consumerHistory(stream *storage.Stream, group *storage.ConsumerGroup, consumer *storage.Consumer, after storage.StreamID, count int) response.Value {
+	start, ok := after.Next()
+	if !ok {
+		return response.NewArray()
+	}
+
+	reply := []response.Value{}
+	for _, pending := range group.PendingRange(start, storage.MaxStreamID, count, consumer) {
+		if entry, ok := stream.Get(pending.ID); ok {
+			reply = append(reply, entryReply(entry))
+			continue
+		}
+		reply = append(reply, response.NewArray(response.NewBulkString(pending.ID.String()), response.NewNullArray()))
+	}
+	return response.NewArray(reply...)
+}
+
+// XACK key group id [id ...]
+func (h *CommandHandler) handleXAck(client *client.Client, command *Command) response.Value {
+	ids := make([]storage.StreamID, 0, len(command.Args)-2)
+	for _, arg := range command.Args[2:] {
+		id, ok := parseStreamID(arg, 0)
+		if !ok {
+			return response.NewError(errInvalidStreamID)
+		}
+		ids = append(ids, id)
+	}
+
+	stream, err := h.storage.LookupStream(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if stream == nil || stream.Groups[command.Args[1]] == nil {
+		return response.NewInteger(0)
+	}
+
+	group := stream.Groups[command.Args[1]]
+	acked := 0
+	for _, id := range ids {
+		if group.Ack(id) {
+			acked++
+		}
+	}
+	return response.NewInteger(int64(acked))
+}
+
+// XPENDING key group [[IDLE min-idle-time] start end count [consumer]]
+func (h *CommandHandler) handleXPending(client *client.Client, command *Command) response.Value {
+	args := command.Args[2:]
+	minIdle := int64(0)
+	if len(args) > 0 && strings.ToUpper(args[0]) == "IDLE" {
+		if len(args) < 2 {
+			return response.NewError(errSyntax)
+		}
+		var ok bool
+		if minIdle, ok = parseInt(args[1]); !ok {
+			return response.NewError(errNotInteger)
+		}
+		args = args[2:]
+		if len(args) == 0 {
+			return response.NewError(errSyntax)
+		}
+	}
+	if len(args) != 0 && len(args) != 3 && len(args) != 4 {
+		return response.NewError(errSyntax)
+	}
+
+	var start, end storage.StreamID
+	var count int64
+	if len(args) > 0 {
+		var errorResponse *response.Value
+		if start, errorResponse = parseRangeStreamID(args[0], true); errorResponse != nil {
+			return *errorResponse
+		}
+		if end, errorResponse = parseRangeStreamID(args[1], false); errorResponse != nil {
+			return *errorResponse
+		}
+		var ok bool
+		if count, ok = parseInt(args[2]); !ok {
+			return response.NewError(errNotInteger)
+		}
+	}
+
+	group, errorResponse := h.lookupGroup(command.Args[0], command.Args[1])
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	if len(args) == 0 {
+		return pendingSummary(group)
+	}
+	if count <= 0 {
+		return response.NewArray()
+	}
+
+	var consumer *storage.Consumer
+	if len(args) == 4 {
+		if consumer = group.Consumers[args[3]]; consumer == nil {
+			return response.NewArray()
+		}
+	}
+
+	now := time.Now().UnixMilli()
+	reply := []response.Value{}
+	for _, pending := range group.PendingRange(start, end, 0, consumer) {
+		if len(reply) >= int(min(count, math.MaxInt32)) {
+			break
+		}
+		idle := now - pending.DeliveryTime
+		if idle < minIdle {
+			continue
+		}
+		reply = append(reply, response.NewArray(
+			response.NewBulkString(pending.ID.String()),
+			response.NewBulkString(pending.Consumer.Name),
+			response.NewInteger(idle),
+			response.NewInteger(pending.DeliveryCount),
+		))
+	}
+	return response.NewArray(reply...)
+}
+
+// pendingSummary is the short form of XPENDING, how many entries are
+// pending, the lowest and highest of them and how many every consumer has
+func pendingSummary(group *storage.ConsumerGroup) response.Value {
+	if group.PendingLen() == 0 {
+		return response.NewArray(response.NewInteger(0), response.NewNull(), response.NewNull(), response.NewNullArray())
+	}
+
+	pending := group.PendingRange(storage.StreamID{}, storage.MaxStreamID, 0, nil)
+	consumers := []response.Value{}
+	for _, consumer := range sortedConsumers(group) {
+		if consumer.Pending > 0 {
+			consumers = append(consumers, response.NewArray(
+				response.NewBulkString(consumer.Name),
+				response.NewBulkString(strconv.Itoa(consumer.Pending)),
+			))
+		}
+	}
+	return response.NewArray(
+		response.NewInteger(int64(len(pending))),
+		response.NewBulkString(pending[0].ID.String()),
+		response.NewBulkString(pending[len(pending)-1].ID.String()),
+		response.NewArray(consumers...),
+	)
+}
+
+// XCLAIM key group consumer min-idle-time id [id ...] [IDLE ms]
+// [TIME unix-time-milliseconds] [RETRYCOUNT count] [FORCE] [JUSTID]
+// [LASTID lastid]
+func (h *CommandHandler) handleXClaim(client *client.Client, command *Command) response.Value {
+	minIdle, ok := parseInt(command.Args[3])
+	if !ok {
+		return response.NewError("Invalid min-idle-time argument for XCLAIM")
+	}
+	minIdle = max(minIdle, 0)
+
+	ids := []storage.StreamID{}
+	i := 4
+	for ; i < len(command.Args); i++ {
+		id, ok := parseStreamID(command.Args[i], 0)
+		if !ok {
+			break
+		}
+		ids = append(ids, id)
+	}
+
+	now := time.Now().UnixMilli()
+	deliveryTime := now
+	retryCount := int64(-1)
+	force, justID := false, false
+	var lastID *storage.StreamID
+	for ; i < len(command.Args); i++ {
+		option := strings.ToUpper(command.Args[i])
+		hasValue := i+1 < len(command.Args)
+		switch {
+		case option == "FORCE":
+			force = true
+		case option == "JUSTID":
+			justID = true
+		case option == "IDLE" && hasValue:
+			idle, ok := parseInt(command.Args[i+1])
+			if !ok {
+				return response.NewError("Invalid IDLE option argument for XCLAIM")
+			}
+			deliveryTime = now - idle
+			i++
+		case option == "TIME" && hasValue:
+			at, ok := parseInt(command.Args[i+1])
+			if !ok {
+				return response.NewError("Invalid TIME option argument for XCLAIM")
+			}
+			deliveryTime = at
+			i++
+		case option == "RETRYCOUNT" && hasValue:
+			if retryCount, ok = parseInt(command.Args[i+1]); !ok {
+				return response.NewError("Invalid RETRYCOUNT option argument for XCLAIM")
+			}
+			i++
+		case option == "LASTID" && hasValue:
+			id, ok := parseStreamID(command.Args[i+1], 0)
+			if !ok {
+				return response.NewError(errInvalidStreamID)
+			}
+			lastID = &id
+			i++
+		default:
+			return response.NewError(fmt.Sprintf("Unrecognized XCLAIM option '%s'", command.Args[i]))
+		}
+	}
+	deliveryTime = max(min(deliveryTime, now), 0)
+
+	stream, group, errorResponse := h.lookupStreamGroup(command.Args[0], command.Args[1])
+	if errorResponse != nil {
+		return *errorResponse
+	}
+	if lastID != nil && group.LastID.Less(*lastID) {
+		group.LastID = *lastID
+	}
+
+	consumer, _ := group.Consumer(command.Args[2], true, now)
+	consumer.SeenTime = now
+	reply := []response.Value{}
+	for _, id := range ids {
+		entry, exists := stream.Get(id)
+		pending := group.Pending(id)
+		if pending == nil && force && exists {
+			pending = group.AddPending(id, consumer, now)
+		}
+		if pending == nil {
+			continue
+		}
+		// entries deleted meanwhile leave the PEL instead of being claimed
+		if !exists {
+			group.Ack(id)
+			continue
+		}
+		if minIdle > 0 && now-pending.DeliveryTime < minIdle {
+			continue
+		}
+
+		group.Claim(pending, consumer)
+		pending.DeliveryTime = deliveryTime
+		if retryCount >= 0 {
+			pending.DeliveryCount = retryCount
+		} else if !justID {
+			pending.DeliveryCount++
+		}
+		consumer.ActiveTime = now
+
+		if justID {
+			reply = append(reply, response.NewBulkString(id.String()))
+		} else {
+			reply = append(reply, entryReply(entry))
+		}
+	}
+	return response.NewArray(reply...)
+}
+
+// XAUTOCLAIM key group consumer min-idle-time start [COUNT count] [JUSTID]
+func (h *CommandHandler) handleXAutoClaim(client *client.Client, command *Command) response.Value {
+	minIdle, ok := parseInt(command.Args[3])
+	if !ok {
+		return response.NewError("Invalid min-idle-time argument for XAUTOCLAIM")
+	}
+	minIdle = max(minIdle, 0)
+	start, errorResponse := parseRangeStreamID(command.Args[4], true)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	count := int64(100)
+	justID := false
+	for i := 5; i < len(command.Args); i++ {
+		switch option := strings.ToUpper(command.Args[i]); {
+		case option == "JUSTID":
+			justID = true
+		case option == "COUNT" && i+1 < len(command.Args):
+			if count, ok = parseInt(command.Args[i+1]); !ok {
+				return response.NewError(errNotInteger)
+			}
+			if count < 1 || count > math.MaxInt32 {
+				return response.NewError("COUNT must be > 0")
+			}
+			i++
+		default:
+			return response.NewError(errSyntax)
+		}
+	}
+
+	stream, group, errorResponse := h.lookupStreamGroup(command.Args[0], command.Args[1])
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	now := time.Now().UnixMilli()
+	consumer, _ := group.Consumer(command.Args[2], true, now)
+	consumer.SeenTime = now
+
+	// like redis it looks at no more than 10 pending entries per claim
+	attempts := count * 10
+	claimed := []response.Value{}
+	deleted := []string{}
+	next := storage.StreamID{}
+	for _, pending := range group.PendingRange(start, storage.MaxStreamID, 0, nil) {
+		if attempts == 0 || int64(len(claimed)) >= count {
+			next = pending.ID
+			break
+		}
+		attempts--
+
+		entry, exists := stream.Get(pending.ID)
+		if !exists {
+			group.Ack(pending.ID)
+			deleted = append(deleted, pending.ID.String())
+			continue
+		}
+		if minIdle > 0 && now-pending.DeliveryTime < minIdle {
+			continue
+		}
+
+		group.Claim(pending, consumer)
+		pending.DeliveryTime = now
+		if !justID {
+			pending.DeliveryCount++
+		}
+		consumer.ActiveTime = now
+		if justID {
+			claimed = append(claimed, response.NewBulkString(pending.ID.String()))
+		} else {
+			claimed = append(claimed, entryReply(entry))
+		}
+	}
+
+	return response.NewArray(
+		response.NewBulkString(next.String()),
+		response.NewArray(claimed...),
+		response.NewBulkStringArray(deleted),
+	)
+}
+
+// XGROUP CREATE key group <id | $> [MKSTREAM] [ENTRIESREAD entries-read]
+func (h *CommandHandler) handleXGroupCreate(client *client.Client, command *Command) response.Value {
+	mkStream := false
+	entriesRead := int64(-1)
+	for i := 4; i < len(command.Args); i++ {
+		switch option := strings.ToUpper(command.Args[i]); {
+		case option == "MKSTREAM":
+			mkStream = true
+		case option == "ENTRIESREAD" && i+1 < len(command.Args):
+			var errorResponse *response.Value
+			if entriesRead, errorResponse = parseEntriesRead(command.Args[i+1]); errorResponse != nil {
+				return *errorResponse
+			}
+			i++
+		default:
+			return response.NewError(errSyntax)
+		}
+	}
+
+	key, name := command.Args[1], command.Args[2]
+	stream, err := h.storage.LookupStream(key)
+	if err != nil {
+		return errorReply(err)
+	}
+	if stream == nil && !mkStream {
+		return response.NewError(errXGroupNoKey)
+	}
+
+	lastID := storage.StreamID{}
+	if stream != nil {
+		lastID = stream.LastID
+	}
+	id, errorResponse := parseGroupID(command.Args[3], lastID)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	if stream == nil {
+		if stream, err = h.storage.LookupOrCreateStream(key); err != nil {
+			return errorReply(err)
+		}
+	}
+	if !stream.CreateGroup(name, id, entriesRead) {
+		return response.NewErrorCode("BUSYGROUP", "Consumer Group name already exists")
+	}
+	return response.NewOK()
+}
+
+// XGROUP SETID key group <id | $> [ENTRIESREAD entries-read]
+func (h *CommandHandler) handleXGroupSetID(client *client.Client, command *Command) response.Value {
+	entriesRead := int64(-1)
+	switch {
+	case len(command.Args) == 4:
+	case len(command.Args) == 6 && strings.ToUpper(command.Args[4]) == "ENTRIESREAD":
+		var errorResponse *response.Value
+		if entriesRead, errorResponse = parseEntriesRead(command.Args[5]); errorResponse != nil {
+			return *errorResponse
+		}
+	default:
+		return response.NewError(errSyntax)
+	}
+
+	stream, group, errorResponse := h.lookupXGroup(command.Args[1], command.Args[2])
+	if errorResponse != nil {
+		return *errorResponse
+	}
+	id, errorResponse := parseGroupID(command.Args[3], stream.LastID)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+	group.LastID = id
+	group.EntriesRead = entriesRead
+	return response.NewOK()
+}
+
+// XGROUP DESTROY key group
+func (h *CommandHandler) handleXGroupDestroy(client *client.Client, command *Command) response.Value {
+	stream, err := h.storage.LookupStream(command.Args[1])
+	if err != nil {
+		return errorReply(err)
+	}
+	if stream == nil {
+		return response.NewError(errXGroupNoKey)
+	}
+	if stream.Groups[command.Args[2]] == nil {
+		return response.NewInteger(0)
+	}
+	delete(stream.Groups, command.Args[2])
+	return response.NewInteger(1)
+}
+
+// XGROUP CREATECONSUMER key group consumer
+func (h *CommandHandler) handleXGroupCreateConsumer(client *client.Client, command *Command) response.Value {
+	_, group, errorResponse := h.lookupXGroup(command.Args[1], command.Args[2])
+	if errorResponse != nil {
+		return *errorResponse
+	}
+	if _, created := group.Consumer(command.Args[3], true, time.Now().UnixMilli()); !created {
+		return response.NewInteger(0)
+	}
+	return response.NewInteger(1)
+}
+
+// XGROUP DELCONSUMER key group consumer
+func (h *CommandHandler) handleXGroupDelConsumer(client *client.Client, command *Command) response.Value {
+	_, group, errorResponse := h.lookupXGroup(command.Args[1], command.Args[2])
+	if errorResponse != nil {
+		return *errorResponse
+	}
+	return response.NewInteger(int64(group.DeleteConsumer(command.Args[3])))
+}
+
+func (h *CommandHandler) handleXGroupHelp(client *client.Client, command *Command) response.Value {
+	return helpReply("XGROUP",
+		"CREATE <key> <groupname> <id|$> [option]",
+		"    Create a new consumer group. Options are:",
+		"    * MKSTREAM",
+		"      Create the empty stream if it does not exist.",
+		"    * ENTRIESREAD entries_read",
+		"      Set the group's entries_read counter (internal use).",
+		"CREATECONSUMER <key> <groupname> <consumer>",
+		"    Create a new consumer in the specified group.",
+		"DELCONSUMER <key> <groupname> <consumer>",
+		"    Remove the specified consumer.",
+		"DESTROY <key> <groupname>",
+		"    Remove the specified group.",
+		"SETID <key> <groupname> <id|$> [ENTRIESREAD entries_read]",
+		"    Set the current group ID and entries_read counter.",
+	)
+}
+
+// XINFO STREAM key [FULL [COUNT count]]
+func (h *CommandHandler) handleXInfoStream(client *client.Client, command *Command) response.Value {
+	full := false
+	count := int64(10)
+	switch args := command.Args[2:]; {
+	case len(args) == 0:
+	case len(args) == 1 && strings.ToUpper(args[0]) == "FULL":
+		full = true
+	case len(args) == 3 && strings.ToUpper(args[0]) == "FULL" && strings.ToUpper(args[1]) == "COUNT":
+		var ok bool
+		if count, ok = parseInt(args[2]); !ok {
+			return response.NewError(errNotInteger)
+		}
+		full = true
+	default:
+		return response.NewError(errSyntax)
+	}
+
+	stream, errorResponse := h.lookupXInfoStream(command.Args[1])
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	firstID := storage.StreamID{}
+	if first, ok := stream.First(); ok {
+		firstID = first.ID
+	}
+	reply := []response.Value{
+		response.NewBulkString("length"), response.NewInteger(int64(stream.Len())),
+		response.NewBulkString("radix-tree-keys"), response.NewInteger(int64(stream.Nodes())),
+		response.NewBulkString("radix-tree-nodes"), response.NewInteger(int64(stream.Nodes())),
+		response.NewBulkString("last-generated-id"), response.NewBulkString(stream.LastID.String()),
+		response.NewBulkString("max-deleted-entry-id"), response.NewBulkString(stream.MaxDeletedID.String()),
+		response.NewBulkString("entries-added"), response.NewInteger(int64(stream.EntriesAdded)),
+		response.NewBulkString("recorded-first-entry-id"), response.NewBulkString(firstID.String()),
+	}
+
+	if !full {
+		reply = append(reply,
+			response.NewBulkString("groups"), response.NewInteger(int64(len(stream.Groups))),
+			response.NewBulkString("first-entry"), edgeEntryReply(stream.First()),
+			response.NewBulkString("last-entry"), edgeEntryReply(stream.Last()),
+		)
+		return response.NewMap(reply...)
+	}
+
+	limit := int(min(max(count, 0), math.MaxInt32))
+	groups := []response.Value{}
+	for _, group := range sortedGroups(stream) {
+		groups = append(groups, fullGroupReply(stream, group, limit))
+	}
+	reply = append(reply,
+		response.NewBulkString("entries"), entriesReply(stream.Range(storage.StreamID{}, storage.MaxStreamID, false, limit)),
+		response.NewBulkString("groups"), response.NewArray(groups...),
+	)
+	return response.NewMap(reply...)
+}
+
+// fullGroupReply describes a group for XINFO STREAM FULL, listing at most
+// limit pending entries unless it is 0
+func fullGroupReply(stream *storage.Stream, group *storage.ConsumerGroup, limit int) response.Value {
+	pending := []response.Value{}
+	for _, entry := range group.PendingRange(storage.StreamID{}, storage.MaxStreamID, limit, nil) {
+		pending = append(pending, response.NewArray(
+			response.NewBulkString(entry.ID.String()),
+			response.NewBulkString(entry.Consumer.Name),
+			response.NewInteger(entry.DeliveryTime),
+			response.NewInteger(entry.DeliveryCount),
+		))
+	}
+
+	consumers := []response.Value{}
+	for _, consumer := range sortedConsumers(group) {
+		owned := []response.Value{}
+		for _, entry := range group.PendingRange(storage.StreamID{}, storage.MaxStreamID, limit, consumer) {
+			owned = append(owned, response.NewArray(
+				response.NewBulkString(entry.ID.String()),
+				response.NewInteger(entry.DeliveryTime),
+				response.NewInteger(entry.DeliveryCount),
+			))
+		}
+		consumers = append(consumers, response.NewMap(
+			response.NewBulkString("name"), response.NewBulkString(consumer.Name),
+			response.NewBulkString("seen-time"), response.NewInteger(consumer.SeenTime),
+			response.NewBulkString("active-time"), response.NewInteger(consumer.ActiveTime),
+			response.NewBulkString("pel-count"), response.NewInteger(int64(consumer.Pending)),
+			response.NewBulkString("pending"), response.NewArray(owned...),
+		))
+	}
+
+	return response.NewMap(
+		response.NewBulkString("name"), response.NewBulkString(group.Name),
+		response.NewBulkString("last-delivered-id"), response.NewBulkString(group.LastID.String()),
+		response.NewBulkString("entries-read"), optionalCounter(group.EntriesRead),
+		response.NewBulkString("lag"), optionalCounter(stream.Lag(group)),
+		response.NewBulkString("pel-count"), response.NewInteger(int64(group.PendingLen())),
+		response.NewBulkString("pending"), response.NewArray(pending...),
+		response.NewBulkString("consumers"), response.NewArray(consumers...),
+	)
+}
+
+// XINFO GROUPS key
+func (h *CommandHandler) handleXInfoGroups(client *client.Client, command *Command) response.Value {
+	stream, errorResponse := h.lookupXInfoStream(command.Args[1])
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	groups := []response.Value{}
+	for _, group := range sortedGroups(stream) {
+		groups = append(groups, response.NewMap(
+			response.NewBulkString("name"), response.NewBulkString(group.Name),
+			response.NewBulkString("consumers"), response.NewInteger(int64(len(group.Consumers))),
+			response.NewBulkString("pending"), response.NewInteger(int64(group.PendingLen())),
+			response.NewBulkString("last-delivered-id"), response.NewBulkString(group.LastID.String()),
+			response.NewBulkString("entries-read"), optionalCounter(group.EntriesRead),
+			response.NewBulkString("lag"), optionalCounter(stream.Lag(group)),
+		))
+	}
+	return response.NewArray(groups...)
+}
+
+// XINFO CONSUMERS key group
+func (h *CommandHandler) handleXInfoConsumers(client *client.Client, command *Command) response.Value {
+	stream, errorResponse := h.lookupXInfoStream(command.Args[1])
+	if errorResponse != nil {
+		return *errorResponse
+	}
+	group := stream.Groups[command.Args[2]]
+	if group == nil {
+		return noGroupError(command.Args[1], command.Args[2])
+	}
+
+	now := time.Now().UnixMilli()
+	consumers := []response.Value{}
+	for _, consumer := range sortedConsumers(group) {
+		inactive := int64(-1)
+		if consumer.ActiveTime >= 0 {
+			inactive = now - consumer.ActiveTime
+		}
+		consumers = append(consumers, response.NewMap(
+			response.NewBulkString("name"), response.NewBulkString(consumer.Name),
+			response.NewBulkString("pending"), response.NewInteger(int64(consumer.Pending)),
+			response.NewBulkString("idle"), response.NewInteger(now-consumer.SeenTime),
+			response.NewBulkString("inactive"), response.NewInteger(inactive),
+		))
+	}
+	return response.NewArray(consumers...)
+}
+
+func (h *CommandHandler) handleXInfoHelp(client *client.Client, command *Command) response.Value {
+	return helpReply("XINFO",
+		"CONSUMERS <key> <groupname>",
+		"    Show consumers of <groupname>.",
+		"GROUPS <key>",
+		"    Show the stream consumer groups.",
+		"STREAM <key> [FULL [COUNT <count>]",
+		"    Show information about the stream.",
+	)
+}
+
+func (h *CommandHandler) lookupXInfoStream(key string) (*storage.Stream, *response.Value) {
+	stream, err := h.storage.LookupStream(key)
+	if err != nil {
+		reply := errorReply(err)
+		return nil, &reply
+	}
+	if stream == nil {
+		reply := response.NewError("no such key")
+		return nil, &reply
+	}
+	return stream, nil
+}
+
+// lookupXGroup finds the group for the XGROUP subcommands, which report
+// a missing key on their own
+func (h *CommandHandler) lookupXGroup(key, name string) (*storage.Stream, *storage.ConsumerGroup, *response.Value) {
+	stream, err := h.storage.LookupStream(key)
+	if err != nil {
+		reply := errorReply(err)
+		return nil, nil, &reply
+	}
+	if stream == nil {
+		reply := response.NewError(errXGroupNoKey)
+		return nil, nil, &reply
+	}
+	group := stream.Groups[name]
+	if group == nil {
+		reply := noGroupError(key, name)
+		return nil, nil, &reply
+	}
+	return stream, group, nil
+}
+
+// lookupStreamGroup finds the group for XPENDING and the claims, a
+// missing key is a missing group for them
+func (h *CommandHandler) lookupStreamGroup(key, name string) (*storage.Stream, *storage.ConsumerGroup, *response.Value) {
+	stream, err := h.storage.LookupStream(key)
+	if err != nil {
+		reply := errorReply(err)
+		return nil, nil, &reply
+	}
+	if stream == nil || stream.Groups[name] == nil {
+		reply := response.NewErrorCode("NOGROUP", fmt.Sprintf("No such key '%s' or consumer group '%s'", key, name))
+		return nil, nil, &reply
+	}
+	return stream, stream.Groups[name], nil
+}
+
+func (h *CommandHandler) lookupGroup(key, name string) (*storage.ConsumerGroup, *response.Value) {
+	_, group, errorResponse := h.lookupStreamGroup(key, name)
+	return group, errorResponse
+}
+
+func noGroupError(key, name string) response.Value {
+	return response.NewErrorCode("NOGROUP", fmt.Sprintf("No such consumer group '%s' for key name '%s'", name, key))
+}
+
+func sortedGroups(stream *storage.Stream) []*storage.ConsumerGroup {
+	groups := make([]*storage.ConsumerGroup, 0, len(stream.Groups))
+	for _, group := range stream.Groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+func sortedConsumers(group *storage.ConsumerGroup) []*storage.Consumer {
+	consumers := make([]*storage.Consumer, 0, len(group.Consumers))
+	for _, consumer := range group.Consumers {
+		consumers = append(consumers, consumer)
+	}
+	sort.Slice(consumers, func(i, j int) bool { return consumers[i].Name < consumers[j].Name })
+	return consumers
+}
+
+// optionalCounter is nil for the counters of groups that are unknown
+func optionalCounter(value int64) response.Value {
+	if value < 0 {
+		return response.NewNull()
+	}
+	return response.NewInteger(value)
+}
+
+func entryReply(entry storage.StreamEntry) response.Value {
+	return response.NewArray(response.NewBulkString(entry.ID.String()), response.NewBulkStringArray(entry.Fields))
+}
+
+func entriesReply(entries []storage.StreamEntry) response.Value {
+	reply := make([]response.Value, 0, len(entries))
+	for _, entry := range entries {
+		reply = append(reply, entryReply(entry))
+	}
+	return response.NewArray(reply...)
+}
+
+// edgeEntryReply is the first or last entry for XINFO STREAM, nil when
+// the stream is empty
+func edgeEntryReply(entry storage.StreamEntry, ok bool) response.Value {
+	if !ok {
+		return response.NewNull()
+	}
+	return entryReply(entry)
+}
+
+// streamsReply is the reply of XREAD and XREADGROUP from key and entries
+// pairs, a map in RESP3 and an array of pairs in RESP2
+func streamsReply(client *client.Client, pairs []response.Value) response.Value {
+	if client.Protocol == response.ProtocolRESP3 {
+		return response.NewMap(pairs...)
+	}
+	reply := make([]response.Value, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		reply = append(reply, response.NewArray(pairs[i], pairs[i+1]))
+	}
+	return response.NewArray(reply...)
+}
+
+// parseStreamID parses ms-seq, missingSeq is used when only ms is given
+func parseStreamID(arg string, missingSeq uint64) (storage.StreamID, bool) {
+	msArg, seqArg, hasSeq := strings.Cut(arg, "-")
+	ms, err := strconv.ParseUint(msArg, 10, 64)
+	if err != nil {
+		return storage.StreamID{}, false
+	}
+	if !hasSeq {
+		return storage.StreamID{Ms: ms, Seq: missingSeq}, true
+	}
+	seq, err := strconv.ParseUint(seqArg, 10, 64)
+	if err != nil {
+		return storage.StreamID{}, false
+	}
+	return storage.StreamID{Ms: ms, Seq: seq}, true
+}
+
+// parseRangeStreamID parses a bound of XRANGE, "-" and "+" are the
+// smallest and the largest ID and a leading "(" excludes the ID
+func parseRangeStreamID(arg string, isStart bool) (storage.StreamID, *response.Value) {
+	fail := func(message string) (storage.StreamID, *response.Value) {
+		reply := response.NewError(message)
+		return storage.StreamID{}, &reply
+	}
+
+	switch arg {
+	case "-":
+		return storage.StreamID{}, nil
+	case "+":
+		return storage.MaxStreamID, nil
+	}
+
+	// the sequence of an incomplete start is 0 and the one of an end the
+	// highest
+	missingSeq := uint64(0)
+	if !isStart {
+		missingSeq = math.MaxUint64
+	}
+	exclusive := strings.HasPrefix(arg, "(")
+	id, ok := parseStreamID(strings.TrimPrefix(arg, "("), missingSeq)
+	if !ok {
+		return fail(errInvalidStreamID)
+	}
+	if !exclusive {
+		return id, nil
+	}
+
+	if isStart {
+		if id, ok = id.Next(); !ok {
+			return fail("invalid start ID for the interval")
+		}
+		return id, nil
+	}
+	if id, ok = id.Prev(); !ok {
+		return fail("invalid end ID for the interval")
+	}
+	return id, nil
+}
+
+// parseGroupID parses the last delivered ID given to XGROUP, "$" is the
+// last ID of the stream
+func parseGroupID(arg string, lastID storage.StreamID) (storage.StreamID, *response.Value) {
+	if arg == "$" {
+		return lastID, nil
+	}
+	id, ok := parseStreamID(arg, 0)
+	if !ok {
+		reply := response.NewError(errInvalidStreamID)
+		return storage.StreamID{}, &reply
+	}
+	return id, nil
+}
+
+func parseEntriesRead(arg string) (int64, *response.Value) {
+	entriesRead, ok := parseInt(arg)
+	if !ok {
+		reply := response.NewError(errNotInteger)
+		return 0, &reply
+	}
+	if entriesRead < -1 {
+		reply := response.NewError("value for ENTRIESREAD must be positive or -1")
+		return 0, &reply
+	}
+	return entriesRead, nil
+}
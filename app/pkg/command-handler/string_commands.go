@@ -0,0 +1,474 @@
+package commandhandler
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/response"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/storage"
+)
+
+// same as proto-max-bulk-len, no string can grow past it
+const (
+	maxStringLength  = 512 * 1024 * 1024
+	errStringTooLong = "string exceeds maximum allowed size (proto-max-bulk-len)"
+)
+
+// setOptions is the parsed SET grammar, ExpireAt is a unix time in
+// milliseconds and only used when HasExpire is set
+type setOptions struct {
+	NX        bool
+	XX        bool
+	Get       bool
+	KeepTTL   bool
+	Persist   bool
+	HasExpire bool
+	ExpireAt  int64
+}
+
+func (h *CommandHandler) handleGet(client *client.Client, command *Command) response.Value {
+	value, err := h.Get(command.Args[0])
+	if errors.Is(err, storage.ErrKeyNotFound) || errors.Is(err, storage.ErrKeyExpired) {
+		return response.NewNull()
+	}
+	if err != nil {
+		return errorReply(err)
+	}
+	return response.NewBulkString(value)
+}
+
+// SET key value [NX | XX] [GET] [EX seconds | PX milliseconds |
+// EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL]
+func (h *CommandHandler) handleSet(client *client.Client, command *Command) response.Value {
+	options, errorResponse := parseExpireOptions(command, command.Args[2:], true)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	return h.setGeneric(command.Args[0], command.Args[1], options)
+}
+
+func (h *CommandHandler) handleSetNX(client *client.Client, command *Command) response.Value {
+	reply := h.setGeneric(command.Args[0], command.Args[1], setOptions{NX: true})
+	if reply.Type == response.Null {
+		return response.NewInteger(0)
+	}
+	return response.NewInteger(1)
+}
+
+func (h *CommandHandler) handleSetEX(client *client.Client, command *Command) response.Value {
+	return h.setWithTTL(command, "EX")
+}
+
+func (h *CommandHandler) handlePSetEX(client *client.Client, command *Command) response.Value {
+	return h.setWithTTL(command, "PX")
+}
+
+// setWithTTL is SETEX and PSETEX, which are SET with an EX or PX option
+func (h *CommandHandler) setWithTTL(command *Command, ttlOption string) response.Value {
+	options, errorResponse := parseExpireOptions(command, []string{ttlOption, command.Args[1]}, true)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+	return h.setGeneric(command.Args[0], command.Args[2], options)
+}
+
+func (h *CommandHandler) handleGetSet(client *client.Client, command *Command) response.Value {
+	return h.setGeneric(command.Args[0], command.Args[1], setOptions{Get: true})
+}
+
+func (h *CommandHandler) handleGetDel(client *client.Client, command *Command) response.Value {
+	reply := h.handleGet(client, command)
+	if reply.Type == response.BulkString {
+		h.storage.Delete(command.Args[0])
+	}
+	return reply
+}
+
+// GETEX key [EX seconds | PX milliseconds | EXAT unix-time-seconds |
+// PXAT unix-time-milliseconds | PERSIST]
+func (h *CommandHandler) handleGetEX(client *client.Client, command *Command) response.Value {
+	options, errorResponse := parseExpireOptions(command, command.Args[1:], false)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	reply := h.handleGet(client, command)
+	if reply.Type != response.BulkString {
+		return reply
+	}
+
+	key := command.Args[0]
+	switch {
+	case options.HasExpire:
+		h.storage.SetExpireDate(key, options.ExpireAt)
+	case options.Persist:
+		h.storage.Persist(key)
+	}
+	return reply
+}
+
+// setGeneric overwrites whatever type the key holds, only GET needs the
+// old value to be a string
+func (h *CommandHandler) setGeneric(key, value string, options setOptions) response.Value {
+	exists := h.storage.Exists(key)
+
+	reply := response.NewOK()
+	if options.Get {
+		oldValue, err := h.Get(key)
+		if err != nil && !errors.Is(err, storage.ErrKeyNotFound) && !errors.Is(err, storage.ErrKeyExpired) {
+			return errorReply(err)
+		}
+		reply = response.NewNull()
+		if err == nil {
+			reply = response.NewBulkString(oldValue)
+		}
+	}
+
+	if (options.NX && exists) || (options.XX && !exists) {
+		if options.Get {
+			return reply
+		}
+		return response.NewNull()
+	}
+
+	var err error
+	if options.KeepTTL {
+		err = h.storage.SetKeepTTL(key, value)
+	} else {
+		err = h.Set(key, value, nil)
+	}
+	if err != nil {
+		return errorReply(err)
+	}
+	if options.HasExpire {
+		h.storage.SetExpireDate(key, options.ExpireAt)
+	}
+
+	return reply
+}
+
+// parseExpireOptions parses the options SET and GETEX share, errors are
+// returned as the reply to send
+func parseExpireOptions(command *Command, args []string, isSet bool) (setOptions, *response.Value) {
+	options := setOptions{}
+	fail := func(message string) (setOptions, *response.Value) {
+		reply := response.NewError(message)
+		return setOptions{}, &reply
+	}
+
+	now := time.Now().UnixMilli()
+	expireOptions := 0
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(args[i])
+
+		switch option {
+		case "NX", "XX", "GET":
+			if !isSet {
+				return fail(errSyntax)
+			}
+			options.NX = options.NX || option == "NX"
+			options.XX = options.XX || option == "XX"
+			options.Get = options.Get || option == "GET"
+		case "KEEPTTL":
+			if !isSet {
+				return fail(errSyntax)
+			}
+			options.KeepTTL = true
+			expireOptions++
+		case "PERSIST":
+			if isSet {
+				return fail(errSyntax)
+			}
+			options.Persist = true
+			expireOptions++
+		case "EX", "PX", "EXAT", "PXAT":
+			if i+1 >= len(args) {
+				return fail(errSyntax)
+			}
+			amount, ok := parseInt(args[i+1])
+			i++
+			if !ok {
+				return fail(errNotInteger)
+			}
+			if amount <= 0 {
+				return fail("invalid expire time in '" + strings.ToLower(command.Name) + "' command")
+			}
+
+			multiplier := int64(1)
+			if option == "EX" || option == "EXAT" {
+				multiplier = 1000
+			}
+			basetime := int64(0)
+			if option == "EX" || option == "PX" {
+				basetime = now
+			}
+			if amount > (math.MaxInt64-basetime)/multiplier {
+				return fail("invalid expire time in '" + strings.ToLower(command.Name) + "' command")
+			}
+
+			options.HasExpire = true
+			options.ExpireAt = basetime + amount*multiplier
+			expireOptions++
+		default:
+			return fail(errSyntax)
+		}
+	}
+
+	if (options.NX && options.XX) || expireOptions > 1 {
+		return fail(errSyntax)
+	}
+	return options, nil
+}
+
+func (h *CommandHandler) handleIncr(client *client.Client, command *Command) response.Value {
+	return h.incrBy(command.Args[0], 1)
+}
+
+func (h *CommandHandler) handleDecr(client *client.Client, command *Command) response.Value {
+	return h.incrBy(command.Args[0], -1)
+}
+
+func (h *CommandHandler) handleIncrBy(client *client.Client, command *Command) response.Value {
+	increment, ok := parseInt(command.Args[1])
+	if !ok {
+		return response.NewError(errNotInteger)
+	}
+	return h.incrBy(command.Args[0], increment)
+}
+
+func (h *CommandHandler) handleDecrBy(client *client.Client, command *Command) response.Value {
+	decrement, ok := parseInt(command.Args[1])
+	if !ok {
+		return response.NewError(errNotInteger)
+	}
+	if decrement == math.MinInt64 {
+		return response.NewError("decrement would overflow")
+	}
+	return h.incrBy(command.Args[0], -decrement)
+}
+
+func (h *CommandHandler) incrBy(key string, increment int64) response.Value {
+	value, errorResponse := h.getStringOrEmpty(key)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	current := int64(0)
+	if value != "" {
+		var ok bool
+		if current, ok = parseInt(value); !ok {
+			return response.NewError(errNotInteger)
+		}
+	}
+	if (increment < 0 && current < math.MinInt64-increment) || (increment > 0 && current > math.MaxInt64-increment) {
+		return response.NewError("increment or decrement would overflow")
+	}
+
+	current += increment
+	if err := h.storage.SetKeepTTL(key, strconv.FormatInt(current, 10)); err != nil {
+		return errorReply(err)
+	}
+	return response.NewInteger(current)
+}
+
+func (h *CommandHandler) handleIncrByFloat(client *client.Client, command *Command) response.Value {
+	key := command.Args[0]
+	increment, ok := parseFloat(command.Args[1])
+	if !ok {
+		return response.NewError("value is not a valid float")
+	}
+
+	value, errorResponse := h.getStringOrEmpty(key)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	current := float64(0)
+	if value != "" {
+		if current, ok = parseFloat(value); !ok {
+			return response.NewError("value is not a valid float")
+		}
+	}
+
+	current += increment
+	if math.IsNaN(current) || math.IsInf(current, 0) {
+		return response.NewError("increment would produce NaN or Infinity")
+	}
+
+	formatted := strconv.FormatFloat(current, 'f', -1, 64)
+	if err := h.storage.SetKeepTTL(key, formatted); err != nil {
+		return errorReply(err)
+	}
+	return response.NewBulkString(formatted)
+}
+
+func (h *CommandHandler) handleAppend(client *client.Client, command *Command) response.Value {
+	key := command.Args[0]
+	value, errorResponse := h.getStringOrEmpty(key)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+	if len(value)+len(command.Args[1]) > maxStringLength {
+		return response.NewError(errStringTooLong)
+	}
+
+	value += command.Args[1]
+	if err := h.storage.SetKeepTTL(key, value); err != nil {
+		return errorReply(err)
+	}
+	return response.NewInteger(int64(len(value)))
+}
+
+func (h *CommandHandler) handleStrlen(client *client.Client, command *Command) response.Value {
+	value, errorResponse := h.getStringOrEmpty(command.Args[0])
+	if errorResponse != nil {
+		return *errorResponse
+	}
+	return response.NewInteger(int64(len(value)))
+}
+
+func (h *CommandHandler) handleGetRange(client *client.Client, command *Command) response.Value {
+	start, ok := parseInt(command.Args[1])
+	end, ok2 := parseInt(command.Args[2])
+	if !ok || !ok2 {
+		return response.NewError(errNotInteger)
+	}
+
+	value, errorResponse := h.getStringOrEmpty(command.Args[0])
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	length := int64(len(value))
+	if start < 0 && end < 0 && start > end {
+		return response.NewBulkString("")
+	}
+	if start < 0 {
+		start = max(length+start, 0)
+	}
+	if end < 0 {
+		end = max(length+end, 0)
+	}
+	end = min(end, length-1)
+	if start > end || length == 0 {
+		return response.NewBulkString("")
+	}
+	return response.NewBulkString(value[start : end+1])
+}
+
+func (h *CommandHandler) handleSetRange(client *client.Client, command *Command) response.Value {
+	key := command.Args[0]
+	offset, ok := parseInt(command.Args[1])
+	if !ok {
+		return response.NewError(errNotInteger)
+	}
+	if offset < 0 {
+		return response.NewError("offset is out of range")
+	}
+	patch := command.Args[2]
+
+	value, errorResponse := h.getStringOrEmpty(key)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+	// an empty patch neither creates nor grows the key
+	if len(patch) == 0 {
+		return response.NewInteger(int64(len(value)))
+	}
+	if offset+int64(len(patch)) > maxStringLength {
+		return response.NewError(errStringTooLong)
+	}
+
+	buffer := []byte(value)
+	if needed := int(offset) + len(patch); needed > len(buffer) {
+		buffer = append(buffer, make([]byte, needed-len(buffer))...)
+	}
+	copy(buffer[offset:], patch)
+
+	if err := h.storage.SetKeepTTL(key, string(buffer)); err != nil {
+		return errorReply(err)
+	}
+	return response.NewInteger(int64(len(buffer)))
+}
+
+func (h *CommandHandler) handleMGet(client *client.Client, command *Command) response.Value {
+	values := make([]response.Value, len(command.Args))
+	for i, key := range command.Args {
+		value, err := h.Get(key)
+		if err != nil {
+			values[i] = response.NewNull()
+			continue
+		}
+		values[i] = response.NewBulkString(value)
+	}
+	return response.NewArray(values...)
+}
+
+func (h *CommandHandler) handleMSet(client *client.Client, command *Command) response.Value {
+	if len(command.Args)%2 != 0 {
+		return wrongArgsCount(h.registry.Lookup("mset"))
+	}
+	for i := 0; i < len(command.Args); i += 2 {
+		if err := h.Set(command.Args[i], command.Args[i+1], nil); err != nil {
+			return errorReply(err)
+		}
+	}
+	return response.NewOK()
+}
+
+func (h *CommandHandler) handleMSetNX(client *client.Client, command *Command) response.Value {
+	if len(command.Args)%2 != 0 {
+		return wrongArgsCount(h.registry.Lookup("msetnx"))
+	}
+	for i := 0; i < len(command.Args); i += 2 {
+		if h.storage.Exists(command.Args[i]) {
+			return response.NewInteger(0)
+		}
+	}
+	for i := 0; i < len(command.Args); i += 2 {
+		if err := h.Set(command.Args[i], command.Args[i+1], nil); err != nil {
+			return errorReply(err)
+		}
+	}
+	return response.NewInteger(1)
+}
+
+// getStringOrEmpty treats missing keys as empty strings like the string
+// commands of redis do. On failure the error reply is returned.
+func (h *CommandHandler) getStringOrEmpty(key string) (string, *response.Value) {
+	value, err := h.Get(key)
+	if errors.Is(err, storage.ErrKeyNotFound) || errors.Is(err, storage.ErrKeyExpired) {
+		return "", nil
+	}
+	if err != nil {
+		reply := errorReply(err)
+		return "", &reply
+	}
+	return value, nil
+}
+
+// parseFloat accepts what strtold accepts but no NaN or infinity,
+// and no surrounding spaces
+func parseFloat(arg string) (float64, bool) {
+	if arg == "" || strings.TrimSpace(arg) != arg {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, false
+	}
+	return value, true
+}
+
+func (h *CommandHandler) Set(key, value string, experie *int64) error {
+	return h.storage.Set(key, value, experie)
+}
+
+func (h *CommandHandler) Get(key string) (string, error) {
+	return h.storage.Get(key)
+}
@@ -0,0 +1,93 @@
+package commandhandler
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+)
+
+// watchState tracks the clients watching every key so that a change to
+// one of them breaks their transactions, like the watched_keys of redis
+type watchState struct {
+	mu       sync.Mutex
+	watching map[string]map[*client.Client]struct{}
+	// watched is read without the mutex so writes skip all of this while
+	// nobody watches
+	watched atomic.Int64
+}
+
+func newWatchState() *watchState {
+	return &watchState{watching: make(map[string]map[*client.Client]struct{})}
+}
+
+// watch adds key to the keys of client, it runs under the lock of key so
+// existed can not change meanwhile
+func (h *CommandHandler) watch(client *client.Client, key string, existed bool) {
+	if _, ok := client.Watched[key]; ok {
+		return
+	}
+	client.Watched[key] = existed
+
+	h.watching.add(key, client)
+}
+
+func (s *watchState) add(key string, watcher *client.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.watching[key] == nil {
+		s.watching[key] = make(map[*client.Client]struct{})
+	}
+	s.watching[key][watcher] = struct{}{}
+	s.watched.Add(1)
+}
+
+// unwatchAll forgets the keys of client, EXEC and DISCARD do it as well
+func (h *CommandHandler) unwatchAll(client *client.Client) {
+	state := h.watching
+	state.mu.Lock()
+	for key := range client.Watched {
+		delete(state.watching[key], client)
+		if len(state.watching[key]) == 0 {
+			delete(state.watching, key)
+		}
+		state.watched.Add(-1)
+	}
+	state.mu.Unlock()
+
+	clear(client.Watched)
+	client.WatchTouched.Store(false)
+}
+
+// touchKeys marks the transactions watching keys as failed, it runs under
+// the lock of the keys so no EXEC checks them halfway through a change
+func (h *CommandHandler) touchKeys(keys []string) {
+	state := h.watching
+	if state.watched.Load() == 0 {
+		return
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	for _, key := range keys {
+		for watcher := range state.watching[key] {
+			watcher.WatchTouched.Store(true)
+		}
+	}
+}
+
+// watchedKeysChanged is true when EXEC has to abort, it runs under the
+// lock of the watched keys
+func (h *CommandHandler) watchedKeysChanged(client *client.Client) bool {
+	if client.WatchTouched.Load() {
+		return true
+	}
+	// expiring is no command so it touches nothing, a key that existed
+	// and is gone now expired
+	for key, existed := range client.Watched {
+		if existed && !h.storage.Exists(key) {
+			return true
+		}
+	}
+	return false
+}
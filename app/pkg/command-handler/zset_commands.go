@@ -0,0 +1,1115 @@
+package commandhandler
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/glob"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/response"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/storage"
+)
+
+const (
+	errNotFloat      = "value is not a valid float"
+	errNaNScore      = "resulting score is not a number (NaN)"
+	errMinMaxFloat   = "min or max is not a float"
+	errMinMaxLexItem = "min or max not valid string range item"
+)
+
+// zrangeOptions are the options shared by ZRANGE and ZRANGESTORE, limit
+// is negative when there is none
+type zrangeOptions struct {
+	byScore    bool
+	byLex      bool
+	rev        bool
+	withScores bool
+	offset     int64
+	limit      int64
+}
+
+// ZADD key [NX | XX] [GT | LT] [CH] [INCR] score member [score member ...]
+func (h *CommandHandler) handleZAdd(client *client.Client, command *Command) response.Value {
+	nx, xx, gt, lt, ch, incr := false, false, false, false, false, false
+	i := 1
+options:
+	for ; i < len(command.Args); i++ {
+		switch strings.ToUpper(command.Args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		case "CH":
+			ch = true
+		case "INCR":
+			incr = true
+		default:
+			break options
+		}
+	}
+
+	pairs := command.Args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return response.NewError(errSyntax)
+	}
+	if nx && xx {
+		return response.NewError("XX and NX options at the same time are not compatible")
+	}
+	if (gt && nx) || (lt && nx) || (gt && lt) {
+		return response.NewError("GT, LT, and/or NX options at the same time are not compatible")
+	}
+	if incr && len(pairs) > 2 {
+		return response.NewError("INCR option supports a single increment-element pair")
+	}
+
+	scores := make([]float64, 0, len(pairs)/2)
+	for j := 0; j < len(pairs); j += 2 {
+		score, ok := parseScore(pairs[j])
+		if !ok {
+			return response.NewError(errNotFloat)
+		}
+		scores = append(scores, score)
+	}
+
+	key := command.Args[0]
+	zset, err := h.storage.LookupZSet(key)
+	if err != nil {
+		return errorReply(err)
+	}
+	if zset == nil {
+		if xx {
+			if incr {
+				return response.NewNull()
+			}
+			return response.NewInteger(0)
+		}
+		if zset, err = h.storage.LookupOrCreateZSet(key); err != nil {
+			return errorReply(err)
+		}
+	}
+
+	added, updated := 0, 0
+	var incrReply response.Value = response.NewNull()
+	for j, score := range scores {
+		member := pairs[j*2+1]
+		current, exists := zset.Score(member)
+		if (nx && exists) || (xx && !exists) {
+			continue
+		}
+
+		if incr && exists {
+			score += current
+			if math.IsNaN(score) {
+				h.storage.DeleteIfEmpty(key)
+				return response.NewError(errNaNScore)
+			}
+		}
+		if exists && ((gt && score <= current) || (lt && score >= current)) {
+			continue
+		}
+
+		if !exists {
+			added++
+		} else if score != current {
+			updated++
+		}
+		zset.Add(member, score)
+		incrReply = response.NewDouble(score)
+	}
+
+	h.storage.DeleteIfEmpty(key)
+	if added > 0 {
+		h.signalKeyAsReady(key)
+	}
+	if incr {
+		return incrReply
+	}
+	if ch {
+		return response.NewInteger(int64(added + updated))
+	}
+	return response.NewInteger(int64(added))
+}
+
+// ZINCRBY key increment member
+func (h *CommandHandler) handleZIncrBy(client *client.Client, command *Command) response.Value {
+	increment, ok := parseScore(command.Args[1])
+	if !ok {
+		return response.NewError(errNotFloat)
+	}
+
+	key, member := command.Args[0], command.Args[2]
+	zset, err := h.storage.LookupOrCreateZSet(key)
+	if err != nil {
+		return errorReply(err)
+	}
+
+	current, exists := zset.Score(member)
+	score := current + increment
+	if math.IsNaN(score) {
+		h.storage.DeleteIfEmpty(key)
+		return response.NewError(errNaNScore)
+	}
+	zset.Add(member, score)
+	if !exists {
+		h.signalKeyAsReady(key)
+	}
+	return response.NewDouble(score)
+}
+
+func (h *CommandHandler) handleZCard(client *client.Client, command *Command) response.Value {
+	zset, err := h.storage.LookupZSet(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if zset == nil {
+		return response.NewInteger(0)
+	}
+	return response.NewInteger(int64(zset.Len()))
+}
+
+func (h *CommandHandler) handleZScore(client *client.Client, command *Command) response.Value {
+	zset, err := h.storage.LookupZSet(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if zset == nil {
+		return response.NewNull()
+	}
+	score, ok := zset.Score(command.Args[1])
+	if !ok {
+		return response.NewNull()
+	}
+	return response.NewDouble(score)
+}
+
+func (h *CommandHandler) handleZMScore(client *client.Client, command *Command) response.Value {
+	zset, err := h.storage.LookupZSet(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+
+	scores := make([]response.Value, 0, len(command.Args)-1)
+	for _, member := range command.Args[1:] {
+		score, ok := 0.0, false
+		if zset != nil {
+			score, ok = zset.Score(member)
+		}
+		if !ok {
+			scores = append(scores, response.NewNull())
+			continue
+		}
+		scores = append(scores, response.NewDouble(score))
+	}
+	return response.NewArray(scores...)
+}
+
+func (h *CommandHandler) handleZRank(client *client.Client, command *Command) response.Value {
+	return h.zrankGeneric(command, false)
+}
+
+func (h *CommandHandler) handleZRevRank(client *client.Client, command *Command) response.Value {
+	return h.zrankGeneric(command, true)
+}
+
+// zrankGeneric is ZRANK and ZREVRANK, key member [WITHSCORE]
+func (h *CommandHandler) zrankGeneric(command *Command, reverse bool) response.Value {
+	withScore := false
+	if len(command.Args) == 3 {
+		if strings.ToUpper(command.Args[2]) != "WITHSCORE" {
+			return response.NewError(errSyntax)
+		}
+		withScore = true
+	} else if len(command.Args) > 3 {
+		return response.NewError(errSyntax)
+	}
+
+	zset, err := h.storage.LookupZSet(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	nullReply := response.NewNull()
+	if withScore {
+		nullReply = response.NewNullArray()
+	}
+	if zset == nil {
+		return nullReply
+	}
+
+	rank, ok := zset.Rank(command.Args[1], reverse)
+	if !ok {
+		return nullReply
+	}
+	if withScore {
+		score, _ := zset.Score(command.Args[1])
+		return response.NewArray(response.NewInteger(int64(rank)), response.NewDouble(score))
+	}
+	return response.NewInteger(int64(rank))
+}
+
+// ZCOUNT key min max
+func (h *CommandHandler) handleZCount(client *client.Client, command *Command) response.Value {
+	r, ok := parseScoreRange(command.Args[1], command.Args[2])
+	if !ok {
+		return response.NewError(errMinMaxFloat)
+	}
+	zset, err := h.storage.LookupZSet(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if zset == nil {
+		return response.NewInteger(0)
+	}
+	return response.NewInteger(int64(zset.CountByScore(r)))
+}
+
+// ZLEXCOUNT key min max
+func (h *CommandHandler) handleZLexCount(client *client.Client, command *Command) response.Value {
+	r, ok := parseLexRange(command.Args[1], command.Args[2])
+	if !ok {
+		return response.NewError(errMinMaxLexItem)
+	}
+	zset, err := h.storage.LookupZSet(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if zset == nil {
+		return response.NewInteger(0)
+	}
+	return response.NewInteger(int64(zset.CountByLex(r)))
+}
+
+// ZRANGE key start stop [BYSCORE | BYLEX] [REV] [LIMIT offset count]
+// [WITHSCORES]
+func (h *CommandHandler) handleZRange(client *client.Client, command *Command) response.Value {
+	options, errorResponse := parseZRangeOptions(command.Args[3:], true)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+	return h.zrangeReply(client, command.Args[0], command.Args[1], command.Args[2], options)
+}
+
+// ZRANGESTORE dst src min max [BYSCORE | BYLEX] [REV] [LIMIT offset count]
+func (h *CommandHandler) handleZRangeStore(client *client.Client, command *Command) response.Value {
+	options, errorResponse := parseZRangeOptions(command.Args[4:], false)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	entries, errorResponse := h.zrangeGeneric(command.Args[1], command.Args[2], command.Args[3], options)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+	h.storeZSet(command.Args[0], entries)
+	return response.NewInteger(int64(len(entries)))
+}
+
+func (h *CommandHandler) handleZRevRange(client *client.Client, command *Command) response.Value {
+	return h.zrangeLegacy(client, command, zrangeOptions{rev: true})
+}
+
+func (h *CommandHandler) handleZRangeByScore(client *client.Client, command *Command) response.Value {
+	return h.zrangeLegacy(client, command, zrangeOptions{byScore: true})
+}
+
+func (h *CommandHandler) handleZRevRangeByScore(client *client.Client, command *Command) response.Value {
+	return h.zrangeLegacy(client, command, zrangeOptions{byScore: true, rev: true})
+}
+
+func (h *CommandHandler) handleZRangeByLex(client *client.Client, command *Command) response.Value {
+	return h.zrangeLegacy(client, command, zrangeOptions{byLex: true})
+}
+
+func (h *CommandHandler) handleZRevRangeByLex(client *client.Client, command *Command) response.Value {
+	return h.zrangeLegacy(client, command, zrangeOptions{byLex: true, rev: true})
+}
+
+// zrangeLegacy is the commands ZRANGE replaced, they take the same
+// options as it besides the ones their name implies
+func (h *CommandHandler) zrangeLegacy(client *client.Client, command *Command, implied zrangeOptions) response.Value {
+	options := implied
+	options.limit = -1
+	args := command.Args[3:]
+	for i := 0; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); {
+		case option == "WITHSCORES" && !implied.byLex:
+			options.withScores = true
+		case option == "LIMIT" && (implied.byScore || implied.byLex) && i+2 < len(args):
+			offset, ok := parseInt(args[i+1])
+			limit, ok2 := parseInt(args[i+2])
+			if !ok || !ok2 {
+				return response.NewError(errNotInteger)
+			}
+			options.offset, options.limit = offset, limit
+			i += 2
+		default:
+			return response.NewError(errSyntax)
+		}
+	}
+	return h.zrangeReply(client, command.Args[0], command.Args[1], command.Args[2], options)
+}
+
+func (h *CommandHandler) zrangeReply(client *client.Client, key, start, stop string, options zrangeOptions) response.Value {
+	entries, errorResponse := h.zrangeGeneric(key, start, stop, options)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+	return zsetReply(client, entries, options.withScores)
+}
+
+// zrangeGeneric returns the elements of the sorted set at key between
+// start and stop, which are ranks, scores or members depending on options
+func (h *CommandHandler) zrangeGeneric(key, start, stop string, options zrangeOptions) ([]storage.ZEntry, *response.Value) {
+	fail := func(message string) ([]storage.ZEntry, *response.Value) {
+		reply := response.NewError(message)
+		return nil, &reply
+	}
+
+	// the reversed ranges take the higher bound first
+	if options.rev && (options.byScore || options.byLex) {
+		start, stop = stop, start
+	}
+
+	var scoreRange storage.ScoreRange
+	var lexRange storage.LexRange
+	var startRank, stopRank int64
+	var ok bool
+	switch {
+	case options.byScore:
+		if scoreRange, ok = parseScoreRange(start, stop); !ok {
+			return fail(errMinMaxFloat)
+		}
+	case options.byLex:
+		if lexRange, ok = parseLexRange(start, stop); !ok {
+			return fail(errMinMaxLexItem)
+		}
+	default:
+		var ok2 bool
+		startRank, ok = parseInt(start)
+		stopRank, ok2 = parseInt(stop)
+		if !ok || !ok2 {
+			return fail(errNotInteger)
+		}
+	}
+
+	zset, err := h.storage.LookupZSet(key)
+	if err != nil {
+		reply := errorReply(err)
+		return nil, &reply
+	}
+	if zset == nil {
+		return []storage.ZEntry{}, nil
+	}
+
+	// a negative offset returns nothing and a negative count everything
+	if options.offset < 0 {
+		return []storage.ZEntry{}, nil
+	}
+	offset := int(min(options.offset, math.MaxInt32))
+	limit := int(max(min(options.limit, math.MaxInt32), -1))
+
+	switch {
+	case options.byScore:
+		return zset.RangeByScore(scoreRange, options.rev, offset, limit), nil
+	case options.byLex:
+		return zset.RangeByLex(lexRange, options.rev, offset, limit), nil
+	}
+
+	length := int64(zset.Len())
+	if startRank < 0 {
+		startRank += length
+	}
+	if stopRank < 0 {
+		stopRank += length
+	}
+	startRank = max(startRank, 0)
+	if startRank > stopRank || startRank >= length {
+		return []storage.ZEntry{}, nil
+	}
+	stopRank = min(stopRank, length-1)
+	return zset.RangeByRank(int(startRank), int(stopRank), options.rev), nil
+}
+
+func parseZRangeOptions(args []string, allowWithScores bool) (zrangeOptions, *response.Value) {
+	fail := func(message string) (zrangeOptions, *response.Value) {
+		reply := response.NewError(message)
+		return zrangeOptions{}, &reply
+	}
+
+	options := zrangeOptions{limit: -1}
+	hasLimit := false
+	for i := 0; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); {
+		case option == "BYSCORE":
+			options.byScore = true
+		case option == "BYLEX":
+			options.byLex = true
+		case option == "REV":
+			options.rev = true
+		case option == "WITHSCORES" && allowWithScores:
+			options.withScores = true
+		case option == "LIMIT" && i+2 < len(args):
+			offset, ok := parseInt(args[i+1])
+			limit, ok2 := parseInt(args[i+2])
+			if !ok || !ok2 {
+				return fail(errNotInteger)
+			}
+			options.offset, options.limit = offset, limit
+			hasLimit = true
+			i += 2
+		default:
+			return fail(errSyntax)
+		}
+	}
+
+	if options.byScore && options.byLex {
+		return fail(errSyntax)
+	}
+	if hasLimit && !options.byScore && !options.byLex {
+		return fail("syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if options.withScores && options.byLex {
+		return fail("syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+	return options, nil
+}
+
+func (h *CommandHandler) handleZRem(client *client.Client, command *Command) response.Value {
+	key := command.Args[0]
+	zset, err := h.storage.LookupZSet(key)
+	if err != nil {
+		return errorReply(err)
+	}
+	if zset == nil {
+		return response.NewInteger(0)
+	}
+
+	removed := 0
+	for _, member := range command.Args[1:] {
+		if zset.Remove(member) {
+			removed++
+		}
+	}
+	h.storage.DeleteIfEmpty(key)
+	return response.NewInteger(int64(removed))
+}
+
+// ZREMRANGEBYRANK key start stop
+func (h *CommandHandler) handleZRemRangeByRank(client *client.Client, command *Command) response.Value {
+	start, ok := parseInt(command.Args[1])
+	stop, ok2 := parseInt(command.Args[2])
+	if !ok || !ok2 {
+		return response.NewError(errNotInteger)
+	}
+
+	return h.zremRangeGeneric(command.Args[0], func(zset *storage.ZSet) int {
+		length := int64(zset.Len())
+		if start < 0 {
+			start += length
+		}
+		if stop < 0 {
+			stop += length
+		}
+		start = max(start, 0)
+		if start > stop || start >= length {
+			return 0
+		}
+		return zset.RemoveRangeByRank(int(start), int(min(stop, length-1)))
+	})
+}
+
+// ZREMRANGEBYSCORE key min max
+func (h *CommandHandler) handleZRemRangeByScore(client *client.Client, command *Command) response.Value {
+	r, ok := parseScoreRange(command.Args[1], command.Args[2])
+	if !ok {
+		return response.NewError(errMinMaxFloat)
+	}
+	return h.zremRangeGeneric(command.Args[0], func(zset *storage.ZSet) int {
+		return zset.RemoveRangeByScore(r)
+	})
+}
+
+// ZREMRANGEBYLEX key min max
+func (h *CommandHandler) handleZRemRangeByLex(client *client.Client, command *Command) response.Value {
+	r, ok := parseLexRange(command.Args[1], command.Args[2])
+	if !ok {
+		return response.NewError(errMinMaxLexItem)
+	}
+	return h.zremRangeGeneric(command.Args[0], func(zset *storage.ZSet) int {
+		return zset.RemoveRangeByLex(r)
+	})
+}
+
+func (h *CommandHandler) zremRangeGeneric(key string, remove func(zset *storage.ZSet) int) response.Value {
+	zset, err := h.storage.LookupZSet(key)
+	if err != nil {
+		return errorReply(err)
+	}
+	if zset == nil {
+		return response.NewInteger(0)
+	}
+	removed := remove(zset)
+	h.storage.DeleteIfEmpty(key)
+	return response.NewInteger(int64(removed))
+}
+
+func (h *CommandHandler) handleZPopMin(client *client.Client, command *Command) response.Value {
+	return h.zpopGeneric(client, command, false)
+}
+
+func (h *CommandHandler) handleZPopMax(client *client.Client, command *Command) response.Value {
+	return h.zpopGeneric(client, command, true)
+}
+
+// zpopGeneric is ZPOPMIN and ZPOPMAX, key [count]
+func (h *CommandHandler) zpopGeneric(client *client.Client, command *Command, highest bool) response.Value {
+	if len(command.Args) > 2 {
+		return response.NewError(errSyntax)
+	}
+	count, hasCount := int64(1), len(command.Args) == 2
+	if hasCount {
+		var ok bool
+		if count, ok = parseInt(command.Args[1]); !ok || count < 0 {
+			return response.NewError(errMustBePositive)
+		}
+	}
+
+	key := command.Args[0]
+	zset, err := h.storage.LookupZSet(key)
+	if err != nil {
+		return errorReply(err)
+	}
+	if zset == nil {
+		return response.NewArray()
+	}
+
+	entries := []storage.ZEntry{}
+	for ; count > 0; count-- {
+		entry, ok := zset.Pop(highest)
+		if !ok {
+			break
+		}
+		entries = append(entries, entry)
+	}
+	h.storage.DeleteIfEmpty(key)
+
+	// without a count RESP3 still gets a flat member and score
+	if !hasCount && len(entries) == 1 {
+		return response.NewArray(response.NewBulkString(entries[0].Member), response.NewDouble(entries[0].Score))
+	}
+	return zsetReply(client, entries, true)
+}
+
+func (h *CommandHandler) handleBZPopMin(client *client.Client, command *Command) response.Value {
+	return h.bzpopGeneric(client, command, false)
+}
+
+func (h *CommandHandler) handleBZPopMax(client *client.Client, command *Command) response.Value {
+	return h.bzpopGeneric(client, command, true)
+}
+
+// bzpopGeneric is BZPOPMIN and BZPOPMAX, key [key ...] timeout
+func (h *CommandHandler) bzpopGeneric(client *client.Client, command *Command, highest bool) response.Value {
+	keys := command.Args[:len(command.Args)-1]
+	timeout, errorResponse := parseTimeout(command.Args[len(command.Args)-1])
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	pop := func(key string) (response.Value, bool, error) {
+		zset, err := h.storage.LookupZSet(key)
+		if err != nil || zset == nil {
+			return response.Value{}, false, err
+		}
+		entry, _ := zset.Pop(highest)
+		h.storage.DeleteIfEmpty(key)
+		return response.NewArray(
+			response.NewBulkString(key),
+			response.NewBulkString(entry.Member),
+			response.NewDouble(entry.Score),
+		), true, nil
+	}
+
+	for _, key := range keys {
+		reply, ok, err := pop(key)
+		if err != nil {
+			return errorReply(err)
+		}
+		if ok {
+			return reply
+		}
+	}
+
+	popCommand := "ZPOPMIN"
+	if highest {
+		popCommand = "ZPOPMAX"
+	}
+	return h.block(client, &blockedClient{
+		keys:         keys,
+		timeout:      timeout,
+		serve:        serveIgnoringErrors(pop),
+		timeoutReply: response.NewNullArray(),
+		command: func(key string) *Command {
+			return newCommand(popCommand, key)
+		},
+	})
+}
+
+// ZRANDMEMBER key [count [WITHSCORES]]
+func (h *CommandHandler) handleZRandMember(client *client.Client, command *Command) response.Value {
+	if len(command.Args) > 3 || (len(command.Args) == 3 && strings.ToUpper(command.Args[2]) != "WITHSCORES") {
+		return response.NewError(errSyntax)
+	}
+	count, hasCount := int64(1), len(command.Args) > 1
+	if hasCount {
+		var ok bool
+		if count, ok = parseInt(command.Args[1]); !ok {
+			return response.NewError(errNotInteger)
+		}
+		if count < -math.MaxInt64/2 || count > math.MaxInt64/2 {
+			return response.NewError("value is out of range")
+		}
+	}
+
+	zset, err := h.storage.LookupZSet(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+	if zset == nil {
+		if hasCount {
+			return response.NewArray()
+		}
+		return response.NewNull()
+	}
+
+	all := make([]storage.ZEntry, 0, zset.Len())
+	zset.Each(func(entry storage.ZEntry) bool {
+		all = append(all, entry)
+		return true
+	})
+
+	picked := []storage.ZEntry{}
+	if count < 0 {
+		for i := int64(0); i < -count; i++ {
+			picked = append(picked, all[rand.Intn(len(all))])
+		}
+	} else {
+		for _, i := range rand.Perm(len(all))[:min(int(min(count, math.MaxInt32)), len(all))] {
+			picked = append(picked, all[i])
+		}
+	}
+
+	if !hasCount {
+		return response.NewBulkString(picked[0].Member)
+	}
+	return zsetReply(client, picked, len(command.Args) == 3)
+}
+
+// ZSCAN key cursor [MATCH pattern] [COUNT count]
+func (h *CommandHandler) handleZScan(client *client.Client, command *Command) response.Value {
+	cursor, err := strconv.ParseUint(command.Args[1], 10, 64)
+	if err != nil {
+		return response.NewError("invalid cursor")
+	}
+
+	pattern := ""
+	count := int64(10)
+	for i := 2; i < len(command.Args); i += 2 {
+		if i+1 >= len(command.Args) {
+			return response.NewError(errSyntax)
+		}
+		switch strings.ToUpper(command.Args[i]) {
+		case "MATCH":
+			pattern = command.Args[i+1]
+		case "COUNT":
+			var ok bool
+			if count, ok = parseInt(command.Args[i+1]); !ok {
+				return response.NewError(errNotInteger)
+			}
+			if count < 1 {
+				return response.NewError(errSyntax)
+			}
+		default:
+			return response.NewError(errSyntax)
+		}
+	}
+
+	zset, err := h.storage.LookupZSet(command.Args[0])
+	if err != nil {
+		return errorReply(err)
+	}
+
+	next, scanned := uint64(0), []storage.ZEntry{}
+	if zset != nil {
+		next, scanned = zset.Scan(cursor, int(min(count, math.MaxInt32)))
+	}
+
+	elements := []string{}
+	for _, entry := range scanned {
+		if pattern == "" || pattern == "*" || glob.Match(pattern, entry.Member, false) {
+			elements = append(elements, entry.Member, response.FormatDouble(entry.Score))
+		}
+	}
+
+	return response.NewArray(
+		response.NewBulkString(strconv.FormatUint(next, 10)),
+		response.NewBulkStringArray(elements),
+	)
+}
+
+func (h *CommandHandler) handleZUnionStore(client *client.Client, command *Command) response.Value {
+	return h.zsetAlgebraStore(command, zsetUnion)
+}
+
+func (h *CommandHandler) handleZInterStore(client *client.Client, command *Command) response.Value {
+	return h.zsetAlgebraStore(command, zsetInter)
+}
+
+func (h *CommandHandler) handleZDiffStore(client *client.Client, command *Command) response.Value {
+	return h.zsetAlgebraStore(command, zsetDiff)
+}
+
+func (h *CommandHandler) handleZUnion(client *client.Client, command *Command) response.Value {
+	return h.zsetAlgebraReply(client, command, zsetUnion)
+}
+
+func (h *CommandHandler) handleZInter(client *client.Client, command *Command) response.Value {
+	return h.zsetAlgebraReply(client, command, zsetInter)
+}
+
+func (h *CommandHandler) handleZDiff(client *client.Client, command *Command) response.Value {
+	return h.zsetAlgebraReply(client, command, zsetDiff)
+}
+
+// zsetAlgebraStore is ZUNIONSTORE and its siblings,
+// destination numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM | MIN | MAX]
+func (h *CommandHandler) zsetAlgebraStore(command *Command, operation zsetOperation) response.Value {
+	inputs, _, errorResponse := h.zsetAlgebraInputs(command, command.Args[1:], false)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	result := operation(inputs)
+	h.storage.StoreZSet(command.Args[0], result)
+	if result.Len() > 0 {
+		h.signalKeyAsReady(command.Args[0])
+	}
+	return response.NewInteger(int64(result.Len()))
+}
+
+// zsetAlgebraReply is ZUNION and its siblings, which take WITHSCORES
+// instead of a destination
+func (h *CommandHandler) zsetAlgebraReply(client *client.Client, command *Command, operation zsetOperation) response.Value {
+	inputs, withScores, errorResponse := h.zsetAlgebraInputs(command, command.Args, true)
+	if errorResponse != nil {
+		return *errorResponse
+	}
+
+	entries := []storage.ZEntry{}
+	operation(inputs).Each(func(entry storage.ZEntry) bool {
+		entries = append(entries, entry)
+		return true
+	})
+	return zsetReply(client, entries, withScores)
+}
+
+// zsetInput is a source of the zset algebra commands, sets count as
+// sorted sets with every score 1
+type zsetInput struct {
+	entries   []storage.ZEntry
+	index     map[string]float64
+	weight    float64
+	aggregate string
+}
+
+type zsetOperation func(inputs []*zsetInput) *storage.ZSet
+
+// zsetAlgebraInputs parses numkeys key [key ...] [WEIGHTS weight ...]
+// [AGGREGATE SUM | MIN | MAX] [WITHSCORES] and loads the sources, which
+// are nil for missing keys
+func (h *CommandHandler) zsetAlgebraInputs(command *Command, args []string, allowWithScores bool) ([]*zsetInput, bool, *response.Value) {
+	fail := func(message string) ([]*zsetInput, bool, *response.Value) {
+		reply := response.NewError(message)
+		return nil, false, &reply
+	}
+
+	numKeys, ok := parseInt(args[0])
+	if !ok {
+		return fail(errNotInteger)
+	}
+	if numKeys < 1 {
+		return fail("at least 1 input key is needed for '" + strings.ToLower(command.Name) + "' command")
+	}
+	if numKeys > int64(len(args)-1) {
+		return fail(errSyntax)
+	}
+	keys := args[1 : 1+numKeys]
+
+	isDiff := strings.HasPrefix(strings.ToLower(command.Name), "zdiff")
+	weights := make([]float64, len(keys))
+	for i := range weights {
+		weights[i] = 1
+	}
+	aggregate := "SUM"
+	withScores := false
+	rest := args[1+numKeys:]
+	for i := 0; i < len(rest); i++ {
+		switch option := strings.ToUpper(rest[i]); {
+		case option == "WEIGHTS" && !isDiff && i+len(keys) < len(rest):
+			for j := range keys {
+				weight, ok := parseScore(rest[i+1+j])
+				if !ok {
+					return fail("weight value is not a float")
+				}
+				weights[j] = weight
+			}
+			i += len(keys)
+		case option == "AGGREGATE" && !isDiff && i+1 < len(rest):
+			aggregate = strings.ToUpper(rest[i+1])
+			if aggregate != "SUM" && aggregate != "MIN" && aggregate != "MAX" {
+				return fail(errSyntax)
+			}
+			i++
+		case option == "WITHSCORES" && allowWithScores:
+			withScores = true
+		default:
+			return fail(errSyntax)
+		}
+	}
+
+	inputs := make([]*zsetInput, 0, len(keys))
+	for i, key := range keys {
+		input, err := h.loadZSetInput(key)
+		if err != nil {
+			reply := errorReply(err)
+			return nil, false, &reply
+		}
+		if input != nil {
+			input.weight = weights[i]
+			input.aggregate = aggregate
+		}
+		inputs = append(inputs, input)
+	}
+	return inputs, withScores, nil
+}
+
+func (h *CommandHandler) loadZSetInput(key string) (*zsetInput, error) {
+	input := &zsetInput{index: map[string]float64{}}
+	zset, err := h.storage.LookupZSet(key)
+	if errors.Is(err, storage.ErrWrongType) {
+		set, err := h.storage.LookupSet(key)
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range set.Members() {
+			input.entries = append(input.entries, storage.ZEntry{Member: member, Score: 1})
+			input.index[member] = 1
+		}
+		return input, nil
+	}
+	if err != nil || zset == nil {
+		return nil, err
+	}
+
+	zset.Each(func(entry storage.ZEntry) bool {
+		input.entries = append(input.entries, entry)
+		input.index[entry.Member] = entry.Score
+		return true
+	})
+	return input, nil
+}
+
+func zsetUnion(inputs []*zsetInput) *storage.ZSet {
+	result := storage.NewZSet()
+	for _, input := range inputs {
+		if input == nil {
+			continue
+		}
+		for _, entry := range input.entries {
+			score := weighted(entry.Score, input.weight)
+			if current, exists := result.Score(entry.Member); exists {
+				score = aggregateScores(current, score, input.aggregate)
+			}
+			result.Add(entry.Member, score)
+		}
+	}
+	return result
+}
+
+func zsetInter(inputs []*zsetInput) *storage.ZSet {
+	result := storage.NewZSet()
+	for _, input := range inputs {
+		if input == nil {
+			return result
+		}
+	}
+
+	for _, entry := range inputs[0].entries {
+		score := weighted(entry.Score, inputs[0].weight)
+		found := true
+		for _, other := range inputs[1:] {
+			otherScore, ok := other.index[entry.Member]
+			if !ok {
+				found = false
+				break
+			}
+			score = aggregateScores(score, weighted(otherScore, other.weight), other.aggregate)
+		}
+		if found {
+			result.Add(entry.Member, score)
+		}
+	}
+	return result
+}
+
+func zsetDiff(inputs []*zsetInput) *storage.ZSet {
+	result := storage.NewZSet()
+	if inputs[0] == nil {
+		return result
+	}
+	for _, entry := range inputs[0].entries {
+		found := false
+		for _, other := range inputs[1:] {
+			if other == nil {
+				continue
+			}
+			if _, ok := other.index[entry.Member]; ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result.Add(entry.Member, entry.Score)
+		}
+	}
+	return result
+}
+
+// weighted avoids the NaN of 0 * inf like redis does
+func weighted(score, weight float64) float64 {
+	result := score * weight
+	if math.IsNaN(result) {
+		return 0
+	}
+	return result
+}
+
+func aggregateScores(a, b float64, aggregate string) float64 {
+	switch aggregate {
+	case "MIN":
+		return min(a, b)
+	case "MAX":
+		return max(a, b)
+	}
+	// inf + -inf is 0 for redis and not NaN
+	if sum := a + b; !math.IsNaN(sum) {
+		return sum
+	}
+	return 0
+}
+
+func (h *CommandHandler) storeZSet(key string, entries []storage.ZEntry) {
+	zset := storage.NewZSet()
+	for _, entry := range entries {
+		zset.Add(entry.Member, entry.Score)
+	}
+	h.storage.StoreZSet(key, zset)
+	if zset.Len() > 0 {
+		h.signalKeyAsReady(key)
+	}
+}
+
+// zsetReply replies with the members, with their scores after them in
+// RESP2 and as pairs in RESP3
+func zsetReply(client *client.Client, entries []storage.ZEntry, withScores bool) response.Value {
+	reply := make([]response.Value, 0, len(entries))
+	for _, entry := range entries {
+		member := response.NewBulkString(entry.Member)
+		switch {
+		case !withScores:
+			reply = append(reply, member)
+		case client.Protocol == response.ProtocolRESP3:
+			reply = append(reply, response.NewArray(member, response.NewDouble(entry.Score)))
+		default:
+			reply = append(reply, member, response.NewDouble(entry.Score))
+		}
+	}
+	return response.NewArray(reply...)
+}
+
+// parseScore accepts what strtod accepts including inf, but not NaN
+func parseScore(arg string) (float64, bool) {
+	if arg == "" || strings.TrimSpace(arg) != arg {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(arg, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return 0, false
+	}
+	return value, !math.IsNaN(value)
+}
+
+// parseScoreRange parses min and max of ZRANGEBYSCORE, a leading "("
+// excludes the bound
+func parseScoreRange(minArg, maxArg string) (storage.ScoreRange, bool) {
+	var r storage.ScoreRange
+	var ok bool
+	if r.Min, r.MinEx, ok = parseScoreBound(minArg); !ok {
+		return r, false
+	}
+	if r.Max, r.MaxEx, ok = parseScoreBound(maxArg); !ok {
+		return r, false
+	}
+	return r, true
+}
+
+func parseScoreBound(arg string) (float64, bool, bool) {
+	exclusive := strings.HasPrefix(arg, "(")
+	if exclusive {
+		arg = arg[1:]
+	}
+	value, ok := parseScore(arg)
+	return value, exclusive, ok
+}
+
+// parseLexRange parses min and max of ZRANGEBYLEX, every bound is "-",
+// "+" or a member after "[" to include or "(" to exclude it
+func parseLexRange(minArg, maxArg string) (storage.LexRange, bool) {
+	var r storage.LexRange
+	var minKind, maxKind byte
+	var ok bool
+	if r.Min, r.MinEx, minKind, ok = parseLexBound(minArg); !ok {
+		return r, false
+	}
+	if r.Max, r.MaxEx, maxKind, ok = parseLexBound(maxArg); !ok {
+		return r, false
+	}
+
+	// nothing is below "" excluded, which is how "+" as the minimum or
+	// "-" as the maximum match nothing
+	if minKind == '+' || maxKind == '-' {
+		return storage.LexRange{MinInf: true, Max: "", MaxEx: true}, true
+	}
+	r.MinInf, r.MaxInf = minKind == '-', maxKind == '+'
+	return r, true
+}
+
+// parseLexBound returns the member, whether it is excluded and '-' or '+'
+// for the infinite bounds
+func parseLexBound(arg string) (string, bool, byte, bool) {
+	switch {
+	case arg == "-" || arg == "+":
+		return "", false, arg[0], true
+	case strings.HasPrefix(arg, "["):
+		return arg[1:], false, 0, true
+	case strings.HasPrefix(arg, "("):
+		return arg[1:], true, 0, true
+	}
+	return "", false, 0, false
+}
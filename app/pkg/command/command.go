@@ -1,5 +1,7 @@
 package command
 
+// Args hold the raw bytes of each bulk string, go strings are just
+// immutable byte slices so nothing here assumes text.
 type Command struct {
 	Name string
 	Args []string
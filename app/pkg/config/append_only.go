@@ -0,0 +1,91 @@
+package config
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// AppendFilename names the files of the AOF, which live in AppendDirname
+const (
+	AppendFilename = "appendonly.aof"
+	AppendDirname  = "appendonlydir"
+)
+
+// appendfsync policies, how often the AOF is synced to disk
+const (
+	FsyncAlways   = "always"
+	FsyncEverySec = "everysec"
+	FsyncNo       = "no"
+)
+
+var (
+	ErrInvalidMemory      = errors.New("argument must be a memory value")
+	ErrInvalidPercentage  = errors.New("argument must be a positive integer or 0")
+	ErrInvalidAppendFsync = errors.New("argument(s) must be one of the following: always, everysec, no")
+	ErrInvalidYesNo       = errors.New("argument must be 'yes' or 'no'")
+)
+
+func ParseAppendFsync(value string) (string, error) {
+	switch policy := strings.ToLower(value); policy {
+	case FsyncAlways, FsyncEverySec, FsyncNo:
+		return policy, nil
+	}
+	return "", ErrInvalidAppendFsync
+}
+
+// ParseYesNo reads the booleans of the config, which are yes or no
+func ParseYesNo(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes":
+		return true, nil
+	case "no":
+		return false, nil
+	}
+	return false, ErrInvalidYesNo
+}
+
+// YesNo is how CONFIG GET shows a boolean
+func YesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
+// memoryUnits are the suffixes of memory values, k is a thousand and kb
+// is 1024 like in redis.conf
+var memoryUnits = map[string]int64{
+	"":   1,
+	"b":  1,
+	"k":  1000,
+	"kb": 1024,
+	"m":  1000 * 1000,
+	"mb": 1024 * 1024,
+	"g":  1000 * 1000 * 1000,
+	"gb": 1024 * 1024 * 1024,
+}
+
+// ParseMemory reads sizes like 64mb
+func ParseMemory(value string) (int64, error) {
+	value = strings.ToLower(value)
+	digits := strings.TrimRight(value, "bkmg")
+	multiplier, ok := memoryUnits[value[len(digits):]]
+	if !ok {
+		return 0, ErrInvalidMemory
+	}
+	number, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || number < 0 || number > (1<<63-1)/multiplier {
+		return 0, ErrInvalidMemory
+	}
+	return number * multiplier, nil
+}
+
+// ParsePercentage reads auto-aof-rewrite-percentage, 0 turns it off
+func ParsePercentage(value string) (int64, error) {
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || number < 0 {
+		return 0, ErrInvalidPercentage
+	}
+	return number, nil
+}
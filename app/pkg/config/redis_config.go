@@ -1,5 +1,10 @@
 package config
 
+import "path/filepath"
+
+// RedisVersion is the version of redis we claim to be compatible with
+const RedisVersion = "7.4.0"
+
 const (
 	RoleMaster = "master"
 	RoleSlave  = "slave"
@@ -14,4 +19,64 @@ type RedisConfig struct {
 	MasterPort        string
 	ReplicationId     string
 	ReplicationOffset int64
+
+	// SaveRules trigger background saves of the RDB file
+	SaveRules []SaveRule
+
+	// AppendOnly logs every write to the AOF, which is loaded instead of
+	// the RDB file then. AppendFsync is one of the Fsync policies and
+	// AOFLoadTruncated loads a file whose last command was cut short.
+	AppendOnly       bool
+	AppendFsync      string
+	AOFLoadTruncated bool
+	// the AOF is rewritten once it grew by AutoAOFRewritePercentage since
+	// the last rewrite and is at least AutoAOFRewriteMinSize bytes
+	AutoAOFRewritePercentage int64
+	AutoAOFRewriteMinSize    int64
+
+	// PubSubOutputLimit is the client-output-buffer-limit of the pubsub
+	// class, subscribers that do not read their messages are dropped
+	PubSubOutputLimit OutputBufferLimit
+}
+
+// RDBPath is where the RDB file is loaded from and saved to, dump.rdb in
+// the working directory unless configured. Without a Dir the file is only
+// written by SAVE and BGSAVE and never loaded.
+func (c RedisConfig) RDBPath() string {
+	dir, fileName := c.Dir, c.DbFileName
+	if dir == "" {
+		dir = "."
+	}
+	if fileName == "" {
+		fileName = "dump.rdb"
+	}
+	return filepath.Join(dir, fileName)
+}
+
+// AOFDir has the files of the AOF and their manifest, it is next to the
+// RDB file
+func (c RedisConfig) AOFDir() string {
+	dir := c.Dir
+	if dir == "" {
+		dir = "."
+	}
+	return filepath.Join(dir, AppendDirname)
+}
+
+// AOFPath is where older versions kept the AOF as a single file, it is
+// moved into AOFDir on start
+func (c RedisConfig) AOFPath() string {
+	dir := c.Dir
+	if dir == "" {
+		dir = "."
+	}
+	return filepath.Join(dir, AppendFilename)
+}
+
+// OutputBufferLimit is a hard limit in bytes and a soft one that may be
+// exceeded for SoftSeconds, zero disables a limit
+type OutputBufferLimit struct {
+	HardBytes   int
+	SoftBytes   int
+	SoftSeconds int
 }
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// DefaultSaveRules are the save points of redis without a config file
+const DefaultSaveRules = "3600 1 300 100 60 10000"
+
+var ErrInvalidSaveRules = errors.New("Invalid save parameters")
+
+// SaveRule saves the RDB file once Changes writes happened and Seconds
+// passed since the last save
+type SaveRule struct {
+	Seconds int64
+	Changes int64
+}
+
+// ParseSaveRules reads the "<seconds> <changes> ..." pairs of the save
+// directive, an empty string is no rules
+func ParseSaveRules(value string) ([]SaveRule, error) {
+	args := strings.Fields(value)
+	if len(args)%2 != 0 {
+		return nil, ErrInvalidSaveRules
+	}
+
+	rules := []SaveRule{}
+	for i := 0; i < len(args); i += 2 {
+		seconds, err := strconv.ParseInt(args[i], 10, 64)
+		if err != nil || seconds < 1 {
+			return nil, ErrInvalidSaveRules
+		}
+		changes, err := strconv.ParseInt(args[i+1], 10, 64)
+		if err != nil || changes < 0 {
+			return nil, ErrInvalidSaveRules
+		}
+		rules = append(rules, SaveRule{Seconds: seconds, Changes: changes})
+	}
+	return rules, nil
+}
+
+// FormatSaveRules is the value CONFIG GET save replies with
+func FormatSaveRules(rules []SaveRule) string {
+	parts := make([]string, 0, len(rules)*2)
+	for _, rule := range rules {
+		parts = append(parts, strconv.FormatInt(rule.Seconds, 10), strconv.FormatInt(rule.Changes, 10))
+	}
+	return strings.Join(parts, " ")
+}
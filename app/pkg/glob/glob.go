@@ -0,0 +1,132 @@
+package glob
+
+// Match reports whether str matches the glob style pattern the way
+// redis matches KEYS and SCAN patterns:
+//
+//	pattern  matches
+//	*        any sequence of characters, also empty
+//	?        any single character
+//	[abc]    one of the characters, [^abc] none of them, [a-z] a range
+//	\x       the character x itself
+func Match(pattern, str string, nocase bool) bool {
+	skipLongerMatches := false
+	return match(pattern, str, nocase, &skipLongerMatches, 0)
+}
+
+// redis bails out of patterns nested this deep to avoid a stack overflow
+const maxNesting = 1000
+
+func match(pattern, str string, nocase bool, skipLongerMatches *bool, nesting int) bool {
+	if nesting > maxNesting {
+		return false
+	}
+
+	for len(pattern) > 0 && len(str) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for len(str) > 0 {
+				if match(pattern[1:], str, nocase, skipLongerMatches, nesting+1) {
+					return true
+				}
+				// if the rest failed against the whole string, a shorter
+				// one can not match either
+				if *skipLongerMatches {
+					return false
+				}
+				str = str[1:]
+			}
+			*skipLongerMatches = true
+			return false
+		case '?':
+			str = str[1:]
+		case '[':
+			pattern = pattern[1:]
+			not := len(pattern) > 0 && pattern[0] == '^'
+			if not {
+				pattern = pattern[1:]
+			}
+
+			matched := false
+			for {
+				if len(pattern) == 0 {
+					break
+				}
+				if pattern[0] == '\\' && len(pattern) >= 2 {
+					pattern = pattern[1:]
+					if pattern[0] == str[0] {
+						matched = true
+					}
+				} else if pattern[0] == ']' {
+					break
+				} else if len(pattern) >= 3 && pattern[1] == '-' {
+					start, end := pattern[0], pattern[2]
+					if start > end {
+						start, end = end, start
+					}
+					c := str[0]
+					if nocase {
+						start, end, c = lower(start), lower(end), lower(c)
+					}
+					pattern = pattern[2:]
+					if c >= start && c <= end {
+						matched = true
+					}
+				} else if equal(pattern[0], str[0], nocase) {
+					matched = true
+				}
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				// an unterminated class still consumed the pattern
+				pattern = "]"
+			}
+			if not {
+				matched = !matched
+			}
+			if !matched {
+				return false
+			}
+			str = str[1:]
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if !equal(pattern[0], str[0], nocase) {
+				return false
+			}
+			str = str[1:]
+		}
+
+		pattern = pattern[1:]
+	}
+
+	// trailing stars match the empty rest of the string
+	if len(str) == 0 {
+		for len(pattern) > 0 && pattern[0] == '*' {
+			pattern = pattern[1:]
+		}
+	}
+	return len(pattern) == 0 && len(str) == 0
+}
+
+func equal(a, b byte, nocase bool) bool {
+	if nocase {
+		return lower(a) == lower(b)
+	}
+	return a == b
+}
+
+func lower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + ('a' - 'A')
+	}
+	return c
+}
@@ -0,0 +1,530 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/command"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/config"
+	redisfileparser "github.com/codecrafters-io/redis-starter-go/app/pkg/redis-file-parser"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/response"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/storage"
+)
+
+var ErrRewriteInProgress = errors.New("Background append only file rewriting already in progress")
+
+// rewriteStage is called after each step of a rewrite that leaves other
+// files on disk, the tests crash the process there
+var rewriteStage = func(stage string) {}
+
+// AOF logs the write commands to the append only file. Commands are
+// appended to a buffer under the locks of their keys, so the file has
+// them in the order they changed the keyspace, and the buffer is written
+// out before their replies are sent, like beforeSleep of redis does.
+//
+// The AOF has several parts like in redis 7, a base file and incr files
+// listed in a manifest. A rewrite starts a snapshot of the keyspace and
+// switches to a new incr file at the same point in time, with every shard
+// locked. The writes that come while the snapshot is saved as the new base
+// go to the new incr file, so the old files stay complete until the
+// manifest drops them.
+type AOF struct {
+	dir     string
+	storage storage.StorageInterface
+
+	mu       sync.Mutex
+	manifest *aofManifest
+	// file is the last incr file, nil while the AOF is off
+	file   *os.File
+	fsync  string
+	buf    []byte
+	synced time.Time
+	// lastWriteOK is false while the last write to the file failed, the
+	// commands stay in the buffer until a write works again
+	lastWriteOK bool
+
+	// currentSize is the size of all the files, baseSize what it was after
+	// the last rewrite, the growth between them triggers the next one
+	currentSize       int64
+	baseSize          int64
+	rewritePercentage int64
+	rewriteMinSize    int64
+
+	rewriting      bool
+	rewriteStarted time.Time
+	lastRewriteOK  bool
+	// lastRewriteDuration is -1 before the first rewrite
+	lastRewriteDuration time.Duration
+
+	// writeMu keeps the writes of concurrent flushes in buffer order
+	writeMu sync.Mutex
+}
+
+// AOFStatus is what INFO persistence reports
+type AOFStatus struct {
+	Enabled     bool
+	LastWriteOK bool
+	Rewriting   bool
+	// the durations are -1 when there is no such rewrite
+	LastRewriteOK          bool
+	LastRewriteDuration    time.Duration
+	CurrentRewriteDuration time.Duration
+	CurrentSize            int64
+	BaseSize               int64
+}
+
+func NewAOF(dir string, storage storage.StorageInterface, fsync string) *AOF {
+	return &AOF{
+		dir:                 dir,
+		storage:             storage,
+		fsync:               fsync,
+		lastWriteOK:         true,
+		lastRewriteOK:       true,
+		lastRewriteDuration: -1,
+	}
+}
+
+// Start opens the last incr file for appending, commands are logged from
+// then on. Without a manifest the AOF starts with the keyspace as its base
+// so it holds everything loaded from the RDB file as well.
+func (a *AOF) Start() error {
+	if err := os.MkdirAll(a.dir, 0755); err != nil {
+		return err
+	}
+	removeTempFiles(a.dir)
+
+	manifest, err := loadManifest(a.dir)
+	changed := false
+	if errors.Is(err, os.ErrNotExist) {
+		manifest = &aofManifest{}
+		base := manifest.nextBase()
+		if err := a.writeBase(base, a.snapshot()); err != nil {
+			return err
+		}
+		manifest.base = &base
+		changed = true
+	} else if err != nil {
+		return err
+	}
+
+	history := manifest.history
+	manifest.history = nil
+	if len(manifest.incrs) == 0 {
+		manifest.nextIncr()
+		changed = true
+	}
+	incr := manifest.incrs[len(manifest.incrs)-1]
+	file, err := os.OpenFile(filepath.Join(a.dir, incr.name), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if changed || len(history) > 0 {
+		if err := manifest.persist(a.dir); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	a.deleteFiles(history)
+
+	size := a.filesSize(manifest.files())
+	a.mu.Lock()
+	a.manifest = manifest
+	a.file = file
+	a.synced = time.Now()
+	a.currentSize = size
+	a.baseSize = size
+	a.mu.Unlock()
+	go a.cron()
+	return nil
+}
+
+// Enabled is true once the AOF was started
+func (a *AOF) Enabled() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.file != nil
+}
+
+// Append logs commands, they are written together so a transaction is
+// never split by the commands of other clients. It is called with the
+// locks of the keys the commands changed held.
+func (a *AOF) Append(commands ...*command.Command) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return
+	}
+	for _, cmd := range commands {
+		a.buf = encodeCommand(a.buf, cmd)
+	}
+}
+
+// Flush writes what was appended so far, with appendfsync always it is
+// on disk when Flush returns
+func (a *AOF) Flush() {
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+
+	a.mu.Lock()
+	file, buf, fsync := a.file, a.buf, a.fsync
+	a.buf = nil
+	a.mu.Unlock()
+	if len(buf) == 0 {
+		return
+	}
+
+	n, err := file.Write(buf)
+	if err == nil && fsync == config.FsyncAlways {
+		err = file.Sync()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.currentSize += int64(n)
+	if err == nil {
+		a.lastWriteOK = true
+		if fsync == config.FsyncAlways {
+			a.synced = time.Now()
+		}
+		return
+	}
+
+	if fsync == config.FsyncAlways {
+		// the reply would promise data that may not be on disk
+		fmt.Printf("Can't recover from AOF write error when the AOF fsync policy is 'always': %v. Exiting...\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Error writing to the AOF file: %v\n", err)
+	a.lastWriteOK = false
+	// what did not make it is written again before anything newer
+	a.buf = append(buf[n:], a.buf...)
+}
+
+// BackgroundRewrite copies the keyspace and saves it as the new base on
+// its own goroutine, the point in time it saves is taken before it
+// returns. With the AOF off the base and the manifest are written all the
+// same.
+func (a *AOF) BackgroundRewrite() error {
+	a.mu.Lock()
+	if a.rewriting {
+		a.mu.Unlock()
+		return ErrRewriteInProgress
+	}
+	a.rewriting = true
+	a.rewriteStarted = time.Now()
+	a.mu.Unlock()
+
+	var snapshot *storage.Snapshot
+	var firstIncr int64
+	var err error
+	a.storage.AtomicAll(func() {
+		if firstIncr, err = a.switchIncr(); err == nil {
+			snapshot = a.storage.StartSnapshot()
+		}
+	})
+	if err != nil {
+		fmt.Printf("Error starting the AOF rewrite: %v\n", err)
+		a.rewriteDone(false)
+		return err
+	}
+
+	go a.rewrite(snapshot, firstIncr)
+	return nil
+}
+
+// switchIncr writes out the buffer and opens the next incr file, the
+// locks of every key are held so the buffer has exactly the writes that
+// came before the snapshot. It returns the first incr file the new base does
+// not include.
+func (a *AOF) switchIncr() (int64, error) {
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return 0, nil
+	}
+
+	n, err := a.file.Write(a.buf)
+	a.currentSize += int64(n)
+	a.buf = a.buf[n:]
+	if err == nil {
+		err = a.file.Sync()
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	manifest := a.manifest.clone()
+	incr := manifest.nextIncr()
+	file, err := os.OpenFile(filepath.Join(a.dir, incr.name), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+	if err := manifest.persist(a.dir); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return 0, err
+	}
+
+	a.file.Close()
+	a.file = file
+	a.synced = time.Now()
+	a.manifest = manifest
+	return incr.seq, nil
+}
+
+// rewrite saves the snapshot as the new base, the manifest then lists it
+// with the incr files from firstIncr on and the older files go away
+func (a *AOF) rewrite(snapshot *storage.Snapshot, firstIncr int64) {
+	rewriteStage("switched")
+	err := a.installBase(snapshot.Copy(), firstIncr)
+	if err != nil {
+		fmt.Printf("Error rewriting the AOF: %v\n", err)
+	} else {
+		fmt.Println("Background AOF rewrite finished successfully")
+	}
+	a.rewriteDone(err == nil)
+}
+
+func (a *AOF) installBase(snapshot map[string]storage.Data, firstIncr int64) error {
+	if err := os.MkdirAll(a.dir, 0755); err != nil {
+		return err
+	}
+	manifest, err := a.currentManifest()
+	if err != nil {
+		return err
+	}
+	base := manifest.clone().nextBase()
+	if err := a.writeBase(base, snapshot); err != nil {
+		return err
+	}
+	rewriteStage("base")
+
+	// incr files opened meanwhile are only in the current manifest, it is
+	// taken again with the writes stopped
+	a.writeMu.Lock()
+	a.mu.Lock()
+	if a.manifest != nil {
+		manifest = a.manifest
+	}
+	next := manifest.clone()
+	next.baseSeq = base.seq
+	if next.base != nil {
+		next.history = append(next.history, *next.base)
+	}
+	next.base = &base
+	next.incrs = nil
+	for _, incr := range manifest.incrs {
+		if firstIncr > 0 && incr.seq >= firstIncr {
+			next.incrs = append(next.incrs, incr)
+		} else {
+			next.history = append(next.history, incr)
+		}
+	}
+	err = next.persist(a.dir)
+	if err == nil && a.manifest != nil {
+		a.manifest = next
+	}
+	a.mu.Unlock()
+	a.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+	rewriteStage("manifest")
+
+	// the history leaves the manifest once its files are deleted, a crash
+	// in between deletes them on the next start
+	a.deleteFiles(next.history)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	next.history = nil
+	if err := next.persist(a.dir); err != nil {
+		return err
+	}
+	size := a.filesSize(next.files())
+	a.currentSize = size
+	a.baseSize = size
+	return nil
+}
+
+// currentManifest is the manifest in use, with the AOF off it is the one
+// on disk as the rewrite replaces that all the same
+func (a *AOF) currentManifest() (*aofManifest, error) {
+	a.mu.Lock()
+	manifest := a.manifest
+	a.mu.Unlock()
+	if manifest != nil {
+		return manifest, nil
+	}
+
+	manifest, err := loadManifest(a.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return &aofManifest{}, nil
+	}
+	return manifest, err
+}
+
+func (a *AOF) rewriteDone(ok bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rewriting = false
+	a.lastRewriteOK = ok
+	a.lastRewriteDuration = time.Since(a.rewriteStarted)
+}
+
+// rewriteDue is the auto-aof-rewrite-percentage and min-size check of the
+// cron of redis
+func (a *AOF) rewriteDue(now time.Time) (int64, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil || a.rewriting || a.rewritePercentage == 0 || a.currentSize <= a.rewriteMinSize {
+		return 0, false
+	}
+	// after a failure only retry once in a while
+	if !a.lastRewriteOK && now.Sub(a.rewriteStarted) <= saveRetryDelay {
+		return 0, false
+	}
+
+	base := max(a.baseSize, 1)
+	growth := a.currentSize*100/base - 100
+	return growth, growth >= a.rewritePercentage
+}
+
+func (a *AOF) Fsync() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.fsync
+}
+
+func (a *AOF) SetFsync(fsync string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.fsync = fsync
+}
+
+// AutoRewrite is auto-aof-rewrite-percentage and auto-aof-rewrite-min-size
+func (a *AOF) AutoRewrite() (int64, int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.rewritePercentage, a.rewriteMinSize
+}
+
+func (a *AOF) SetAutoRewrite(percentage, minSize int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rewritePercentage = percentage
+	a.rewriteMinSize = minSize
+}
+
+func (a *AOF) Status() AOFStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	status := AOFStatus{
+		Enabled:                a.file != nil,
+		LastWriteOK:            a.lastWriteOK,
+		Rewriting:              a.rewriting,
+		LastRewriteOK:          a.lastRewriteOK,
+		LastRewriteDuration:    a.lastRewriteDuration,
+		CurrentRewriteDuration: -1,
+		CurrentSize:            a.currentSize,
+		BaseSize:               a.baseSize,
+	}
+	if a.rewriting {
+		status.CurrentRewriteDuration = time.Since(a.rewriteStarted)
+	}
+	return status
+}
+
+// cron runs once a second, it retries failed writes, syncs the file with
+// appendfsync everysec and starts the automatic rewrites
+func (a *AOF) cron() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		a.Flush()
+		a.syncIfDue()
+
+		if growth, ok := a.rewriteDue(now); ok {
+			fmt.Printf("Starting automatic rewriting of AOF on %d%% growth\n", growth)
+			a.BackgroundRewrite()
+		}
+	}
+}
+
+func (a *AOF) syncIfDue() {
+	// the incr file does not change while writeMu is held
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+	a.mu.Lock()
+	file, due := a.file, a.fsync == config.FsyncEverySec && time.Since(a.synced) >= time.Second
+	a.mu.Unlock()
+	if !due {
+		return
+	}
+
+	if err := file.Sync(); err != nil {
+		fmt.Printf("Error syncing the AOF file: %v\n", err)
+		return
+	}
+	a.mu.Lock()
+	a.synced = time.Now()
+	a.mu.Unlock()
+}
+
+func (a *AOF) snapshot() map[string]storage.Data {
+	var snapshot *storage.Snapshot
+	a.storage.AtomicAll(func() {
+		snapshot = a.storage.StartSnapshot()
+	})
+	return snapshot.Copy()
+}
+
+// writeBase saves the keyspace as an RDB base file
+func (a *AOF) writeBase(base aofInfo, data map[string]storage.Data) error {
+	return writeFileAtomic(filepath.Join(a.dir, base.name), func(file *os.File) error {
+		return redisfileparser.NewRedisFileWriter(file).ForAOF().Write(data)
+	})
+}
+
+func (a *AOF) deleteFiles(files []aofInfo) {
+	for _, info := range files {
+		if err := os.Remove(filepath.Join(a.dir, info.name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Printf("Error deleting the AOF history file %s: %v\n", info.name, err)
+		}
+	}
+}
+
+func (a *AOF) filesSize(files []aofInfo) int64 {
+	size := int64(0)
+	for _, info := range files {
+		if stat, err := os.Stat(filepath.Join(a.dir, info.name)); err == nil {
+			size += stat.Size()
+		}
+	}
+	return size
+}
+
+// removeTempFiles cleans up after a crash in the middle of a rewrite,
+// no manifest ever lists the temporary files
+func removeTempFiles(dir string) {
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "temp-") {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
+
+// encodeCommand appends the command as the RESP array clients send
+func encodeCommand(buf []byte, cmd *command.Command) []byte {
+	args := make([]string, 0, len(cmd.Args)+1)
+	args = append(args, cmd.Name)
+	args = append(args, cmd.Args...)
+	return response.NewBulkStringArray(args).Encode(buf, response.ProtocolRESP2)
+}
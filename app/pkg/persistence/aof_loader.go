@@ -0,0 +1,187 @@
+package persistence
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/command"
+	redisfileparser "github.com/codecrafters-io/redis-starter-go/app/pkg/redis-file-parser"
+	redisparser "github.com/codecrafters-io/redis-starter-go/app/pkg/redis-parser"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/storage"
+)
+
+// AOFLoader reads a multi part AOF back, first the RDB preamble of the
+// base file and then the commands of the base and of the incr files
+type AOFLoader struct {
+	dir           string
+	manifest      *aofManifest
+	loadTruncated bool
+	// base is open from LoadPreamble on, Replay goes on where it stopped
+	base *aofFile
+}
+
+// aofFile is one file being loaded, it counts what was read so the end of
+// the last complete command is known
+type aofFile struct {
+	path    string
+	file    *os.File
+	counter *countingReader
+	reader  *bufio.Reader
+}
+
+// NewAOFLoader reads the manifest of dir, os.ErrNotExist when there is none
+func NewAOFLoader(dir string, loadTruncated bool) (*AOFLoader, error) {
+	manifest, err := loadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &AOFLoader{dir: dir, manifest: manifest, loadTruncated: loadTruncated}, nil
+}
+
+func openAOFFile(path string) (*aofFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	counter := &countingReader{reader: file}
+	return &aofFile{path: path, file: file, counter: counter, reader: bufio.NewReader(counter)}, nil
+}
+
+// LoadPreamble returns the keys of the RDB preamble of the base file, none
+// when there is no base or it only has commands
+func (l *AOFLoader) LoadPreamble() (map[string]storage.Data, error) {
+	if l.manifest.base == nil {
+		return map[string]storage.Data{}, nil
+	}
+	base, err := openAOFFile(filepath.Join(l.dir, l.manifest.base.name))
+	if err != nil {
+		return nil, err
+	}
+	l.base = base
+
+	signature, err := base.reader.Peek(5)
+	if err != nil || string(signature) != "REDIS" {
+		return map[string]storage.Data{}, nil
+	}
+
+	fmt.Printf("Reading RDB base file on AOF loading...\n")
+	_, data, err := redisfileparser.NewRedisFileParserFromReader(base.reader).Parse()
+	if err != nil {
+		return nil, fmt.Errorf("bad RDB preamble in the append only file %s: %w", base.path, err)
+	}
+	return data, nil
+}
+
+// Replay runs every command of the files in order. Only the last file may
+// be cut short in the middle of a command or of a transaction, it is
+// truncated to the last complete one when aof-load-truncated allows it.
+func (l *AOFLoader) Replay(run func(*command.Command) error) error {
+	files := l.manifest.files()
+	loaded := 0
+	for i, info := range files {
+		file := l.base
+		if i > 0 || file == nil {
+			var err error
+			if file, err = openAOFFile(filepath.Join(l.dir, info.name)); err != nil {
+				return err
+			}
+		}
+
+		count, err := file.replay(run, i == len(files)-1 && l.loadTruncated)
+		if err != nil {
+			return err
+		}
+		loaded += count
+	}
+	fmt.Printf("DB loaded from append only file: %d commands\n", loaded)
+	return nil
+}
+
+// replay runs the commands of one file, loadTruncated is whether a file
+// cut short may be truncated
+func (f *aofFile) replay(run func(*command.Command) error, loadTruncated bool) (int, error) {
+	defer f.file.Close()
+
+	reader := redisparser.NewReader(f.reader)
+	offset := func() int64 {
+		return f.counter.read - int64(f.reader.Buffered()) - int64(reader.Buffered())
+	}
+
+	// valid is where the last complete command ends, beforeMulti where
+	// the open transaction started and loadedBeforeMulti what was loaded
+	// until then
+	valid := offset()
+	beforeMulti := int64(-1)
+	loaded, loadedBeforeMulti := 0, 0
+	for {
+		cmd, err := reader.ReadCommand()
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return f.truncated(loadTruncated, valid, beforeMulti, loaded, loadedBeforeMulti)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("bad file format reading the append only file %s: %w", f.path, err)
+		}
+		if cmd.Name == "" {
+			continue
+		}
+
+		switch strings.ToLower(cmd.Name) {
+		case "multi":
+			beforeMulti, loadedBeforeMulti = valid, loaded
+		case "exec":
+			beforeMulti = -1
+		}
+		if err := run(cmd); err != nil {
+			return 0, fmt.Errorf("%w reading the append only file %s", err, f.path)
+		}
+		valid = offset()
+		loaded++
+	}
+
+	if beforeMulti >= 0 {
+		return f.truncated(loadTruncated, valid, beforeMulti, loaded, loadedBeforeMulti)
+	}
+	return loaded, nil
+}
+
+// truncated handles a file that ends before its last command or
+// transaction does, what was replayed of a transaction never ran since
+// its EXEC is missing
+func (f *aofFile) truncated(loadTruncated bool, valid, beforeMulti int64, loaded, loadedBeforeMulti int) (int, error) {
+	if !loadTruncated {
+		return 0, fmt.Errorf("unexpected end of file reading the append only file %s. Make a backup of it and truncate the last command, or set aof-load-truncated to yes if it is the last file", f.path)
+	}
+
+	if beforeMulti >= 0 {
+		fmt.Println("!!! Warning: the append only file ends inside a MULTI/EXEC transaction, it is reverted !!!")
+		valid, loaded = beforeMulti, loadedBeforeMulti
+	} else {
+		fmt.Printf("!!! Warning: short read while loading the AOF file %s !!!\n", f.path)
+	}
+	if err := os.Truncate(f.path, valid); err != nil {
+		return 0, fmt.Errorf("error truncating the append only file %s: %w", f.path, err)
+	}
+	fmt.Printf("AOF %s loaded anyway because aof-load-truncated is enabled, truncated to %d bytes\n", f.path, valid)
+	return loaded, nil
+}
+
+// countingReader counts the bytes read from the file, the buffered ones
+// are subtracted to know where a command ends
+type countingReader struct {
+	reader io.Reader
+	read   int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.read += int64(n)
+	return n, err
+}
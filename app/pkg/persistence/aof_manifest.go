@@ -0,0 +1,239 @@
+package persistence
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/config"
+)
+
+// the types of the files in the manifest
+const (
+	aofBase    = 'b'
+	aofIncr    = 'i'
+	aofHistory = 'h'
+)
+
+const manifestName = config.AppendFilename + ".manifest"
+
+// aofInfo is one line of the manifest
+type aofInfo struct {
+	name string
+	seq  int64
+	kind byte
+}
+
+// aofManifest lists the files of a multi part AOF like redis 7 keeps it.
+// The base file has the keyspace of the last rewrite, the incr files the
+// commands since, in order. History files are left over from a rewrite
+// and deleted once the manifest without them is on disk.
+type aofManifest struct {
+	base    *aofInfo
+	incrs   []aofInfo
+	history []aofInfo
+	// the last sequence numbers handed out
+	baseSeq int64
+	incrSeq int64
+}
+
+var errBadManifest = errors.New("invalid AOF manifest file format")
+
+// loadManifest reads the manifest of dir, os.ErrNotExist when there is none
+func loadManifest(dir string) (*aofManifest, error) {
+	content, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &aofManifest{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		// file <name> seq <seq> type <type>, in any order after the name
+		fields := strings.Fields(line)
+		if len(fields)%2 != 0 || fields[0] != "file" {
+			return nil, errBadManifest
+		}
+		info := aofInfo{name: fields[1]}
+		for i := 2; i < len(fields); i += 2 {
+			switch fields[i] {
+			case "seq":
+				if info.seq, err = strconv.ParseInt(fields[i+1], 10, 64); err != nil || info.seq < 1 {
+					return nil, errBadManifest
+				}
+			case "type":
+				if len(fields[i+1]) != 1 {
+					return nil, errBadManifest
+				}
+				info.kind = fields[i+1][0]
+			}
+		}
+		if info.seq == 0 || strings.ContainsAny(info.name, "/\\") {
+			return nil, errBadManifest
+		}
+
+		switch info.kind {
+		case aofBase:
+			if manifest.base != nil {
+				return nil, fmt.Errorf("%w, found more than one base file", errBadManifest)
+			}
+			manifest.base = &info
+			manifest.baseSeq = info.seq
+		case aofIncr:
+			if info.seq <= manifest.incrSeq {
+				return nil, fmt.Errorf("%w, incr files are out of order", errBadManifest)
+			}
+			manifest.incrs = append(manifest.incrs, info)
+			manifest.incrSeq = info.seq
+		case aofHistory:
+			manifest.history = append(manifest.history, info)
+		default:
+			return nil, errBadManifest
+		}
+	}
+	return manifest, scanner.Err()
+}
+
+// files are the files to load, in the order they are loaded
+func (m *aofManifest) files() []aofInfo {
+	files := []aofInfo{}
+	if m.base != nil {
+		files = append(files, *m.base)
+	}
+	return append(files, m.incrs...)
+}
+
+func (m *aofManifest) clone() *aofManifest {
+	clone := *m
+	if m.base != nil {
+		base := *m.base
+		clone.base = &base
+	}
+	clone.incrs = append([]aofInfo{}, m.incrs...)
+	clone.history = append([]aofInfo{}, m.history...)
+	return &clone
+}
+
+// nextIncr adds a new incr file, the one appended to from then on
+func (m *aofManifest) nextIncr() aofInfo {
+	m.incrSeq++
+	info := aofInfo{name: fmt.Sprintf("%s.%d.incr.aof", config.AppendFilename, m.incrSeq), seq: m.incrSeq, kind: aofIncr}
+	m.incrs = append(m.incrs, info)
+	return info
+}
+
+// nextBase names the base file of a rewrite
+func (m *aofManifest) nextBase() aofInfo {
+	m.baseSeq++
+	return aofInfo{name: fmt.Sprintf("%s.%d.base.rdb", config.AppendFilename, m.baseSeq), seq: m.baseSeq, kind: aofBase}
+}
+
+func (m *aofManifest) encode() []byte {
+	var buf bytes.Buffer
+	line := func(info aofInfo, kind byte) {
+		fmt.Fprintf(&buf, "file %s seq %d type %c\n", info.name, info.seq, kind)
+	}
+	if m.base != nil {
+		line(*m.base, aofBase)
+	}
+	for _, info := range m.history {
+		line(info, aofHistory)
+	}
+	for _, info := range m.incrs {
+		line(info, aofIncr)
+	}
+	return buf.Bytes()
+}
+
+// persist replaces the manifest of dir, what is on disk is always either
+// the old or the new one
+func (m *aofManifest) persist(dir string) error {
+	return writeFileAtomic(filepath.Join(dir, manifestName), func(file *os.File) error {
+		_, err := file.Write(m.encode())
+		return err
+	})
+}
+
+// writeFileAtomic writes a file under a temporary name and renames it
+// over path once it is synced, the directory is synced after that so the
+// rename survives a crash as well
+func writeFileAtomic(path string, write func(file *os.File) error) error {
+	dir := filepath.Dir(path)
+	file, err := os.CreateTemp(dir, "temp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
+
+// UpgradeAOF moves the single file AOF of older versions into dir as the
+// base of a multi part AOF. The manifest is written first so a crash in
+// between is finished on the next start.
+func UpgradeAOF(dir, path string) error {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	name := filepath.Base(path)
+	manifest, err := loadManifest(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		manifest = &aofManifest{base: &aofInfo{name: name, seq: 1, kind: aofBase}, baseSeq: 1}
+		if err := manifest.persist(dir); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	// an old file that is not the base of the manifest is not ours to move
+	if manifest.base == nil || manifest.base.name != name {
+		return nil
+	}
+
+	if err := os.Rename(path, filepath.Join(dir, name)); err != nil {
+		return err
+	}
+	fmt.Printf("Successfully migrated an old-style AOF into the AOF directory %s\n", dir)
+	return syncDir(filepath.Dir(path))
+}
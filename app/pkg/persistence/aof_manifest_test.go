@@ -0,0 +1,173 @@
+package persistence
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeManifest(t *testing.T, content string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, manifestName), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestLoadManifest(t *testing.T) {
+	dir := writeManifest(t, strings.Join([]string{
+		"# written by hand",
+		"file appendonly.aof.3.base.rdb seq 3 type b",
+		"",
+		"file appendonly.aof.2.base.rdb type h seq 2",
+		"  file appendonly.aof.4.incr.aof seq 4 type i  ",
+		"file appendonly.aof.5.incr.aof seq 5 type i",
+	}, "\n"))
+
+	manifest, err := loadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.base == nil || manifest.base.name != "appendonly.aof.3.base.rdb" || manifest.baseSeq != 3 {
+		t.Fatalf("the base is %+v", manifest.base)
+	}
+	if len(manifest.history) != 1 || manifest.history[0].seq != 2 {
+		t.Fatalf("the history is %+v", manifest.history)
+	}
+	if len(manifest.incrs) != 2 || manifest.incrSeq != 5 {
+		t.Fatalf("the incr files are %+v", manifest.incrs)
+	}
+
+	files := manifest.files()
+	names := []string{}
+	for _, info := range files {
+		names = append(names, info.name)
+	}
+	if want := "appendonly.aof.3.base.rdb appendonly.aof.4.incr.aof appendonly.aof.5.incr.aof"; strings.Join(names, " ") != want {
+		t.Fatalf("the files loaded are %v, want %s", names, want)
+	}
+}
+
+func TestLoadManifestErrors(t *testing.T) {
+	manifests := map[string]string{
+		"two bases":          "file a seq 1 type b\nfile b seq 2 type b\n",
+		"incrs out of order": "file a seq 2 type i\nfile b seq 1 type i\n",
+		"unknown type":       "file a seq 1 type x\n",
+		"no type":            "file a seq 1\n",
+		"no seq":             "file a type i\n",
+		"bad seq":            "file a seq zero type i\n",
+		"odd fields":         "file a seq 1 type\n",
+		"not a file":         "base a seq 1 type b\n",
+		"path in the name":   "file ../a seq 1 type i\n",
+	}
+	for name, content := range manifests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := loadManifest(writeManifest(t, content)); !errors.Is(err, errBadManifest) {
+				t.Fatalf("loading %q returned %v", content, err)
+			}
+		})
+	}
+
+	if _, err := loadManifest(t.TempDir()); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("loading a missing manifest returned %v", err)
+	}
+}
+
+func TestManifestPersist(t *testing.T) {
+	dir := t.TempDir()
+	manifest := &aofManifest{}
+	base := manifest.nextBase()
+	manifest.base = &base
+	manifest.nextIncr()
+	manifest.nextIncr()
+	manifest.history = []aofInfo{{name: "appendonly.aof.0.incr.aof", seq: 7, kind: aofIncr}}
+
+	if err := manifest.persist(dir); err != nil {
+		t.Fatal(err)
+	}
+	want := "file appendonly.aof.1.base.rdb seq 1 type b\n" +
+		"file appendonly.aof.0.incr.aof seq 7 type h\n" +
+		"file appendonly.aof.1.incr.aof seq 1 type i\n" +
+		"file appendonly.aof.2.incr.aof seq 2 type i\n"
+	content, _ := os.ReadFile(filepath.Join(dir, manifestName))
+	if string(content) != want {
+		t.Fatalf("the manifest is\n%s\nwant\n%s", content, want)
+	}
+
+	loaded, err := loadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(loaded.encode()) != want {
+		t.Fatalf("the manifest loads as\n%s", loaded.encode())
+	}
+	if next := loaded.nextIncr(); next.name != "appendonly.aof.3.incr.aof" {
+		t.Fatalf("the next incr file is %s", next.name)
+	}
+	if next := loaded.nextBase(); next.name != "appendonly.aof.2.base.rdb" {
+		t.Fatalf("the next base file is %s", next.name)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("persisting left %d files, want only the manifest", len(entries))
+	}
+}
+
+func TestManifestClone(t *testing.T) {
+	manifest := &aofManifest{}
+	base := manifest.nextBase()
+	manifest.base = &base
+	manifest.nextIncr()
+
+	clone := manifest.clone()
+	clone.base.name = "changed"
+	clone.nextIncr()
+	clone.incrs[0].name = "changed"
+	if manifest.base.name == "changed" || len(manifest.incrs) != 1 || manifest.incrs[0].name == "changed" || manifest.incrSeq != 1 {
+		t.Fatal("changing the clone changed the manifest")
+	}
+}
+
+func TestUpgradeAOF(t *testing.T) {
+	parent := t.TempDir()
+	path := filepath.Join(parent, "appendonly.aof")
+	dir := filepath.Join(parent, "appendonlydir")
+	if err := os.WriteFile(path, []byte("*1\r\n$4\r\nPING\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := UpgradeAOF(dir, path); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := loadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.base == nil || manifest.base.name != "appendonly.aof" || len(manifest.incrs) != 0 {
+		t.Fatalf("the manifest is\n%s", manifest.encode())
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("the old file is still there")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "appendonly.aof")); err != nil {
+		t.Fatalf("the old file was not moved: %v", err)
+	}
+
+	// a crash after the manifest was written is finished on the next start
+	os.Rename(filepath.Join(dir, "appendonly.aof"), path)
+	if err := UpgradeAOF(dir, path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "appendonly.aof")); err != nil {
+		t.Fatalf("the interrupted upgrade was not finished: %v", err)
+	}
+
+	// without an old file there is nothing to do
+	if err := UpgradeAOF(dir, path); err != nil {
+		t.Fatal(err)
+	}
+}
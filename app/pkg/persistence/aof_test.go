@@ -0,0 +1,206 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/command"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/config"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/storage"
+)
+
+const (
+	crashDirEnv   = "AOF_CRASH_DIR"
+	crashStageEnv = "AOF_CRASH_STAGE"
+	// keys written before the rewrite and at each of its stages
+	crashKeys = 100
+)
+
+// the stages of a rewrite in the order they come
+var rewriteStages = []string{"switched", "base", "manifest"}
+
+// set is a SET the way the command handler runs it, logged under the lock
+// of the key and on disk before it returns like the reply would be
+func set(s storage.StorageInterface, aof *AOF, key string) {
+	s.Atomic([]string{key}, func() {
+		s.Set(key, "x", nil)
+		aof.Append(&command.Command{Name: "SET", Args: []string{key, "x"}})
+	})
+	aof.Flush()
+}
+
+// TestRewriteCrashProcess is the server TestRewriteCrash kills, it writes
+// keys before the rewrite and at every stage of it until the one it is
+// killed at
+func TestRewriteCrashProcess(t *testing.T) {
+	dir := os.Getenv(crashDirEnv)
+	if dir == "" {
+		t.Skip("only runs as the process of TestRewriteCrash")
+	}
+
+	s := storage.NewInMemoryStorage()
+	aof := NewAOF(dir, s, config.FsyncAlways)
+	if err := aof.Start(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < crashKeys; i++ {
+		set(s, aof, fmt.Sprintf("before:%d", i))
+	}
+
+	stage := os.Getenv(crashStageEnv)
+	rewriteStage = func(current string) {
+		for i := 0; i < crashKeys; i++ {
+			set(s, aof, fmt.Sprintf("%s:%d", current, i))
+		}
+		if current == stage {
+			process, _ := os.FindProcess(os.Getpid())
+			process.Kill()
+			select {}
+		}
+	}
+	if err := aof.BackgroundRewrite(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Second)
+	t.Fatalf("the process was not killed at %s", stage)
+}
+
+// A process killed at any point of a rewrite loads every write it
+// acknowledged, and its next start cleans up what the rewrite left
+func TestRewriteCrash(t *testing.T) {
+	for i, stage := range rewriteStages {
+		t.Run(stage, func(t *testing.T) {
+			dir := t.TempDir()
+			process := exec.Command(os.Args[0], "-test.run=^TestRewriteCrashProcess$")
+			process.Env = append(os.Environ(), crashDirEnv+"="+dir, crashStageEnv+"="+stage)
+			output, err := process.CombinedOutput()
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) || exitErr.Exited() {
+				t.Fatalf("the process was not killed: %v\n%s", err, output)
+			}
+
+			written := append([]string{"before"}, rewriteStages[:i+1]...)
+			checkLoaded(t, dir, written)
+
+			aof := NewAOF(dir, storage.NewInMemoryStorage(), config.FsyncAlways)
+			if err := aof.Start(); err != nil {
+				t.Fatalf("starting after the crash: %v", err)
+			}
+			aof.mu.Lock()
+			aof.file.Close()
+			aof.mu.Unlock()
+
+			manifest, err := loadManifest(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(manifest.history) > 0 {
+				t.Fatalf("the manifest still has history after a start: %s", manifest.encode())
+			}
+			listed := map[string]bool{manifestName: true}
+			for _, info := range manifest.files() {
+				listed[info.name] = true
+			}
+			entries, _ := os.ReadDir(dir)
+			for _, entry := range entries {
+				// a base written before the crash is left until the next
+				// rewrite writes over it
+				if !listed[entry.Name()] && !strings.HasSuffix(entry.Name(), ".base.rdb") {
+					t.Fatalf("%s is left in the AOF directory", entry.Name())
+				}
+			}
+			checkLoaded(t, dir, written)
+		})
+	}
+}
+
+// checkLoaded loads the AOF of dir and expects exactly the keys written
+// with the prefixes
+func checkLoaded(t *testing.T, dir string, prefixes []string) {
+	t.Helper()
+	loader, err := NewAOFLoader(dir, false)
+	if err != nil {
+		t.Fatalf("opening the AOF: %v", err)
+	}
+	data, err := loader.LoadPreamble()
+	if err != nil {
+		t.Fatalf("loading the base: %v", err)
+	}
+	keys := map[string]bool{}
+	for key := range data {
+		keys[key] = true
+	}
+	err = loader.Replay(func(cmd *command.Command) error {
+		if cmd.Name != "SET" {
+			return fmt.Errorf("unexpected %s", cmd.Name)
+		}
+		keys[cmd.Args[0]] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("replaying the AOF: %v", err)
+	}
+
+	for _, prefix := range prefixes {
+		for i := 0; i < crashKeys; i++ {
+			if key := fmt.Sprintf("%s:%d", prefix, i); !keys[key] {
+				t.Fatalf("%s was acknowledged but is not in the AOF", key)
+			}
+		}
+	}
+	if len(keys) != len(prefixes)*crashKeys {
+		t.Fatalf("the AOF has %d keys, want %d", len(keys), len(prefixes)*crashKeys)
+	}
+}
+
+// the files a rewrite leaves behind when it finishes
+func TestRewrite(t *testing.T) {
+	dir := t.TempDir()
+	s := storage.NewInMemoryStorage()
+	aof := NewAOF(dir, s, config.FsyncAlways)
+	if err := aof.Start(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < crashKeys; i++ {
+		set(s, aof, fmt.Sprintf("before:%d", i))
+	}
+	if err := aof.BackgroundRewrite(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < crashKeys; i++ {
+		set(s, aof, fmt.Sprintf("after:%d", i))
+	}
+	for deadline := time.Now().Add(5 * time.Second); aof.Status().Rewriting; {
+		if time.Now().After(deadline) {
+			t.Fatal("the rewrite did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !aof.Status().LastRewriteOK {
+		t.Fatal("the rewrite failed")
+	}
+
+	manifest, err := loadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "file appendonly.aof.2.base.rdb seq 2 type b\nfile appendonly.aof.2.incr.aof seq 2 type i\n"; string(manifest.encode()) != want {
+		t.Fatalf("the manifest is\n%s\nwant\n%s", manifest.encode(), want)
+	}
+	for _, name := range []string{"appendonly.aof.1.base.rdb", "appendonly.aof.1.incr.aof"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("%s was not deleted", name)
+		}
+	}
+
+	aof.mu.Lock()
+	aof.file.Close()
+	aof.mu.Unlock()
+	checkLoaded(t, dir, []string{"before", "after"})
+}
@@ -0,0 +1,230 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/config"
+	redisfileparser "github.com/codecrafters-io/redis-starter-go/app/pkg/redis-file-parser"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/storage"
+)
+
+const (
+	// savePointsHz is how often the save points are checked, the serverCron
+	// of redis runs at the same rate
+	savePointsHz = 10
+	// saveRetryDelay keeps a failing save from being retried in a loop
+	saveRetryDelay = 5 * time.Second
+)
+
+var ErrSaveInProgress = errors.New("Background save already in progress")
+
+// RDB saves the keyspace to its RDB file. There is no fork here, a save
+// starts a snapshot with every shard locked, which is the point in time
+// the file shows, and copies and writes it while the commands go on.
+type RDB struct {
+	path    string
+	storage storage.StorageInterface
+
+	// dirty counts the writes since the last save. Writes count it under
+	// the locks of their keys, so the snapshot of a save holds exactly the
+	// writes counted before it.
+	dirty atomic.Int64
+
+	mu    sync.Mutex
+	rules []config.SaveRule
+	// saving is set while a save writes, there is only one at a time
+	saving       bool
+	started      time.Time
+	dirtyAtStart int64
+	lastSave     time.Time
+	lastTry      time.Time
+	lastOK       bool
+	// lastDuration is how long the last background save took, -1 before
+	// the first one
+	lastDuration time.Duration
+}
+
+// RDBStatus is what INFO persistence reports
+type RDBStatus struct {
+	Changes    int64
+	InProgress bool
+	LastSave   time.Time
+	LastOK     bool
+	// the durations are -1 when there is no such save
+	LastDuration    time.Duration
+	CurrentDuration time.Duration
+}
+
+func NewRDB(path string, storage storage.StorageInterface, rules []config.SaveRule) *RDB {
+	return &RDB{
+		path:         path,
+		storage:      storage,
+		rules:        rules,
+		lastSave:     time.Now(),
+		lastOK:       true,
+		lastDuration: -1,
+	}
+}
+
+// Save writes the file and returns once it is on disk
+func (r *RDB) Save() error {
+	snapshot, err := r.start(false)
+	if err != nil {
+		return err
+	}
+	return r.write(snapshot, false)
+}
+
+// BackgroundSave copies the keyspace and writes it out on its own
+// goroutine, the point in time it saves is taken before it returns
+func (r *RDB) BackgroundSave() error {
+	snapshot, err := r.start(true)
+	if err != nil {
+		return err
+	}
+	go r.write(snapshot, true)
+	return nil
+}
+
+// AddDirty counts changes to the keyspace, it is called with the locks of
+// the changed keys held
+func (r *RDB) AddDirty(changes int64) {
+	r.dirty.Add(changes)
+}
+
+// ClearDirty forgets the changes counted so far, the writes replayed from
+// the AOF are not new
+func (r *RDB) ClearDirty() {
+	r.dirty.Store(0)
+}
+
+func (r *RDB) Rules() []config.SaveRule {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rules
+}
+
+func (r *RDB) SetRules(rules []config.SaveRule) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules = rules
+}
+
+// LastSave is when the file was last written successfully, the start of
+// the server until then
+func (r *RDB) LastSave() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastSave
+}
+
+func (r *RDB) InProgress() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.saving
+}
+
+func (r *RDB) Status() RDBStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := RDBStatus{
+		Changes:         r.dirty.Load(),
+		InProgress:      r.saving,
+		LastSave:        r.lastSave,
+		LastOK:          r.lastOK,
+		LastDuration:    r.lastDuration,
+		CurrentDuration: -1,
+	}
+	if r.saving {
+		status.CurrentDuration = time.Since(r.started)
+	}
+	return status
+}
+
+// StartSavePoints saves in the background whenever one of the rules is
+// met, enough changes and enough time since the last save
+func (r *RDB) StartSavePoints() {
+	go func() {
+		ticker := time.NewTicker(time.Second / savePointsHz)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			if rule, ok := r.dueRule(now); ok {
+				fmt.Printf("%d changes in %d seconds. Saving...\n", rule.Changes, rule.Seconds)
+				r.BackgroundSave()
+			}
+		}
+	}()
+}
+
+func (r *RDB) dueRule(now time.Time) (config.SaveRule, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.saving {
+		return config.SaveRule{}, false
+	}
+	// after a failure only retry once in a while
+	if !r.lastOK && now.Sub(r.lastTry) <= saveRetryDelay {
+		return config.SaveRule{}, false
+	}
+
+	dirty := r.dirty.Load()
+	for _, rule := range r.rules {
+		if dirty >= rule.Changes && now.Sub(r.lastSave) > time.Duration(rule.Seconds)*time.Second {
+			return rule, true
+		}
+	}
+	return config.SaveRule{}, false
+}
+
+func (r *RDB) start(background bool) (*storage.Snapshot, error) {
+	r.mu.Lock()
+	if r.saving {
+		r.mu.Unlock()
+		return nil, ErrSaveInProgress
+	}
+	r.saving = true
+	r.started = time.Now()
+	if background {
+		r.lastTry = r.started
+	}
+	r.mu.Unlock()
+
+	var snapshot *storage.Snapshot
+	var dirty int64
+	r.storage.AtomicAll(func() {
+		snapshot = r.storage.StartSnapshot()
+		dirty = r.dirty.Load()
+	})
+
+	r.mu.Lock()
+	r.dirtyAtStart = dirty
+	r.mu.Unlock()
+	return snapshot, nil
+}
+
+func (r *RDB) write(snapshot *storage.Snapshot, background bool) error {
+	err := redisfileparser.WriteRedisFile(r.path, snapshot.Copy())
+	if err != nil {
+		fmt.Printf("Error saving %s: %v\n", r.path, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.saving = false
+	if background {
+		r.lastDuration = time.Since(r.started)
+	}
+	if err == nil {
+		// writes that came after the snapshot still have to be saved
+		r.dirty.Add(-r.dirtyAtStart)
+		r.lastSave = time.Now()
+		r.lastOK = true
+	} else if background {
+		r.lastOK = false
+	}
+	return err
+}
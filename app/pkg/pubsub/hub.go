@@ -0,0 +1,160 @@
+package pubsub
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/client"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/glob"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/response"
+)
+
+// Hub routes published messages to the clients subscribed to the channel
+// and to the patterns matching it. Subscriptions are kept on both sides,
+// the hub indexes clients by channel and every client knows its own
+// channels and patterns. The subscription methods run on the goroutine of
+// the client they change.
+type Hub struct {
+	mu       sync.RWMutex
+	channels map[string]map[*client.Client]struct{}
+	patterns map[string]map[*client.Client]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		channels: make(map[string]map[*client.Client]struct{}),
+		patterns: make(map[string]map[*client.Client]struct{}),
+	}
+}
+
+// Subscribe is false when the client was subscribed already
+func (h *Hub) Subscribe(c *client.Client, channel string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return add(h.channels, c.Channels, c, channel)
+}
+
+// Unsubscribe is false when the client was not subscribed
+func (h *Hub) Unsubscribe(c *client.Client, channel string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return remove(h.channels, c.Channels, c, channel)
+}
+
+func (h *Hub) PSubscribe(c *client.Client, pattern string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return add(h.patterns, c.Patterns, c, pattern)
+}
+
+func (h *Hub) PUnsubscribe(c *client.Client, pattern string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return remove(h.patterns, c.Patterns, c, pattern)
+}
+
+// UnsubscribeAll drops every subscription of a client that went away
+func (h *Hub) UnsubscribeAll(c *client.Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for channel := range c.Channels {
+		remove(h.channels, c.Channels, c, channel)
+	}
+	for pattern := range c.Patterns {
+		remove(h.patterns, c.Patterns, c, pattern)
+	}
+}
+
+// Publish pushes message to the subscribers of channel and returns how
+// many received it, a client subscribed to the channel and to a matching
+// pattern counts twice like it receives it twice
+func (h *Hub) Publish(channel, message string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	receivers := 0
+	if subscribers, ok := h.channels[channel]; ok {
+		push := response.NewPush(
+			response.NewBulkString("message"),
+			response.NewBulkString(channel),
+			response.NewBulkString(message),
+		)
+		for subscriber := range subscribers {
+			if subscriber.Push(push) {
+				receivers++
+			}
+		}
+	}
+
+	for pattern, subscribers := range h.patterns {
+		if !glob.Match(pattern, channel, false) {
+			continue
+		}
+		push := response.NewPush(
+			response.NewBulkString("pmessage"),
+			response.NewBulkString(pattern),
+			response.NewBulkString(channel),
+			response.NewBulkString(message),
+		)
+		for subscriber := range subscribers {
+			if subscriber.Push(push) {
+				receivers++
+			}
+		}
+	}
+	return receivers
+}
+
+// Channels lists the channels with subscribers matching pattern, all of
+// them when it is empty
+func (h *Hub) Channels(pattern string) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	channels := []string{}
+	for channel := range h.channels {
+		if pattern == "" || glob.Match(pattern, channel, false) {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// NumSub counts the subscribers of channel, patterns are not counted
+func (h *Hub) NumSub(channel string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.channels[channel])
+}
+
+// NumPat counts the patterns anyone is subscribed to
+func (h *Hub) NumPat() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.patterns)
+}
+
+func add(index map[string]map[*client.Client]struct{}, own map[string]struct{}, c *client.Client, name string) bool {
+	if _, ok := own[name]; ok {
+		return false
+	}
+	own[name] = struct{}{}
+	if index[name] == nil {
+		index[name] = make(map[*client.Client]struct{})
+	}
+	index[name][c] = struct{}{}
+	return true
+}
+
+func remove(index map[string]map[*client.Client]struct{}, own map[string]struct{}, c *client.Client, name string) bool {
+	if _, ok := own[name]; !ok {
+		return false
+	}
+	delete(own, name)
+	delete(index[name], c)
+	if len(index[name]) == 0 {
+		delete(index, name)
+	}
+	return true
+}
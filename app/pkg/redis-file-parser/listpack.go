@@ -0,0 +1,202 @@
+package redisfileparser
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+// Listpacks are the compact encoding redis stores small containers and
+// stream nodes in, a header with the total size and element count, the
+// elements and a 0xFF terminator.
+// https://github.com/antirez/listpack/blob/master/listpack.md
+const (
+	listpackHeaderSize = 6
+	listpackEnd        = 0xFF
+)
+
+var errCorruptListpack = errors.New("corrupt listpack")
+
+type listpack struct {
+	buf   []byte
+	count int
+}
+
+func newListpack() *listpack {
+	return &listpack{buf: make([]byte, listpackHeaderSize, 256)}
+}
+
+func (l *listpack) appendInt(value int64) {
+	start := len(l.buf)
+	switch {
+	case value >= 0 && value <= 127:
+		l.buf = append(l.buf, byte(value))
+	case value >= -4096 && value <= 4095:
+		unsigned := uint64(value) & 0x1FFF
+		l.buf = append(l.buf, byte(unsigned>>8)|0xC0, byte(unsigned))
+	case value >= -32768 && value <= 32767:
+		l.buf = append(l.buf, 0xF1)
+		l.buf = binary.LittleEndian.AppendUint16(l.buf, uint16(value))
+	case value >= -8388608 && value <= 8388607:
+		unsigned := uint32(value)
+		l.buf = append(l.buf, 0xF2, byte(unsigned), byte(unsigned>>8), byte(unsigned>>16))
+	case value >= -2147483648 && value <= 2147483647:
+		l.buf = append(l.buf, 0xF3)
+		l.buf = binary.LittleEndian.AppendUint32(l.buf, uint32(value))
+	default:
+		l.buf = append(l.buf, 0xF4)
+		l.buf = binary.LittleEndian.AppendUint64(l.buf, uint64(value))
+	}
+	l.appendBacklen(len(l.buf) - start)
+}
+
+// appendString stores integers in their integer encodings like redis
+// does, the element reads back the same either way
+func (l *listpack) appendString(value string) {
+	if integer, err := strconv.ParseInt(value, 10, 64); err == nil && strconv.FormatInt(integer, 10) == value {
+		l.appendInt(integer)
+		return
+	}
+
+	start := len(l.buf)
+	size := len(value)
+	switch {
+	case size < 64:
+		l.buf = append(l.buf, 0x80|byte(size))
+	case size < 4096:
+		l.buf = append(l.buf, 0xE0|byte(size>>8), byte(size))
+	default:
+		l.buf = append(l.buf, 0xF0)
+		l.buf = binary.LittleEndian.AppendUint32(l.buf, uint32(size))
+	}
+	l.buf = append(l.buf, value...)
+	l.appendBacklen(len(l.buf) - start)
+}
+
+// appendBacklen closes an element with its size so the listpack can be
+// walked backwards, 7 bits per byte with the continuation bit set on all
+// but the first byte
+func (l *listpack) appendBacklen(size int) {
+	switch {
+	case size <= 127:
+		l.buf = append(l.buf, byte(size))
+	case size < 16383:
+		l.buf = append(l.buf, byte(size>>7), byte(size&127)|128)
+	case size < 2097151:
+		l.buf = append(l.buf, byte(size>>14), byte((size>>7)&127)|128, byte(size&127)|128)
+	case size < 268435455:
+		l.buf = append(l.buf, byte(size>>21), byte((size>>14)&127)|128, byte((size>>7)&127)|128, byte(size&127)|128)
+	default:
+		l.buf = append(l.buf, byte(size>>28), byte((size>>21)&127)|128, byte((size>>14)&127)|128, byte((size>>7)&127)|128, byte(size&127)|128)
+	}
+	l.count++
+}
+
+// bytes terminates the listpack and fills in its header
+func (l *listpack) bytes() []byte {
+	l.buf = append(l.buf, listpackEnd)
+	binary.LittleEndian.PutUint32(l.buf, uint32(len(l.buf)))
+	count := l.count
+	if count > 65535 {
+		// too many to count in the header, readers walk it instead
+		count = 65535
+	}
+	binary.LittleEndian.PutUint16(l.buf[4:], uint16(count))
+	return l.buf
+}
+
+// decodeListpack returns the elements of a listpack, integers are turned
+// into their decimal strings
+func decodeListpack(buf []byte) ([]string, error) {
+	if len(buf) < listpackHeaderSize+1 || int(binary.LittleEndian.Uint32(buf)) != len(buf) {
+		return nil, errCorruptListpack
+	}
+
+	elements := []string{}
+	at := listpackHeaderSize
+	for {
+		if at >= len(buf) {
+			return nil, errCorruptListpack
+		}
+		first := buf[at]
+		if first == listpackEnd {
+			return elements, nil
+		}
+
+		var element string
+		var size int
+		switch {
+		case first&0x80 == 0:
+			element, size = strconv.Itoa(int(first)), 1
+		case first&0xC0 == 0x80:
+			length := int(first & 0x3F)
+			size = 1 + length
+			if at+size > len(buf) {
+				return nil, errCorruptListpack
+			}
+			element = string(buf[at+1 : at+size])
+		case first&0xE0 == 0xC0:
+			if at+2 > len(buf) {
+				return nil, errCorruptListpack
+			}
+			unsigned := uint64(first&0x1F)<<8 | uint64(buf[at+1])
+			element, size = strconv.FormatInt(signExtend(unsigned, 13), 10), 2
+		case first&0xF0 == 0xE0:
+			if at+2 > len(buf) {
+				return nil, errCorruptListpack
+			}
+			length := int(first&0x0F)<<8 | int(buf[at+1])
+			size = 2 + length
+			if at+size > len(buf) {
+				return nil, errCorruptListpack
+			}
+			element = string(buf[at+2 : at+size])
+		case first == 0xF0:
+			if at+5 > len(buf) {
+				return nil, errCorruptListpack
+			}
+			length := int(binary.LittleEndian.Uint32(buf[at+1:]))
+			size = 5 + length
+			if length < 0 || at+size > len(buf) {
+				return nil, errCorruptListpack
+			}
+			element = string(buf[at+5 : at+size])
+		case first >= 0xF1 && first <= 0xF4:
+			width := map[byte]int{0xF1: 2, 0xF2: 3, 0xF3: 4, 0xF4: 8}[first]
+			size = 1 + width
+			if at+size > len(buf) {
+				return nil, errCorruptListpack
+			}
+			unsigned := uint64(0)
+			for i := width - 1; i >= 0; i-- {
+				unsigned = unsigned<<8 | uint64(buf[at+1+i])
+			}
+			element = strconv.FormatInt(signExtend(unsigned, uint(width*8)), 10)
+		default:
+			return nil, errCorruptListpack
+		}
+
+		elements = append(elements, element)
+		at += size + backlenSize(size)
+	}
+}
+
+func backlenSize(size int) int {
+	switch {
+	case size <= 127:
+		return 1
+	case size < 16383:
+		return 2
+	case size < 2097151:
+		return 3
+	case size < 268435455:
+		return 4
+	}
+	return 5
+}
+
+// signExtend reads the low bits of unsigned as a two's complement number
+func signExtend(unsigned uint64, bits uint) int64 {
+	shift := 64 - bits
+	return int64(unsigned<<shift) >> shift
+}
@@ -0,0 +1,52 @@
+package redisfileparser
+
+import "errors"
+
+var errCorruptLZF = errors.New("corrupt lzf compressed string")
+
+// decompressLZF expands the strings redis compresses when saving, a run
+// of literals or a back reference into what was expanded already
+// http://oldhome.schmorp.de/marc/liblzf.html
+func decompressLZF(in []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	for at := 0; at < len(in); {
+		ctrl := int(in[at])
+		at++
+
+		if ctrl < 32 {
+			length := ctrl + 1
+			if at+length > len(in) {
+				return nil, errCorruptLZF
+			}
+			out = append(out, in[at:at+length]...)
+			at += length
+			continue
+		}
+
+		length := ctrl >> 5
+		if length == 7 {
+			if at >= len(in) {
+				return nil, errCorruptLZF
+			}
+			length += int(in[at])
+			at++
+		}
+		if at >= len(in) {
+			return nil, errCorruptLZF
+		}
+		ref := len(out) - ((ctrl & 0x1F) << 8) - int(in[at]) - 1
+		at++
+		if ref < 0 {
+			return nil, errCorruptLZF
+		}
+		// the reference may overlap what it produces, so byte by byte
+		for i := 0; i < length+2; i++ {
+			out = append(out, out[ref+i])
+		}
+	}
+
+	if len(out) != size {
+		return nil, errCorruptLZF
+	}
+	return out, nil
+}
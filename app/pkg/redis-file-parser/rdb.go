@@ -0,0 +1,74 @@
+package redisfileparser
+
+import "hash/crc64"
+
+// rdbVersion is the RDB version of redis 7.4, the files written here are
+// loaded by it and by every later redis
+const rdbVersion = 12
+
+// https://rdb.fnordig.de/file_format.html#op-codes
+const (
+	opSlotInfo     = 0xF4
+	opFunction2    = 0xF5
+	opModuleAux    = 0xF7
+	opIdle         = 0xF8
+	opFreq         = 0xF9
+	opAux          = 0xFA
+	opResizeDB     = 0xFB
+	opExpireTimeMs = 0xFC
+	opExpireTime   = 0xFD
+	opSelectDB     = 0xFE
+	opEOF          = 0xFF
+)
+
+// value types, the ones written are the plain encodings every version of
+// redis still loads, the compact ones are only read
+const (
+	typeString           = 0
+	typeList             = 1
+	typeSet              = 2
+	typeZSet             = 3
+	typeHash             = 4
+	typeZSet2            = 5
+	typeSetIntset        = 11
+	typeHashListpack     = 16
+	typeZSetListpack     = 17
+	typeListQuicklist2   = 18
+	typeStreamListpacks  = 15
+	typeStreamListpacks2 = 19
+	typeSetListpack      = 20
+	typeStreamListpacks3 = 21
+	typeHashMetadata     = 24
+)
+
+// length encodings, the two top bits of the first byte
+const (
+	len6Bit    = 0
+	len14Bit   = 1
+	len32Bit   = 0x80
+	len64Bit   = 0x81
+	lenEncoded = 3
+)
+
+// special string encodings, the low bits of a lenEncoded byte
+const (
+	encodingInt8  = 0
+	encodingInt16 = 1
+	encodingInt32 = 2
+	encodingLZF   = 3
+)
+
+// quicklist node containers
+const (
+	quicklistPlain  = 1
+	quicklistPacked = 2
+)
+
+// crcTable is the CRC-64/Jones of redis in its reflected form
+var crcTable = crc64.MakeTable(0x95ac9329ac4bc9b5)
+
+// updateCRC continues a redis checksum, unlike the go one it starts at 0
+// and is not inverted at the end
+func updateCRC(crc uint64, p []byte) uint64 {
+	return ^crc64.Update(^crc, crcTable, p)
+}
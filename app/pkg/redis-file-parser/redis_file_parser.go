@@ -2,18 +2,28 @@ package redisfileparser
 
 import (
 	"bufio"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"os"
+	"strconv"
 
 	"github.com/codecrafters-io/redis-starter-go/app/pkg/config"
 	"github.com/codecrafters-io/redis-starter-go/app/pkg/storage"
 )
 
+var errCorruptFile = errors.New("corrupt rdb file")
+
 type RedisFileParser struct {
 	filePath      string
 	doesFileExist bool
-	readerWriter  *bufio.ReadWriter
+	file          *os.File
+	reader        *bufio.Reader
+	// crc covers every byte read so far
+	crc uint64
 }
 
 func (r *RedisFileParser) DoesRedisFileExists() bool {
@@ -25,336 +35,789 @@ func NewRedisFileParser(filePath string) *RedisFileParser {
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		return &RedisFileParser{
 			filePath:      filePath,
-			readerWriter:  nil,
 			doesFileExist: false,
 		}
 	}
 
-	file, err := os.OpenFile(filePath, os.O_RDWR, 0666)
+	file, err := os.Open(filePath)
 	if err != nil {
 		log.Fatalf("Error opening file: %v\n", err)
 	}
-	reader := bufio.NewReader(file)
-	writer := bufio.NewWriter(file)
-	readerWriter := bufio.NewReadWriter(reader, writer)
 
 	return &RedisFileParser{
 		filePath:      filePath,
-		readerWriter:  readerWriter,
+		file:          file,
+		reader:        bufio.NewReader(file),
 		doesFileExist: true,
 	}
 }
-func (r *RedisFileParser) ParseFile() (*config.FileConfig, map[string]storage.Data) {
-	redisFlag := make([]byte, 5)
-	_, err := r.readerWriter.Read(redisFlag)
 
+// NewRedisFileParserFromReader reads an RDB that is followed by other
+// data, like the preamble of an AOF, nothing after its checksum is read
+func NewRedisFileParserFromReader(reader *bufio.Reader) *RedisFileParser {
+	return &RedisFileParser{reader: reader, doesFileExist: true}
+}
+
+// Parse reads one RDB from the reader, the caller handles the errors
+func (r *RedisFileParser) Parse() (*config.FileConfig, map[string]storage.Data, error) {
+	return r.parse()
+}
+
+func (r *RedisFileParser) ParseFile() (*config.FileConfig, map[string]storage.Data) {
+	defer r.file.Close()
+	fileConfig, data, err := r.parse()
 	if err != nil {
-		log.Fatalf("corrupted file: %v", err)
+		log.Fatalf("error loading %s: %v", r.filePath, err)
 	}
-	version := make([]byte, 4)
-	_, err = r.readerWriter.Read(version)
+	return fileConfig, data
+}
+
+// parse reads the whole file, keys of databases other than 0 are loaded
+// into the single keyspace as well
+func (r *RedisFileParser) parse() (*config.FileConfig, map[string]storage.Data, error) {
+	header, err := r.read(9)
 	if err != nil {
-		log.Fatalf("error reading version: %v", err)
+		return nil, nil, err
+	}
+	if string(header[:5]) != "REDIS" {
+		return nil, nil, fmt.Errorf("wrong signature %q", header[:5])
+	}
+	version := string(header[5:])
+	if number, err := strconv.Atoi(version); err != nil || number < 1 || number > rdbVersion {
+		return nil, nil, fmt.Errorf("can't handle RDB format version %s", version)
 	}
 
-	fmt.Printf("Redis version: %s\n", string(version))
+	fmt.Printf("Redis version: %s\n", version)
 	data := make(map[string]storage.Data)
-
 	metadata := make(map[string]string)
+	database := uint64(0)
 
-	databaseValue := byte(0)
-	sizeOfCorrospendingHashTable := ""
-
-	endOfFile := false
-
-	for !endOfFile {
-		nextByte, err := r.readerWriter.ReadByte()
+	expireEnabled := false
+	expireDate := int64(0)
+	for {
+		opcode, err := r.readByte()
 		if err != nil {
-			log.Fatalf("error reading next byte: %v", err)
+			return nil, nil, err
 		}
 
-		switch nextByte {
-		case 0xFA:
+		switch opcode {
+		case opAux:
 			key, err := r.readString()
 			if err != nil {
-				log.Fatalf("error reading metadata key: %v", err)
+				return nil, nil, err
 			}
-
-			value, err := r.readValue()
+			value, err := r.readString()
 			if err != nil {
-				log.Fatalf("error reading metadata value: %v", err)
+				return nil, nil, err
 			}
-
 			metadata[key] = value
 			fmt.Printf("Metadata: %s = %s\n", key, value)
-		case 0xFE:
-			databaseValue, err = r.readerWriter.ReadByte()
+		case opSelectDB:
+			if database, err = r.readLength(); err != nil {
+				return nil, nil, err
+			}
+		case opResizeDB:
+			// only a hint for the size of the tables
+			if _, err := r.readLength(); err != nil {
+				return nil, nil, err
+			}
+			if _, err := r.readLength(); err != nil {
+				return nil, nil, err
+			}
+		case opSlotInfo:
+			for i := 0; i < 3; i++ {
+				if _, err := r.readLength(); err != nil {
+					return nil, nil, err
+				}
+			}
+		case opExpireTime:
+			seconds, err := r.read(4)
+			if err != nil {
+				return nil, nil, err
+			}
+			expireEnabled = true
+			expireDate = int64(int32(binary.LittleEndian.Uint32(seconds))) * 1000
+		case opExpireTimeMs:
+			if expireDate, err = r.readMilliseconds(); err != nil {
+				return nil, nil, err
+			}
+			expireEnabled = true
+		case opIdle:
+			// LRU and LFU hints of the next key, there is no eviction here
+			if _, err := r.readLength(); err != nil {
+				return nil, nil, err
+			}
+		case opFreq:
+			if _, err := r.readByte(); err != nil {
+				return nil, nil, err
+			}
+		case opFunction2:
+			if _, err := r.readString(); err != nil {
+				return nil, nil, err
+			}
+		case opModuleAux:
+			return nil, nil, errors.New("modules are not supported")
+		case opEOF:
+			if err := r.checkChecksum(); err != nil {
+				return nil, nil, err
+			}
+			fileConfig := config.FileConfig{
+				Version:  version,
+				MetaData: metadata,
+				Db:       strconv.FormatUint(database, 10),
+			}
+			return &fileConfig, data, nil
+		default:
+			key, err := r.readString()
 			if err != nil {
-				log.Fatalf("error reading database value: %v", err)
+				return nil, nil, err
 			}
-		case 0xFB:
-			bytes := make([]byte, 2)
-			r.readerWriter.Read(bytes)
-			sizeOfCorrospendingHashTable = string(bytes)
-			fmt.Printf("Size of corresponding hash table: %s\n", sizeOfCorrospendingHashTable)
+			value, err := r.readObject(opcode)
 			if err != nil {
-				log.Fatalf("error reading size of corresponding hash table: %v", err)
+				return nil, nil, fmt.Errorf("key %q: %w", key, err)
 			}
-		case 0xFF:
-			fmt.Println("End of file reached")
-			endOfFile = true
+			value.ExpeireEnabled = expireEnabled
+			value.ExpeireDate = expireDate
+			data[key] = value
+			expireEnabled = false
+			expireDate = 0
+		}
+	}
+}
 
-		case 0xFD:
-			expeireBytes := make([]byte, 4)
-			r.readerWriter.Read(expeireBytes)
-			expireValue := int(expeireBytes[0]) | int(expeireBytes[1])<<8 |
-				int(expeireBytes[2])<<16 | int(expeireBytes[3])<<24
+// checkChecksum compares the trailer with what was read, files saved
+// with rdbchecksum off have 0 there
+func (r *RedisFileParser) checkChecksum() error {
+	computed := r.crc
+	trailer, err := r.read(8)
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		// versions before 5 had no checksum
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if expected := binary.LittleEndian.Uint64(trailer); expected != 0 && expected != computed {
+		return fmt.Errorf("wrong checksum, expected %x got %x", expected, computed)
+	}
+	return nil
+}
 
-			// Here i am skipping the type byte because we are just implementing the 00 and it is String Encoding
-			// it is not correct
-			// https://rdb.fnordig.de/file_format.html#value-type
-			_, _ = r.readerWriter.ReadByte()
+// readObject reads a value of the given type
+// https://rdb.fnordig.de/file_format.html#value-type
+func (r *RedisFileParser) readObject(valueType byte) (storage.Data, error) {
+	switch valueType {
+	case typeString:
+		value, err := r.readString()
+		return storage.Data{Type: storage.TypeString, Value: value}, err
 
-			key, err := r.readString()
+	case typeList:
+		values, err := r.readStrings()
+		if err != nil {
+			return storage.Data{}, err
+		}
+		return listData(values), nil
+
+	case typeListQuicklist2:
+		count, err := r.readLength()
+		if err != nil {
+			return storage.Data{}, err
+		}
+		values := []string{}
+		for i := uint64(0); i < count; i++ {
+			container, err := r.readLength()
 			if err != nil {
-				log.Fatalf("error reading metadata key: %v", err)
+				return storage.Data{}, err
 			}
-
-			value, err := r.readString()
+			node, err := r.readString()
 			if err != nil {
-				log.Fatalf("error reading key and value: %v", err)
+				return storage.Data{}, err
 			}
-			data[key] = storage.Data{
-				Value:          value,
-				ExpeireDate:    int64(expireValue) * 1000,
-				ExpeireEnabled: true,
+			if container == quicklistPlain {
+				values = append(values, node)
+				continue
 			}
+			elements, err := decodeListpack([]byte(node))
 			if err != nil {
-				log.Fatalf("error reading expire bytes: %v", err)
+				return storage.Data{}, err
 			}
+			values = append(values, elements...)
+		}
+		return listData(values), nil
 
-		case 0xFC:
-			expeireBytes := make([]byte, 8)
-			r.readerWriter.Read(expeireBytes)
-			expireValue := int(expeireBytes[0]) | int(expeireBytes[1])<<8 |
-				int(expeireBytes[2])<<16 | int(expeireBytes[3])<<24 |
-				int(expeireBytes[4])<<32 | int(expeireBytes[5])<<40 |
-				int(expeireBytes[6])<<48 | int(expeireBytes[7])<<56
+	case typeSet:
+		members, err := r.readStrings()
+		if err != nil {
+			return storage.Data{}, err
+		}
+		return setData(members), nil
 
-			// Here i am skipping the type byte because we are just implementing the 00 and it is String Encoding
-			// it is not correct
-			// https://rdb.fnordig.de/file_format.html#value-type
-			_, _ = r.readerWriter.ReadByte()
+	case typeSetListpack:
+		members, err := r.readListpack()
+		if err != nil {
+			return storage.Data{}, err
+		}
+		return setData(members), nil
 
-			key, err := r.readString()
+	case typeSetIntset:
+		encoded, err := r.readString()
+		if err != nil {
+			return storage.Data{}, err
+		}
+		members, err := decodeIntset([]byte(encoded))
+		if err != nil {
+			return storage.Data{}, err
+		}
+		return setData(members), nil
+
+	case typeZSet, typeZSet2:
+		count, err := r.readLength()
+		if err != nil {
+			return storage.Data{}, err
+		}
+		zset := storage.NewZSet()
+		for i := uint64(0); i < count; i++ {
+			member, err := r.readString()
 			if err != nil {
-				log.Fatalf("error reading metadata key: %v", err)
+				return storage.Data{}, err
 			}
+			var score float64
+			if valueType == typeZSet2 {
+				bits, err := r.read(8)
+				if err != nil {
+					return storage.Data{}, err
+				}
+				score = math.Float64frombits(binary.LittleEndian.Uint64(bits))
+			} else if score, err = r.readTextDouble(); err != nil {
+				return storage.Data{}, err
+			}
+			zset.Add(member, score)
+		}
+		return storage.Data{Type: storage.TypeZSet, ZSet: zset}, nil
 
-			value, err := r.readString()
+	case typeZSetListpack:
+		elements, err := r.readListpack()
+		if err != nil || len(elements)%2 != 0 {
+			return storage.Data{}, errors.Join(err, errCorruptListpack)
+		}
+		zset := storage.NewZSet()
+		for i := 0; i < len(elements); i += 2 {
+			score, err := strconv.ParseFloat(elements[i+1], 64)
 			if err != nil {
-				log.Fatalf("error reading key and value: %v", err)
+				return storage.Data{}, errCorruptListpack
 			}
-			data[key] = storage.Data{
-				Value:          value,
-				ExpeireDate:    int64(expireValue),
-				ExpeireEnabled: true,
+			zset.Add(elements[i], score)
+		}
+		return storage.Data{Type: storage.TypeZSet, ZSet: zset}, nil
+
+	case typeHash, typeHashMetadata:
+		minExpire := int64(0)
+		if valueType == typeHashMetadata {
+			var err error
+			if minExpire, err = r.readMilliseconds(); err != nil {
+				return storage.Data{}, err
 			}
-			if err != nil {
-				log.Fatalf("error reading expire bytes: %v", err)
+		}
+		count, err := r.readLength()
+		if err != nil {
+			return storage.Data{}, err
+		}
+		hash := storage.NewHash()
+		for i := uint64(0); i < count; i++ {
+			ttl := uint64(0)
+			if valueType == typeHashMetadata {
+				if ttl, err = r.readLength(); err != nil {
+					return storage.Data{}, err
+				}
 			}
-		case 0x00:
-			key, err := r.readString()
+			field, err := r.readString()
 			if err != nil {
-				log.Fatalf("error reading metadata key: %v", err)
+				return storage.Data{}, err
 			}
-
 			value, err := r.readString()
 			if err != nil {
-				log.Fatalf("error reading key and value: %v", err)
+				return storage.Data{}, err
 			}
-			data[key] = storage.Data{
-				Value:          value,
-				ExpeireDate:    0,
-				ExpeireEnabled: false,
+			hash.Set(field, value)
+			if ttl != 0 {
+				hash.SetExpireAt(field, int64(ttl)+minExpire-1)
 			}
 		}
+		return storage.Data{Type: storage.TypeHash, Hash: hash}, nil
+
+	case typeHashListpack:
+		elements, err := r.readListpack()
+		if err != nil || len(elements)%2 != 0 {
+			return storage.Data{}, errors.Join(err, errCorruptListpack)
+		}
+		hash := storage.NewHash()
+		for i := 0; i < len(elements); i += 2 {
+			hash.Set(elements[i], elements[i+1])
+		}
+		return storage.Data{Type: storage.TypeHash, Hash: hash}, nil
+
+	case typeStreamListpacks, typeStreamListpacks2, typeStreamListpacks3:
+		stream, err := r.readStream(valueType)
+		if err != nil {
+			return storage.Data{}, err
+		}
+		return storage.Data{Type: storage.TypeStream, Stream: stream}, nil
 	}
-	fileConfig := config.FileConfig{
-		Version:  string(version),
-		MetaData: metadata,
-		// should not be string change this later
-		Db: string(databaseValue),
-	}
-	return &fileConfig, data
+
+	return storage.Data{}, fmt.Errorf("unsupported value type %d", valueType)
 }
 
-func (r *RedisFileParser) readString() (string, error) {
-	//https://rdb.fnordig.de/file_format.html#string-encoding
-	length, err := r.readerWriter.ReadByte()
+// readStream reads what RedisFileWriter.stream writes, the older types
+// lack the counters added with consumer group lag and the active time
+func (r *RedisFileParser) readStream(valueType byte) (*storage.Stream, error) {
+	stream := storage.NewStream()
+	nodes, err := r.readLength()
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	for i := uint64(0); i < nodes; i++ {
+		key, err := r.readString()
+		if err != nil {
+			return nil, err
+		}
+		if len(key) != 16 {
+			return nil, errCorruptFile
+		}
+		master := storage.StreamID{
+			Ms:  binary.BigEndian.Uint64([]byte(key[:8])),
+			Seq: binary.BigEndian.Uint64([]byte(key[8:])),
+		}
+		elements, err := r.readListpack()
+		if err != nil {
+			return nil, err
+		}
+		if err := addStreamListpack(stream, master, elements); err != nil {
+			return nil, err
+		}
 	}
 
-	data := make([]byte, length)
-	_, err = r.readerWriter.Read(data)
-	if err != nil {
-		return "", err
+	if _, err := r.readLength(); err != nil {
+		return nil, err
+	}
+	if stream.LastID, err = r.readStreamID(); err != nil {
+		return nil, err
+	}
+	stream.EntriesAdded = uint64(stream.Len())
+	if valueType != typeStreamListpacks {
+		// the first ID is known from the entries
+		if _, err := r.readStreamID(); err != nil {
+			return nil, err
+		}
+		if stream.MaxDeletedID, err = r.readStreamID(); err != nil {
+			return nil, err
+		}
+		if stream.EntriesAdded, err = r.readLength(); err != nil {
+			return nil, err
+		}
 	}
 
-	return string(data), nil
+	groups, err := r.readLength()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < groups; i++ {
+		name, err := r.readString()
+		if err != nil {
+			return nil, err
+		}
+		lastID, err := r.readStreamID()
+		if err != nil {
+			return nil, err
+		}
+		entriesRead := int64(-1)
+		if valueType != typeStreamListpacks {
+			read, err := r.readLength()
+			if err != nil {
+				return nil, err
+			}
+			entriesRead = int64(read)
+		}
+		stream.CreateGroup(name, lastID, entriesRead)
+		if err := r.readConsumerGroup(stream.Groups[name], valueType); err != nil {
+			return nil, err
+		}
+	}
+	return stream, nil
 }
 
-func (r *RedisFileParser) readValue() (string, error) {
-	typeByte, err := r.readerWriter.ReadByte()
+// readConsumerGroup reads the pending entries of the group and then the
+// consumers with the IDs of the entries they own
+func (r *RedisFileParser) readConsumerGroup(group *storage.ConsumerGroup, valueType byte) error {
+	type delivery struct {
+		time  int64
+		count int64
+	}
+	pendingCount, err := r.readLength()
 	if err != nil {
-		return "", err
+		return err
 	}
-	firtsByteOfType := typeByte & 0xF0
-	switch firtsByteOfType {
-	case 0x00: //The next 6 bits represent the length
-		makedValue := typeByte & 0x3F
-		if makedValue == 0 {
-			return "", nil
+	pending := make(map[storage.StreamID]delivery, pendingCount)
+	for i := uint64(0); i < pendingCount; i++ {
+		id, err := r.readRawStreamID()
+		if err != nil {
+			return err
 		}
-		data := make([]byte, makedValue)
-		_, err := r.readerWriter.Read(data)
+		deliveryTime, err := r.readMilliseconds()
 		if err != nil {
-			return "", err
+			return err
 		}
+		deliveryCount, err := r.readLength()
+		if err != nil {
+			return err
+		}
+		pending[id] = delivery{time: deliveryTime, count: int64(deliveryCount)}
+	}
 
-		if intStr, ok := r.parseDataToInt(data); ok {
-			return intStr, nil
+	consumers, err := r.readLength()
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < consumers; i++ {
+		name, err := r.readString()
+		if err != nil {
+			return err
 		}
-		return string(data), nil
-	case 0x10: //Read one additional byte. The combined 14 bits represent the length
-		additionalByte, err := r.readerWriter.ReadByte()
+		seenTime, err := r.readMilliseconds()
 		if err != nil {
-			return "", err
+			return err
 		}
-		firstSixBytes := typeByte & 0x3F
-		resultLen := (int(firstSixBytes) << 8) | int(additionalByte)
-
-		if resultLen == 0 {
-			return "", nil
+		activeTime := seenTime
+		if valueType == typeStreamListpacks3 {
+			if activeTime, err = r.readMilliseconds(); err != nil {
+				return err
+			}
 		}
-		data := make([]byte, resultLen)
-		_, err = r.readerWriter.Read(data)
+		consumer, _ := group.Consumer(name, true, seenTime)
+		consumer.ActiveTime = activeTime
+
+		owned, err := r.readLength()
 		if err != nil {
-			return "", err
+			return err
+		}
+		for j := uint64(0); j < owned; j++ {
+			id, err := r.readRawStreamID()
+			if err != nil {
+				return err
+			}
+			delivered, ok := pending[id]
+			if !ok {
+				return fmt.Errorf("consumer %q owns %s which is not pending", name, id)
+			}
+			entry := group.AddPending(id, consumer, delivered.time)
+			entry.DeliveryCount = delivered.count
 		}
+	}
+	return nil
+}
 
-		if intStr, ok := r.parseDataToInt(data); ok {
-			return intStr, nil
+// addStreamListpack appends the entries of a stream node, deleted ones
+// are skipped
+func addStreamListpack(stream *storage.Stream, master storage.StreamID, elements []string) error {
+	const (
+		flagDeleted    = 1
+		flagSameFields = 2
+	)
+
+	at := 0
+	next := func() (int64, error) {
+		if at >= len(elements) {
+			return 0, errCorruptListpack
 		}
-		return string(data), nil
+		at++
+		return strconv.ParseInt(elements[at-1], 10, 64)
+	}
+
+	// master entry: count, deleted, the fields and a 0 terminator
+	if _, err := next(); err != nil {
+		return err
+	}
+	if _, err := next(); err != nil {
+		return err
+	}
+	fieldCount, err := next()
+	if err != nil || fieldCount < 0 || at+int(fieldCount) > len(elements) {
+		return errors.Join(err, errCorruptListpack)
+	}
+	masterFields := elements[at : at+int(fieldCount)]
+	at += int(fieldCount)
+	if _, err := next(); err != nil {
+		return err
+	}
 
-	case 0x20: //Discard the remaining 6 bits. The next 4 bytes from the stream represent the length
-		lenBytes := make([]byte, 4)
-		_, err := r.readerWriter.Read(lenBytes)
+	for at < len(elements) {
+		flags, err := next()
 		if err != nil {
-			return "", err
-		}
-		val := int(lenBytes[0]) |
-			int(lenBytes[1])<<8 |
-			int(lenBytes[2])<<16 |
-			int(lenBytes[3])<<24
-		if val == 0 {
-			return "", nil
+			return err
 		}
-		data := make([]byte, val)
-		_, err = r.readerWriter.Read(data)
+		msDiff, err := next()
 		if err != nil {
-			return "", err
+			return err
 		}
-		if intStr, ok := r.parseDataToInt(data); ok {
-			return intStr, nil
+		seqDiff, err := next()
+		if err != nil {
+			return err
 		}
-		return string(data), nil
-	case 0x30: //The next 6 bits represent the length
-		switch typeByte {
-		case 0xC0:
-			// 8-bit integer
-			val, err := r.readerWriter.ReadByte()
-			if err != nil {
-				return "", err
+
+		fields := []string{}
+		if flags&flagSameFields != 0 {
+			if at+len(masterFields) > len(elements) {
+				return errCorruptListpack
 			}
-			return fmt.Sprintf("%d", val), nil
-		case 0xC1:
-			// 16-bit integer
-			data := make([]byte, 2)
-			_, err := r.readerWriter.Read(data)
-			if err != nil {
-				return "", err
-			}
-			val := uint16(data[0]) | uint16(data[1])<<8
-			return fmt.Sprintf("%d", val), nil
-		case 0xC2:
-			//32-bit integer
-			data := make([]byte, 4)
-			_, err := r.readerWriter.Read(data)
-			if err != nil {
-				return "", err
+			for i, field := range masterFields {
+				fields = append(fields, field, elements[at+i])
+			}
+			at += len(masterFields)
+		} else {
+			count, err := next()
+			if err != nil || count < 0 || at+2*int(count) > len(elements) {
+				return errors.Join(err, errCorruptListpack)
 			}
-			val := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16 | uint32(data[3])<<24
-			return fmt.Sprintf("%d", val), nil
+			fields = append(fields, elements[at:at+2*int(count)]...)
+			at += 2 * int(count)
+		}
+		// lp-count, only there to walk the listpack backwards
+		if _, err := next(); err != nil {
+			return err
+		}
+
+		if flags&flagDeleted == 0 {
+			id := storage.StreamID{Ms: master.Ms + uint64(msDiff), Seq: master.Seq + uint64(seqDiff)}
+			stream.Add(id, fields)
+		}
+	}
+	return nil
+}
+
+func listData(values []string) storage.Data {
+	list := storage.NewList()
+	for _, value := range values {
+		list.PushTail(value)
+	}
+	return storage.Data{Type: storage.TypeList, List: list}
+}
+
+func setData(members []string) storage.Data {
+	set := storage.NewSet()
+	for _, member := range members {
+		set.Add(member)
+	}
+	return storage.Data{Type: storage.TypeSet, Set: set}
+}
+
+// decodeIntset reads the sorted integer arrays small sets of integers are
+// saved as, a header with the integer width and the count
+func decodeIntset(buf []byte) ([]string, error) {
+	if len(buf) < 8 {
+		return nil, errCorruptFile
+	}
+	width := int(binary.LittleEndian.Uint32(buf))
+	count := int(binary.LittleEndian.Uint32(buf[4:]))
+	if (width != 2 && width != 4 && width != 8) || len(buf) != 8+width*count {
+		return nil, errCorruptFile
+	}
+
+	members := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		at := 8 + i*width
+		var value int64
+		switch width {
+		case 2:
+			value = int64(int16(binary.LittleEndian.Uint16(buf[at:])))
+		case 4:
+			value = int64(int32(binary.LittleEndian.Uint32(buf[at:])))
 		default:
-			// compressed string
-			// dont support compressed strings yet
-			log.Fatalf("not supported compressed strings")
+			value = int64(binary.LittleEndian.Uint64(buf[at:]))
+		}
+		members = append(members, strconv.FormatInt(value, 10))
+	}
+	return members, nil
+}
+
+func (r *RedisFileParser) readStrings() ([]string, error) {
+	count, err := r.readLength()
+	if err != nil {
+		return nil, err
+	}
+	values := []string{}
+	for i := uint64(0); i < count; i++ {
+		value, err := r.readString()
+		if err != nil {
+			return nil, err
 		}
+		values = append(values, value)
 	}
+	return values, nil
+}
+
+func (r *RedisFileParser) readListpack() ([]string, error) {
+	encoded, err := r.readString()
+	if err != nil {
+		return nil, err
+	}
+	return decodeListpack([]byte(encoded))
+}
+
+func (r *RedisFileParser) readStreamID() (storage.StreamID, error) {
+	ms, err := r.readLength()
+	if err != nil {
+		return storage.StreamID{}, err
+	}
+	seq, err := r.readLength()
+	return storage.StreamID{Ms: ms, Seq: seq}, err
+}
+
+func (r *RedisFileParser) readRawStreamID() (storage.StreamID, error) {
+	raw, err := r.read(16)
+	if err != nil {
+		return storage.StreamID{}, err
+	}
+	return storage.StreamID{
+		Ms:  binary.BigEndian.Uint64(raw),
+		Seq: binary.BigEndian.Uint64(raw[8:]),
+	}, nil
+}
+
+// readTextDouble reads the scores of the first zset type, a length byte
+// with three special values for infinities and NaN and then the text
+func (r *RedisFileParser) readTextDouble() (float64, error) {
+	length, err := r.readByte()
+	if err != nil {
+		return 0, err
+	}
+	switch length {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+	text, err := r.read(int(length))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(string(text), 64)
+}
+
+func (r *RedisFileParser) readMilliseconds() (int64, error) {
+	raw, err := r.read(8)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.LittleEndian.Uint64(raw)), nil
+}
+
+// readLength reads a length, which are also used for plain numbers
+// https://rdb.fnordig.de/file_format.html#length-encoding
+func (r *RedisFileParser) readLength() (uint64, error) {
+	length, encoded, err := r.readLengthOrEncoding()
+	if err == nil && encoded {
+		err = errCorruptFile
+	}
+	return length, err
+}
 
-	switch typeByte {
-	case 0xC0:
-		// 8-bit integer
-		val, err := r.readerWriter.ReadByte()
+// readLengthOrEncoding returns the special string encoding instead of a
+// length when the two top bits are set
+func (r *RedisFileParser) readLengthOrEncoding() (uint64, bool, error) {
+	first, err := r.readByte()
+	if err != nil {
+		return 0, false, err
+	}
+
+	switch {
+	case first>>6 == len6Bit:
+		return uint64(first & 0x3F), false, nil
+	case first>>6 == len14Bit:
+		next, err := r.readByte()
+		return uint64(first&0x3F)<<8 | uint64(next), false, err
+	case first == len32Bit:
+		raw, err := r.read(4)
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(binary.BigEndian.Uint32(raw)), false, nil
+	case first == len64Bit:
+		raw, err := r.read(8)
+		if err != nil {
+			return 0, false, err
+		}
+		return binary.BigEndian.Uint64(raw), false, nil
+	case first>>6 == lenEncoded:
+		return uint64(first & 0x3F), true, nil
+	}
+	return 0, false, errCorruptFile
+}
+
+// readString reads a string in any of its encodings
+// https://rdb.fnordig.de/file_format.html#string-encoding
+func (r *RedisFileParser) readString() (string, error) {
+	length, encoded, err := r.readLengthOrEncoding()
+	if err != nil {
+		return "", err
+	}
+	if !encoded {
+		data, err := r.read(int(length))
+		return string(data), err
+	}
+
+	switch length {
+	case encodingInt8:
+		value, err := r.readByte()
+		return strconv.Itoa(int(int8(value))), err
+	case encodingInt16:
+		raw, err := r.read(2)
 		if err != nil {
 			return "", err
 		}
-		return fmt.Sprintf("%d", val), nil
-	case 0xC1:
-		data := make([]byte, 2)
-		_, err := r.readerWriter.Read(data)
+		return strconv.Itoa(int(int16(binary.LittleEndian.Uint16(raw)))), nil
+	case encodingInt32:
+		raw, err := r.read(4)
 		if err != nil {
 			return "", err
 		}
-		val := uint16(data[0]) | uint16(data[1])<<8
-		return fmt.Sprintf("%d", val), nil
-	case 0xC2:
-		data := make([]byte, 4)
-		_, err := r.readerWriter.Read(data)
+		return strconv.Itoa(int(int32(binary.LittleEndian.Uint32(raw)))), nil
+	case encodingLZF:
+		compressedLength, err := r.readLength()
 		if err != nil {
 			return "", err
 		}
-		val := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16 | uint32(data[3])<<24
-		return fmt.Sprintf("%d", val), nil
-	default:
-		// String with length prefix
-		data := make([]byte, typeByte)
-		_, err := r.readerWriter.Read(data)
+		length, err := r.readLength()
 		if err != nil {
 			return "", err
 		}
-		return string(data), nil
+		compressed, err := r.read(int(compressedLength))
+		if err != nil {
+			return "", err
+		}
+		data, err := decompressLZF(compressed, int(length))
+		return string(data), err
 	}
+	return "", errCorruptFile
 }
 
-func (r *RedisFileParser) parseDataToInt(data []byte) (string, bool) {
-	length := len(data)
-	var intValue int
-	switch length {
-	case 1:
-		intValue = int(data[0])
-	case 2:
-		intValue = int(data[0]) | int(data[1])<<8
-	case 4:
-		intValue = int(data[0]) | int(data[1])<<8 | int(data[2])<<16 | int(data[3])<<24
-	case 8:
-		intValue = int(data[0]) | int(data[1])<<8 | int(data[2])<<16 | int(data[3])<<24 |
-			int(data[4])<<32 | int(data[5])<<40 | int(data[6])<<48 | int(data[7])<<56
-	default:
-		return "", false
-	}
-	return fmt.Sprintf("%d", intValue), true
+func (r *RedisFileParser) readByte() (byte, error) {
+	b, err := r.read(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// read is where every byte goes through to be counted in the checksum
+func (r *RedisFileParser) read(n int) ([]byte, error) {
+	if n < 0 {
+		return nil, errCorruptFile
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r.reader, data); err != nil {
+		return nil, err
+	}
+	r.crc = updateCRC(r.crc, data)
+	return data, nil
 }
@@ -0,0 +1,389 @@
+package redisfileparser
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/config"
+	"github.com/codecrafters-io/redis-starter-go/app/pkg/storage"
+)
+
+// RedisFileWriter encodes a keyspace as an RDB file, keeping the
+// checksum of everything written so far
+type RedisFileWriter struct {
+	writer *bufio.Writer
+	crc    uint64
+	err    error
+	// aofBase marks the file as the RDB preamble of an AOF
+	aofBase bool
+}
+
+func NewRedisFileWriter(w io.Writer) *RedisFileWriter {
+	return &RedisFileWriter{writer: bufio.NewWriter(w)}
+}
+
+// ForAOF writes the RDB preamble of an AOF, the commands follow it
+func (w *RedisFileWriter) ForAOF() *RedisFileWriter {
+	w.aofBase = true
+	return w
+}
+
+// WriteRedisFile saves data at path. The file is written next to it under
+// a temporary name and renamed over it once complete, so a crash never
+// leaves a half written file behind.
+func WriteRedisFile(path string, data map[string]storage.Data) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "temp-*.rdb")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err := NewRedisFileWriter(file).Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	// temporary files are private, the saved file is not
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// Write encodes the whole file, data is the only database, 0
+func (w *RedisFileWriter) Write(data map[string]storage.Data) error {
+	w.raw([]byte(fmt.Sprintf("REDIS%04d", rdbVersion)))
+	w.aux("redis-ver", config.RedisVersion)
+	w.aux("redis-bits", "64")
+	w.aux("ctime", strconv.FormatInt(time.Now().Unix(), 10))
+	if w.aofBase {
+		w.aux("aof-base", "1")
+	} else {
+		w.aux("aof-base", "0")
+	}
+
+	if len(data) > 0 {
+		expires := 0
+		for _, value := range data {
+			if value.ExpeireEnabled {
+				expires++
+			}
+		}
+		w.byte(opSelectDB)
+		w.length(0)
+		w.byte(opResizeDB)
+		w.length(uint64(len(data)))
+		w.length(uint64(expires))
+
+		// sorted so that the same data always gives the same file
+		keys := make([]string, 0, len(data))
+		for key := range data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			w.entry(key, data[key])
+		}
+	}
+
+	w.byte(opEOF)
+	checksum := binary.LittleEndian.AppendUint64(nil, w.crc)
+	w.raw(checksum)
+	if w.err != nil {
+		return w.err
+	}
+	return w.writer.Flush()
+}
+
+func (w *RedisFileWriter) aux(key, value string) {
+	w.byte(opAux)
+	w.string(key)
+	w.string(value)
+}
+
+func (w *RedisFileWriter) entry(key string, data storage.Data) {
+	if data.ExpeireEnabled {
+		w.byte(opExpireTimeMs)
+		w.milliseconds(data.ExpeireDate)
+	}
+
+	switch data.Type {
+	case storage.TypeString:
+		w.byte(typeString)
+		w.string(key)
+		w.string(data.Value)
+	case storage.TypeList:
+		w.byte(typeList)
+		w.string(key)
+		w.length(uint64(data.List.Len()))
+		for _, value := range data.List.Values() {
+			w.string(value)
+		}
+	case storage.TypeSet:
+		w.byte(typeSet)
+		w.string(key)
+		w.length(uint64(data.Set.Len()))
+		data.Set.Each(func(member string) bool {
+			w.string(member)
+			return true
+		})
+	case storage.TypeZSet:
+		w.byte(typeZSet2)
+		w.string(key)
+		w.length(uint64(data.ZSet.Len()))
+		data.ZSet.Each(func(entry storage.ZEntry) bool {
+			w.string(entry.Member)
+			w.raw(binary.LittleEndian.AppendUint64(nil, math.Float64bits(entry.Score)))
+			return true
+		})
+	case storage.TypeHash:
+		w.hash(key, data.Hash)
+	case storage.TypeStream:
+		w.byte(typeStreamListpacks3)
+		w.string(key)
+		w.stream(data.Stream)
+	}
+}
+
+// hash only uses the type with field TTLs when a field has one, the TTLs
+// are stored relative to the earliest of them and 0 is no TTL
+func (w *RedisFileWriter) hash(key string, hash *storage.Hash) {
+	fields := []string{}
+	expires := map[string]int64{}
+	minExpire := int64(0)
+	hash.Each(func(field, value string) bool {
+		expireAt, _ := hash.ExpireAt(field)
+		fields = append(fields, field, value)
+		if expireAt != 0 {
+			expires[field] = expireAt
+			if minExpire == 0 || expireAt < minExpire {
+				minExpire = expireAt
+			}
+		}
+		return true
+	})
+
+	if len(expires) == 0 {
+		w.byte(typeHash)
+		w.string(key)
+		w.length(uint64(len(fields) / 2))
+		for _, field := range fields {
+			w.string(field)
+		}
+		return
+	}
+
+	w.byte(typeHashMetadata)
+	w.string(key)
+	w.milliseconds(minExpire)
+	w.length(uint64(len(fields) / 2))
+	for i := 0; i < len(fields); i += 2 {
+		ttl := uint64(0)
+		if expireAt, ok := expires[fields[i]]; ok {
+			ttl = uint64(expireAt-minExpire) + 1
+		}
+		w.length(ttl)
+		w.string(fields[i])
+		w.string(fields[i+1])
+	}
+}
+
+// stream writes the entries as listpacks keyed by their master ID, each
+// with the fields of its first entry as master fields, followed by the
+// metadata and the consumer groups
+func (w *RedisFileWriter) stream(stream *storage.Stream) {
+	entries := stream.Range(storage.StreamID{}, storage.MaxStreamID, false, 0)
+	nodes := (len(entries) + storage.StreamNodeMaxEntries - 1) / storage.StreamNodeMaxEntries
+	w.length(uint64(nodes))
+	for start := 0; start < len(entries); start += storage.StreamNodeMaxEntries {
+		end := min(start+storage.StreamNodeMaxEntries, len(entries))
+		master := entries[start].ID
+		w.string(string(streamIDBytes(master)))
+		w.string(string(streamListpack(entries[start:end])))
+	}
+
+	w.length(uint64(stream.Len()))
+	w.streamID(stream.LastID)
+	first := storage.StreamID{}
+	if len(entries) > 0 {
+		first = entries[0].ID
+	}
+	w.streamID(first)
+	w.streamID(stream.MaxDeletedID)
+	w.length(stream.EntriesAdded)
+
+	names := make([]string, 0, len(stream.Groups))
+	for name := range stream.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	w.length(uint64(len(names)))
+	for _, name := range names {
+		group := stream.Groups[name]
+		w.string(name)
+		w.streamID(group.LastID)
+		w.length(uint64(group.EntriesRead))
+
+		pending := group.PendingRange(storage.StreamID{}, storage.MaxStreamID, 0, nil)
+		w.length(uint64(len(pending)))
+		for _, entry := range pending {
+			w.raw(streamIDBytes(entry.ID))
+			w.milliseconds(entry.DeliveryTime)
+			w.length(uint64(entry.DeliveryCount))
+		}
+
+		consumers := make([]string, 0, len(group.Consumers))
+		for consumer := range group.Consumers {
+			consumers = append(consumers, consumer)
+		}
+		sort.Strings(consumers)
+		w.length(uint64(len(consumers)))
+		for _, name := range consumers {
+			consumer := group.Consumers[name]
+			w.string(name)
+			w.milliseconds(consumer.SeenTime)
+			w.milliseconds(consumer.ActiveTime)
+			owned := group.PendingRange(storage.StreamID{}, storage.MaxStreamID, 0, consumer)
+			w.length(uint64(len(owned)))
+			for _, entry := range owned {
+				w.raw(streamIDBytes(entry.ID))
+			}
+		}
+	}
+}
+
+// streamListpack encodes entries the way t_stream.c appends them, the
+// first entry is the master entry and the ones sharing its fields only
+// store their values
+func streamListpack(entries []storage.StreamEntry) []byte {
+	const (
+		flagNone       = 0
+		flagSameFields = 2
+	)
+
+	lp := newListpack()
+	master := entries[0]
+	masterFields := fieldNames(master.Fields)
+	lp.appendInt(int64(len(entries)))
+	lp.appendInt(0)
+	lp.appendInt(int64(len(masterFields)))
+	for _, field := range masterFields {
+		lp.appendString(field)
+	}
+	lp.appendInt(0)
+
+	for _, entry := range entries {
+		fields := fieldNames(entry.Fields)
+		sameFields := len(fields) == len(masterFields)
+		for i := 0; sameFields && i < len(fields); i++ {
+			sameFields = fields[i] == masterFields[i]
+		}
+
+		if sameFields {
+			lp.appendInt(flagSameFields)
+		} else {
+			lp.appendInt(flagNone)
+		}
+		lp.appendInt(int64(entry.ID.Ms - master.ID.Ms))
+		lp.appendInt(int64(entry.ID.Seq - master.ID.Seq))
+		if sameFields {
+			for i := 1; i < len(entry.Fields); i += 2 {
+				lp.appendString(entry.Fields[i])
+			}
+			lp.appendInt(int64(len(fields) + 3))
+		} else {
+			lp.appendInt(int64(len(fields)))
+			for _, value := range entry.Fields {
+				lp.appendString(value)
+			}
+			lp.appendInt(int64(2*len(fields) + 4))
+		}
+	}
+	return lp.bytes()
+}
+
+func fieldNames(fields []string) []string {
+	names := make([]string, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		names = append(names, fields[i])
+	}
+	return names
+}
+
+// streamIDBytes is the big endian form IDs take as radix tree keys
+func streamIDBytes(id storage.StreamID) []byte {
+	buf := binary.BigEndian.AppendUint64(nil, id.Ms)
+	return binary.BigEndian.AppendUint64(buf, id.Seq)
+}
+
+func (w *RedisFileWriter) streamID(id storage.StreamID) {
+	w.length(id.Ms)
+	w.length(id.Seq)
+}
+
+// string uses the integer encodings for short integers like redis does
+// and writes everything else as is
+func (w *RedisFileWriter) string(value string) {
+	if len(value) <= 11 {
+		if integer, err := strconv.ParseInt(value, 10, 32); err == nil && strconv.FormatInt(integer, 10) == value {
+			switch {
+			case integer >= math.MinInt8 && integer <= math.MaxInt8:
+				w.raw([]byte{lenEncoded<<6 | encodingInt8, byte(integer)})
+			case integer >= math.MinInt16 && integer <= math.MaxInt16:
+				w.raw(binary.LittleEndian.AppendUint16([]byte{lenEncoded<<6 | encodingInt16}, uint16(integer)))
+			default:
+				w.raw(binary.LittleEndian.AppendUint32([]byte{lenEncoded<<6 | encodingInt32}, uint32(integer)))
+			}
+			return
+		}
+	}
+
+	w.length(uint64(len(value)))
+	w.raw([]byte(value))
+}
+
+func (w *RedisFileWriter) length(length uint64) {
+	switch {
+	case length < 1<<6:
+		w.byte(len6Bit<<6 | byte(length))
+	case length < 1<<14:
+		w.raw([]byte{len14Bit<<6 | byte(length>>8), byte(length)})
+	case length <= math.MaxUint32:
+		w.raw(binary.BigEndian.AppendUint32([]byte{len32Bit}, uint32(length)))
+	default:
+		w.raw(binary.BigEndian.AppendUint64([]byte{len64Bit}, length))
+	}
+}
+
+func (w *RedisFileWriter) milliseconds(ms int64) {
+	w.raw(binary.LittleEndian.AppendUint64(nil, uint64(ms)))
+}
+
+func (w *RedisFileWriter) byte(b byte) {
+	w.raw([]byte{b})
+}
+
+// raw is where everything goes through, the first error sticks and is
+// returned by Write
+func (w *RedisFileWriter) raw(p []byte) {
+	if w.err != nil {
+		return
+	}
+	w.crc = updateCRC(w.crc, p)
+	_, w.err = w.writer.Write(p)
+}
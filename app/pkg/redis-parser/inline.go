@@ -0,0 +1,127 @@
+package redisparser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseInline turns a line typed by hand (nc, telnet) into a command.
+// Words are separated by spaces and can be quoted the way redis-cli does it.
+func parseInline(line string) (*Command, error) {
+	words, err := splitArgs(line)
+	if err != nil {
+		return nil, err
+	}
+
+	command := Command{}
+	if len(words) == 0 {
+		return &command, nil
+	}
+	command.Name = strings.ToUpper(words[0])
+	command.Args = words[1:]
+
+	return &command, nil
+}
+
+// splitArgs follows sdssplitargs of redis. Double quoted words understand
+// \n \r \t \b \a \xHH and escaped characters, single quoted words only
+// understand \'. A closing quote must be followed by a space or the end.
+func splitArgs(line string) ([]string, error) {
+	words := []string{}
+	i := 0
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i >= len(line) {
+			return words, nil
+		}
+
+		var word strings.Builder
+		inDoubleQuotes, inSingleQuotes := false, false
+		done := false
+		for !done {
+			if inDoubleQuotes {
+				if i >= len(line) {
+					return nil, fmt.Errorf("unbalanced quotes")
+				}
+				switch {
+				case line[i] == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHex(line[i+2]) && isHex(line[i+3]):
+					value, _ := strconv.ParseUint(line[i+2:i+4], 16, 8)
+					word.WriteByte(byte(value))
+					i += 3
+				case line[i] == '\\' && i+1 < len(line):
+					i++
+					word.WriteByte(unescape(line[i]))
+				case line[i] == '"':
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, fmt.Errorf("unbalanced quotes")
+					}
+					done = true
+				default:
+					word.WriteByte(line[i])
+				}
+			} else if inSingleQuotes {
+				if i >= len(line) {
+					return nil, fmt.Errorf("unbalanced quotes")
+				}
+				switch {
+				case line[i] == '\\' && i+1 < len(line) && line[i+1] == '\'':
+					i++
+					word.WriteByte('\'')
+				case line[i] == '\'':
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, fmt.Errorf("unbalanced quotes")
+					}
+					done = true
+				default:
+					word.WriteByte(line[i])
+				}
+			} else {
+				if i >= len(line) {
+					break
+				}
+				switch line[i] {
+				case ' ', '\n', '\r', '\t', 0:
+					done = true
+				case '"':
+					inDoubleQuotes = true
+				case '\'':
+					inSingleQuotes = true
+				default:
+					word.WriteByte(line[i])
+				}
+			}
+			if i < len(line) {
+				i++
+			}
+		}
+		words = append(words, word.String())
+	}
+}
+
+func unescape(c byte) byte {
+	switch c {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'b':
+		return '\b'
+	case 'a':
+		return '\a'
+	default:
+		return c
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\v' || c == '\f' || c == 0
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
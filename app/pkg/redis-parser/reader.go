@@ -0,0 +1,192 @@
+package redisparser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// same defaults as proto-max-bulk-len and the multibulk limit of redis
+	maxBulkLength  = 512 * 1024 * 1024
+	maxArrayLength = 1024 * 1024 * 1024
+
+	// we never trust the array or bulk headers for preallocation
+	maxPreallocatedArgs = 1024
+	maxPreallocatedBulk = 64 * 1024
+
+	// a header line longer than the buffer is a protocol error
+	readBufferSize = 64 * 1024
+)
+
+// ProtocolError means the stream can not be decoded anymore and
+// the connection should be closed after replying with it.
+type ProtocolError struct {
+	Message string
+}
+
+func (e *ProtocolError) Error() string {
+	return "Protocol error: " + e.Message
+}
+
+// Reader decodes commands from a connection. Bytes are buffered between
+// reads so a frame split over many packets is only returned once it is
+// complete, and the bytes after a frame are kept for the next command
+// which is what makes pipelining work.
+type Reader struct {
+	reader *bufio.Reader
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{reader: bufio.NewReaderSize(r, readBufferSize)}
+}
+
+// Buffered reports how many bytes of following commands are already read,
+// so callers can batch the replies of a pipeline into one write.
+func (r *Reader) Buffered() int {
+	return r.reader.Buffered()
+}
+
+// Peek waits until more input arrives without consuming it, which lets
+// a blocked client notice that its connection went away
+func (r *Reader) Peek() error {
+	_, err := r.reader.Peek(1)
+	return err
+}
+
+// ReadCommand blocks until the next complete command is available.
+// It returns io.EOF when the peer closed the connection between commands.
+func (r *Reader) ReadCommand() (*Command, error) {
+	prefix, err := r.reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	if prefix != '*' {
+		r.reader.UnreadByte()
+		return r.readInlineCommand()
+	}
+
+	argCount, err := r.readLength(maxArrayLength, "multibulk")
+	if err != nil {
+		return nil, err
+	}
+
+	command := Command{}
+	if argCount <= 0 {
+		return &command, nil
+	}
+	command.Args = make([]string, 0, min(argCount-1, maxPreallocatedArgs))
+
+	for i := 0; i < argCount; i++ {
+		data, err := r.readBulkString()
+		if err != nil {
+			return nil, err
+		}
+
+		if i == 0 {
+			command.Name = strings.ToUpper(data)
+		} else {
+			command.Args = append(command.Args, data)
+		}
+	}
+
+	return &command, nil
+}
+
+func (r *Reader) readInlineCommand() (*Command, error) {
+	line, err := r.reader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, &ProtocolError{Message: "too big inline request"}
+	}
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	command, err := parseInline(strings.TrimSuffix(string(line[:len(line)-1]), "\r"))
+	if err != nil {
+		return nil, &ProtocolError{Message: "unbalanced quotes in request"}
+	}
+
+	return command, nil
+}
+
+func (r *Reader) readBulkString() (string, error) {
+	prefix, err := r.readByte()
+	if err != nil {
+		return "", err
+	}
+	if prefix != '$' {
+		return "", &ProtocolError{Message: fmt.Sprintf("expected '$', got '%c'", prefix)}
+	}
+
+	length, err := r.readLength(maxBulkLength, "bulk")
+	if err != nil {
+		return "", err
+	}
+	if length < 0 {
+		return "", &ProtocolError{Message: "invalid bulk length"}
+	}
+
+	// the payload is read by its length, so it can contain anything. The
+	// buffer grows as the bytes arrive, a header alone allocates little.
+	var buffer bytes.Buffer
+	buffer.Grow(min(length+2, maxPreallocatedBulk))
+	if _, err := io.CopyN(&buffer, r.reader, int64(length+2)); err != nil {
+		return "", unexpectedEOF(err)
+	}
+	data := buffer.Bytes()
+	if data[length] != '\r' || data[length+1] != '\n' {
+		return "", &ProtocolError{Message: "bulk string is not terminated by CRLF"}
+	}
+
+	return string(data[:length]), nil
+}
+
+func (r *Reader) readLength(max int, kind string) (int, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return 0, err
+	}
+
+	length, err := strconv.Atoi(line)
+	if err != nil || length > max {
+		return 0, &ProtocolError{Message: "invalid " + kind + " length"}
+	}
+
+	return length, nil
+}
+
+func (r *Reader) readLine() (string, error) {
+	line, err := r.reader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", &ProtocolError{Message: "too big line"}
+	}
+	if err != nil {
+		return "", unexpectedEOF(err)
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", &ProtocolError{Message: "line is not terminated by CRLF"}
+	}
+
+	return string(line[:len(line)-2]), nil
+}
+
+func (r *Reader) readByte() (byte, error) {
+	b, err := r.reader.ReadByte()
+	if err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	return b, nil
+}
+
+// a connection closing in the middle of a frame is not a clean EOF
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -1,62 +1,284 @@
 package response
 
 import (
-	"fmt"
+	"math"
+	"strconv"
+)
+
+type Type int
+
+const (
+	SimpleString Type = iota
+	Error
+	Integer
+	BulkString
+	// Null is the nil bulk string, NullArray the nil multi bulk
+	Null
+	NullArray
+	Array
+
+	// RESP3 only types, they are downgraded when the client speaks RESP2
+	Map
+	Set
+	Double
+	Boolean
+	BigNumber
+	Verbatim
+	Push
+
+	// NoReply writes nothing, for commands like SUBSCRIBE that answer
+	// with pushes instead
+	NoReply
+)
 
-	"github.com/codecrafters-io/redis-starter-go/app/pkg/command"
+const (
+	ProtocolRESP2 = 2
+	ProtocolRESP3 = 3
 )
 
-type Response struct {
-	Command command.Command
-	Status  string
-	Data    []string
-	Error   string
-	IsMulti bool
-	// Needed this because redises weird behavior when
-	// INFO REPLICATION command is called
-	IsBulkStringArray bool
+// Value is one node of a RESP reply. Arrays keep their elements in
+// Array so replies can nest as deep as a command needs, maps keep
+// their keys and values flattened there as well.
+type Value struct {
+	Type  Type
+	Str   string
+	Int   int64
+	Float float64
+	Array []Value
+	// Attributes are sent before the value itself, only to RESP3 clients
+	Attributes []Value
 }
 
-func (r *Response) ToRedisFormat() string {
-	if r.Error != "" {
-		//should make a custom error type for this
-		if r.Error == "this data is expeired" {
-			return "$-1\r\n"
-		}
+func NewSimpleString(value string) Value {
+	return Value{Type: SimpleString, Str: value}
+}
+
+func NewOK() Value {
+	return NewSimpleString("OK")
+}
 
-		return fmt.Sprintf("-ERR %s\r\n", r.Error)
+// NewError replies with a generic ERR error
+func NewError(message string) Value {
+	return NewErrorCode("ERR", message)
+}
+
+// NewErrorCode is for errors clients match on, like WRONGTYPE or EXECABORT
+func NewErrorCode(code, message string) Value {
+	return Value{Type: Error, Str: code + " " + message}
+}
+
+func NewInteger(value int64) Value {
+	return Value{Type: Integer, Int: value}
+}
+
+func NewBulkString(value string) Value {
+	return Value{Type: BulkString, Str: value}
+}
+
+func NewNull() Value {
+	return Value{Type: Null}
+}
+
+func NewNullArray() Value {
+	return Value{Type: NullArray}
+}
+
+func NewArray(values ...Value) Value {
+	if values == nil {
+		values = []Value{}
+	}
+	return Value{Type: Array, Array: values}
+}
+
+func NewBulkStringArray(values []string) Value {
+	array := make([]Value, len(values))
+	for i, value := range values {
+		array[i] = NewBulkString(value)
+	}
+	return NewArray(array...)
+}
+
+// NewMap takes keys and values one after another
+func NewMap(keysAndValues ...Value) Value {
+	if keysAndValues == nil {
+		keysAndValues = []Value{}
 	}
-	if r.IsBulkStringArray {
-		if len(r.Data) == 0 {
-			return "$-1\r\n"
+	return Value{Type: Map, Array: keysAndValues}
+}
+
+func NewSet(values ...Value) Value {
+	if values == nil {
+		values = []Value{}
+	}
+	return Value{Type: Set, Array: values}
+}
+
+func NewBulkStringSet(values []string) Value {
+	reply := NewBulkStringArray(values)
+	reply.Type = Set
+	return reply
+}
+
+func NewDouble(value float64) Value {
+	return Value{Type: Double, Float: value}
+}
+
+func NewBoolean(value bool) Value {
+	if value {
+		return Value{Type: Boolean, Int: 1}
+	}
+	return Value{Type: Boolean}
+}
+
+func NewBigNumber(value string) Value {
+	return Value{Type: BigNumber, Str: value}
+}
+
+// NewVerbatim is a string with a three letter format like txt or mkd
+func NewVerbatim(format, value string) Value {
+	return Value{Type: Verbatim, Str: format + ":" + value}
+}
+
+func NewPush(values ...Value) Value {
+	return Value{Type: Push, Array: values}
+}
+
+func NewNoReply() Value {
+	return Value{Type: NoReply}
+}
+
+// WithAttributes returns the value with keys and values of an attribute map
+func (v Value) WithAttributes(keysAndValues ...Value) Value {
+	v.Attributes = keysAndValues
+	return v
+}
+
+func (v Value) IsError() bool {
+	return v.Type == Error
+}
+
+func (v Value) ToRedisFormat() string {
+	return string(v.Encode(nil, ProtocolRESP2))
+}
+
+// Encode appends the wire format of the value to buf. RESP2 clients get
+// the closest RESP2 type for RESP3 only values.
+func (v Value) Encode(buf []byte, protocol int) []byte {
+	if protocol == ProtocolRESP3 && v.Attributes != nil {
+		buf = appendHeader(buf, '|', len(v.Attributes)/2)
+		for _, element := range v.Attributes {
+			buf = element.Encode(buf, protocol)
+		}
+	}
+
+	switch v.Type {
+	case SimpleString:
+		return appendLine(buf, '+', v.Str)
+	case Error:
+		return appendLine(buf, '-', v.Str)
+	case Integer:
+		buf = append(buf, ':')
+		buf = strconv.AppendInt(buf, v.Int, 10)
+		return append(buf, '\r', '\n')
+	case BulkString:
+		return appendBulk(buf, '$', v.Str)
+	case Null:
+		if protocol == ProtocolRESP3 {
+			return append(buf, "_\r\n"...)
 		}
-		if len(r.Data) == 1 {
-			return fmt.Sprintf("$%d\r\n%s\r\n", len(r.Data[0]),
-				r.Data[0])
+		return append(buf, "$-1\r\n"...)
+	case NullArray:
+		if protocol == ProtocolRESP3 {
+			return append(buf, "_\r\n"...)
 		}
-		totalLength := 0
-		for _, value := range r.Data {
-			// plus one is for newline
-			totalLength += len(value) + 1
+		return append(buf, "*-1\r\n"...)
+	case Array:
+		return appendAggregate(buf, '*', v.Array, len(v.Array), protocol)
+	case Map:
+		if protocol == ProtocolRESP3 {
+			return appendAggregate(buf, '%', v.Array, len(v.Array)/2, protocol)
 		}
-		result := fmt.Sprintf("$%d\r\n", totalLength)
-		for _, value := range r.Data {
-			result += fmt.Sprintf("%s\n", value)
+		return appendAggregate(buf, '*', v.Array, len(v.Array), protocol)
+	case Set:
+		if protocol == ProtocolRESP3 {
+			return appendAggregate(buf, '~', v.Array, len(v.Array), protocol)
 		}
-		result += "\r\n"
-		return result
-	}
-	if len(r.Data) > 1 || r.IsMulti {
-		result := fmt.Sprintf("*%d\r\n", len(r.Data))
-		for _, value := range r.Data {
-			result += fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+		return appendAggregate(buf, '*', v.Array, len(v.Array), protocol)
+	case Push:
+		if protocol == ProtocolRESP3 {
+			return appendAggregate(buf, '>', v.Array, len(v.Array), protocol)
+		}
+		return appendAggregate(buf, '*', v.Array, len(v.Array), protocol)
+	case Double:
+		if protocol == ProtocolRESP3 {
+			return appendLine(buf, ',', FormatDouble(v.Float))
+		}
+		return appendBulk(buf, '$', FormatDouble(v.Float))
+	case Boolean:
+		if protocol == ProtocolRESP3 {
+			if v.Int != 0 {
+				return append(buf, "#t\r\n"...)
+			}
+			return append(buf, "#f\r\n"...)
 		}
-		return result
+		buf = append(buf, ':')
+		buf = strconv.AppendInt(buf, v.Int, 10)
+		return append(buf, '\r', '\n')
+	case BigNumber:
+		if protocol == ProtocolRESP3 {
+			return appendLine(buf, '(', v.Str)
+		}
+		return appendBulk(buf, '$', v.Str)
+	case Verbatim:
+		if protocol == ProtocolRESP3 {
+			return appendBulk(buf, '=', v.Str)
+		}
+		// the format prefix is not part of the string in RESP2
+		return appendBulk(buf, '$', v.Str[4:])
+	}
+
+	return buf
+}
+
+// FormatDouble formats floats the way redis prints them in replies
+func FormatDouble(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "inf"
+	case math.IsInf(value, -1):
+		return "-inf"
+	case math.IsNaN(value):
+		return "nan"
+	}
+	// plain notation unless the exponent gets out of hand, like redis
+	if abs := math.Abs(value); abs == 0 || (abs >= 1e-5 && abs < 1e21) {
+		return strconv.FormatFloat(value, 'f', -1, 64)
 	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
 
-	if len(r.Data) == 1 && r.Data[0] != "" {
-		return fmt.Sprintf("+%s\r\n", r.Data[0])
+func appendLine(buf []byte, prefix byte, line string) []byte {
+	buf = append(buf, prefix)
+	buf = append(buf, line...)
+	return append(buf, '\r', '\n')
+}
+
+func appendBulk(buf []byte, prefix byte, data string) []byte {
+	buf = appendHeader(buf, prefix, len(data))
+	buf = append(buf, data...)
+	return append(buf, '\r', '\n')
+}
+
+func appendAggregate(buf []byte, prefix byte, elements []Value, length int, protocol int) []byte {
+	buf = appendHeader(buf, prefix, length)
+	for _, element := range elements {
+		buf = element.Encode(buf, protocol)
 	}
+	return buf
+}
 
-	return "+OK\r\n"
+func appendHeader(buf []byte, prefix byte, length int) []byte {
+	buf = append(buf, prefix)
+	buf = strconv.AppendInt(buf, int64(length), 10)
+	return append(buf, '\r', '\n')
 }
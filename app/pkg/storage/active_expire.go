@@ -0,0 +1,99 @@
+package storage
+
+import "time"
+
+// Same knobs as the active expire cycle of redis with the default effort
+const (
+	activeExpireHz = 10
+	// keys sampled from a shard per loop
+	activeExpireKeysPerLoop = 20
+	// a shard is sampled again while more than this percent was expired
+	activeExpireAcceptableStale = 10
+	// percent of every tick the cycle may spend expiring keys
+	activeExpireCyclePercent = 25
+)
+
+// StartActiveExpire reclaims expired keys and hash fields nobody reads
+// anymore. Every tick it samples the volatile keys and hashes of the
+// shards and keeps going on a shard while many of its samples were
+// expired, so the effort adapts to how many keys are expiring. A cycle
+// that runs out of time resumes from the shard it stopped at on the next
+// tick.
+func (k *Keyspace) StartActiveExpire() {
+	tick := time.Second / activeExpireHz
+	budget := tick * activeExpireCyclePercent / 100
+
+	go func() {
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+		for range ticker.C {
+			k.activeExpireCycle(budget)
+		}
+	}()
+}
+
+func (k *Keyspace) activeExpireCycle(budget time.Duration) {
+	deadline := time.Now().Add(budget)
+	for i := 0; i < shardCount; i++ {
+		index := (k.nextExpireShard + i) % shardCount
+		if !k.expireShard(k.shards[index], deadline) {
+			k.nextExpireShard = index
+			return
+		}
+	}
+}
+
+// expireShard returns false when the deadline passed before the shard was done
+func (k *Keyspace) expireShard(shard *shard, deadline time.Time) bool {
+	for {
+		if time.Now().After(deadline) {
+			return false
+		}
+
+		shard.mu.Lock()
+		now := time.Now().UnixMilli()
+		sampled, expired := 0, 0
+		// map iteration starts at a random spot which makes it a sample
+		for key := range shard.expires {
+			if sampled == activeExpireKeysPerLoop {
+				break
+			}
+			sampled++
+			if data, _ := shard.get(key); data.isExpired(now) {
+				k.expire(key)
+				expired++
+			}
+		}
+		hashesSampled, hashesExpired := k.expireHashFields(shard, now)
+		sampled += hashesSampled
+		expired += hashesExpired
+		shard.mu.Unlock()
+
+		if sampled == 0 || expired*100/sampled <= activeExpireAcceptableStale {
+			return true
+		}
+	}
+}
+
+// expireHashFields samples the hashes of the shard that have fields with a
+// TTL, a hash counts as expired when it lost any field
+func (k *Keyspace) expireHashFields(shard *shard, now int64) (int, int) {
+	sampled, expired := 0, 0
+	for key := range shard.hexpires {
+		if sampled == activeExpireKeysPerLoop {
+			break
+		}
+		sampled++
+		data, ok := shard.get(key)
+		if !ok || data.Type != TypeHash || data.Hash.volatile == 0 {
+			delete(shard.hexpires, key)
+			continue
+		}
+
+		if data.Hash.hasExpiredFields(now) {
+			expired++
+			k.expireIfNeeded(key, data, now)
+		}
+	}
+	return sampled, expired
+}
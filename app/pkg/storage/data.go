@@ -0,0 +1,119 @@
+package storage
+
+import "strconv"
+
+type ValueType int
+
+const (
+	TypeString ValueType = iota
+	TypeList
+	TypeHash
+	TypeSet
+	TypeZSet
+	TypeStream
+)
+
+// String is the name TYPE replies with
+func (t ValueType) String() string {
+	switch t {
+	case TypeString:
+		return "string"
+	case TypeList:
+		return "list"
+	case TypeHash:
+		return "hash"
+	case TypeSet:
+		return "set"
+	case TypeZSet:
+		return "zset"
+	case TypeStream:
+		return "stream"
+	}
+	return "none"
+}
+
+// Data is a value of the keyspace. Type tells which of the value fields
+// is in use, strings keep using Value.
+type Data struct {
+	Type           ValueType
+	Value          string
+	List           *List
+	Hash           *Hash
+	Set            *Set
+	ZSet           *ZSet
+	Stream         *Stream
+	ExpeireEnabled bool
+	ExpeireDate    int64
+}
+
+// clone copies the data so the copy can be changed on its own
+func (d *Data) clone() *Data {
+	copy := *d
+	if d.List != nil {
+		copy.List = d.List.Clone()
+	}
+	if d.Hash != nil {
+		copy.Hash = d.Hash.Clone()
+	}
+	if d.Set != nil {
+		copy.Set = d.Set.Clone()
+	}
+	if d.ZSet != nil {
+		copy.ZSet = d.ZSet.Clone()
+	}
+	if d.Stream != nil {
+		copy.Stream = d.Stream.Clone()
+	}
+	return &copy
+}
+
+func (d *Data) isExpired(now int64) bool {
+	return d.ExpeireEnabled && d.ExpeireDate < now
+}
+
+// isEmpty is true for containers left without elements, redis never
+// keeps those around. Streams are the exception, an empty stream still
+// has its last ID and its consumer groups.
+func (d *Data) isEmpty() bool {
+	switch d.Type {
+	case TypeList:
+		return d.List.Len() == 0
+	case TypeHash:
+		return d.Hash.Len() == 0
+	case TypeSet:
+		return d.Set.Len() == 0
+	case TypeZSet:
+		return d.ZSet.Len() == 0
+	}
+	return false
+}
+
+// encoding names the representation like OBJECT ENCODING of redis does
+func (d *Data) encoding() string {
+	switch d.Type {
+	case TypeList:
+		if d.List.IsCompact() {
+			return "listpack"
+		}
+		return "quicklist"
+	case TypeHash:
+		if d.Hash.IsCompact() {
+			return "listpack"
+		}
+		return "hashtable"
+	case TypeSet:
+		return d.Set.Encoding()
+	case TypeZSet:
+		return "skiplist"
+	case TypeStream:
+		return "stream"
+	}
+
+	if _, err := strconv.ParseInt(d.Value, 10, 64); err == nil && len(d.Value) <= 20 {
+		return "int"
+	}
+	if len(d.Value) <= 44 {
+		return "embstr"
+	}
+	return "raw"
+}
@@ -0,0 +1,260 @@
+package storage
+
+import "math"
+
+// Small hashes are kept like the listpacks of redis, a slice searched
+// linearly, until one of these limits is passed
+const (
+	hashMaxCompactEntries = 128
+	hashMaxCompactValue   = 64
+)
+
+type hashEntry struct {
+	field string
+	value string
+	// expireAt is the unix time in milliseconds the field expires at, 0
+	// when it has no TTL
+	expireAt int64
+	deleted  bool
+}
+
+// Hash maps fields to values, each field with an optional TTL. Compact
+// hashes keep their entries packed in insertion order, larger ones index
+// them with a map and reuse the slots of deleted fields. Entries never
+// move to another slot in that mode, so the slot is a stable HSCAN cursor.
+type Hash struct {
+	entries []hashEntry
+	// index is nil while the hash is compact
+	index  map[string]int
+	free   []int
+	length int
+
+	// volatile counts the fields with a TTL and nextExpire is the earliest
+	// of them, fields are only looked at for expiry once it passed
+	volatile   int
+	nextExpire int64
+}
+
+func NewHash() *Hash {
+	return &Hash{}
+}
+
+func (h *Hash) Len() int {
+	return h.length
+}
+
+func (h *Hash) IsCompact() bool {
+	return h.index == nil
+}
+
+func (h *Hash) Get(field string) (string, bool) {
+	entry := h.find(field)
+	if entry == nil {
+		return "", false
+	}
+	return entry.value, true
+}
+
+// Set stores value in field and clears the TTL the field had, true when
+// the field is new
+func (h *Hash) Set(field, value string) bool {
+	if entry := h.find(field); entry != nil {
+		entry.value = value
+		h.setExpire(entry, 0)
+		h.convertIfLarge(value)
+		return false
+	}
+
+	h.convertIfLarge(field)
+	h.convertIfLarge(value)
+	entry := hashEntry{field: field, value: value}
+	if h.index == nil {
+		h.entries = append(h.entries, entry)
+	} else if len(h.free) > 0 {
+		slot := h.free[len(h.free)-1]
+		h.free = h.free[:len(h.free)-1]
+		h.entries[slot] = entry
+		h.index[field] = slot
+	} else {
+		h.entries = append(h.entries, entry)
+		h.index[field] = len(h.entries) - 1
+	}
+	h.length++
+	if h.index == nil && h.length > hashMaxCompactEntries {
+		h.convert()
+	}
+	return true
+}
+
+// Update changes the value of a field and keeps its TTL, false when the
+// field does not exist
+func (h *Hash) Update(field, value string) bool {
+	entry := h.find(field)
+	if entry == nil {
+		return false
+	}
+	entry.value = value
+	h.convertIfLarge(value)
+	return true
+}
+
+func (h *Hash) Delete(field string) bool {
+	if h.index == nil {
+		for i := range h.entries {
+			if h.entries[i].field == field {
+				h.setExpire(&h.entries[i], 0)
+				h.entries = append(h.entries[:i], h.entries[i+1:]...)
+				h.length--
+				return true
+			}
+		}
+		return false
+	}
+
+	slot, ok := h.index[field]
+	if !ok {
+		return false
+	}
+	h.setExpire(&h.entries[slot], 0)
+	h.entries[slot] = hashEntry{deleted: true}
+	delete(h.index, field)
+	h.free = append(h.free, slot)
+	h.length--
+	return true
+}
+
+// ExpireAt returns the unix time in milliseconds the field expires at, 0
+// when it has no TTL
+func (h *Hash) ExpireAt(field string) (int64, bool) {
+	entry := h.find(field)
+	if entry == nil {
+		return 0, false
+	}
+	return entry.expireAt, true
+}
+
+// SetExpireAt gives the field a TTL, 0 removes it
+func (h *Hash) SetExpireAt(field string, when int64) bool {
+	entry := h.find(field)
+	if entry == nil {
+		return false
+	}
+	h.setExpire(entry, when)
+	return true
+}
+
+// Each calls fn for every field in slot order until it returns false
+func (h *Hash) Each(fn func(field, value string) bool) {
+	for _, entry := range h.entries {
+		if !entry.deleted && !fn(entry.field, entry.value) {
+			return
+		}
+	}
+}
+
+// Scan returns the fields and values of the slots starting at cursor
+// until count fields were found, and the cursor to continue from which
+// is 0 at the end. Compact hashes are returned whole like redis does.
+func (h *Hash) Scan(cursor uint64, count int) (uint64, []string) {
+	if h.index == nil {
+		count = math.MaxInt
+	}
+
+	pairs := []string{}
+	for ; cursor < uint64(len(h.entries)); cursor++ {
+		if len(pairs)/2 >= count {
+			return cursor, pairs
+		}
+		if entry := h.entries[cursor]; !entry.deleted {
+			pairs = append(pairs, entry.field, entry.value)
+		}
+	}
+	return 0, pairs
+}
+
+func (h *Hash) Clone() *Hash {
+	clone := *h
+	clone.entries = append([]hashEntry{}, h.entries...)
+	clone.free = append([]int{}, h.free...)
+	if h.index != nil {
+		clone.index = make(map[string]int, len(h.index))
+		for field, slot := range h.index {
+			clone.index[field] = slot
+		}
+	}
+	return &clone
+}
+
+// hasExpiredFields is true once the earliest TTL of the fields passed
+func (h *Hash) hasExpiredFields(now int64) bool {
+	return h.volatile > 0 && now > h.nextExpire
+}
+
+// expireFields deletes the fields whose TTL passed, it is cheap until the
+// earliest TTL is reached
+func (h *Hash) expireFields(now int64) {
+	if !h.hasExpiredFields(now) {
+		return
+	}
+
+	expired := []string{}
+	for _, entry := range h.entries {
+		if !entry.deleted && entry.expireAt != 0 && entry.expireAt < now {
+			expired = append(expired, entry.field)
+		}
+	}
+	for _, field := range expired {
+		h.Delete(field)
+	}
+
+	h.nextExpire = math.MaxInt64
+	for _, entry := range h.entries {
+		if !entry.deleted && entry.expireAt != 0 {
+			h.nextExpire = min(h.nextExpire, entry.expireAt)
+		}
+	}
+}
+
+func (h *Hash) find(field string) *hashEntry {
+	if h.index == nil {
+		for i := range h.entries {
+			if h.entries[i].field == field {
+				return &h.entries[i]
+			}
+		}
+		return nil
+	}
+
+	slot, ok := h.index[field]
+	if !ok {
+		return nil
+	}
+	return &h.entries[slot]
+}
+
+func (h *Hash) setExpire(entry *hashEntry, when int64) {
+	switch {
+	case entry.expireAt == 0 && when != 0:
+		h.volatile++
+	case entry.expireAt != 0 && when == 0:
+		h.volatile--
+	}
+	entry.expireAt = when
+	if when != 0 && (h.volatile == 1 || when < h.nextExpire) {
+		h.nextExpire = when
+	}
+}
+
+func (h *Hash) convertIfLarge(value string) {
+	if h.index == nil && len(value) > hashMaxCompactValue {
+		h.convert()
+	}
+}
+
+// convert builds the index, hashes never go back to the compact form
+func (h *Hash) convert() {
+	h.index = make(map[string]int, len(h.entries))
+	for slot, entry := range h.entries {
+		h.index[entry.field] = slot
+	}
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// scanHash runs a whole HSCAN and returns how many times each field came
+func scanHash(t *testing.T, h *Hash, count int) map[string]int {
+	t.Helper()
+	seen := map[string]int{}
+	cursor := uint64(0)
+	for {
+		var pairs []string
+		cursor, pairs = h.Scan(cursor, count)
+		if len(pairs)%2 != 0 {
+			t.Fatalf("HSCAN returned %d strings, not pairs", len(pairs))
+		}
+		for i := 0; i < len(pairs); i += 2 {
+			seen[pairs[i]]++
+		}
+		if cursor == 0 {
+			return seen
+		}
+	}
+}
+
+// Every field comes exactly once, compact hashes whole in a single call
+func TestHashScan(t *testing.T) {
+	for _, size := range []int{10, hashMaxCompactEntries * 4} {
+		h := NewHash()
+		for i := 0; i < size; i++ {
+			h.Set(fmt.Sprintf("f%d", i), "v")
+		}
+		h.Delete("f3")
+
+		if h.IsCompact() {
+			if cursor, pairs := h.Scan(0, 1); cursor != 0 || len(pairs) != 2*(size-1) {
+				t.Fatalf("a compact hash returned %d strings and cursor %d", len(pairs), cursor)
+			}
+		}
+		for _, count := range []int{1, 10, math.MaxInt} {
+			seen := scanHash(t, h, count)
+			if len(seen) != size-1 || seen["f3"] != 0 {
+				t.Fatalf("HSCAN with COUNT %d of %d fields returned %d", count, size-1, len(seen))
+			}
+			for field, n := range seen {
+				if n != 1 {
+					t.Fatalf("%s was returned %d times", field, n)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,612 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	shardCount = 64
+	// every shard splits its keys over tables that are never resized, so
+	// a SCAN cursor is simply the next table to visit
+	tablesPerShard = 256
+	tableCount     = shardCount * tablesPerShard
+)
+
+type shard struct {
+	mu sync.Mutex
+	// tables are created on their first insert
+	tables [tablesPerShard]map[string]*Data
+	// expires holds the keys of data that has a TTL, the active expire
+	// cycle samples from here instead of walking every key
+	expires map[string]struct{}
+	// hexpires holds the keys of hashes that may have fields with a TTL
+	hexpires map[string]struct{}
+}
+
+// Keyspace is the key to value map of the server split into lock-striped
+// shards. Its data operations do not lock anything themselves, every
+// command runs inside Atomic holding the shards of all of its keys so a
+// command is applied as a whole or not seen at all by other clients.
+type Keyspace struct {
+	shards [shardCount]*shard
+
+	// counters are atomic so INFO can read them without locking
+	keys        atomic.Int64
+	volatile    atomic.Int64
+	expiredKeys atomic.Int64
+
+	nextExpireShard int
+	// loading is set while the AOF is replayed, nothing expires then so
+	// the commands find the keys they found when they first ran
+	loading atomic.Bool
+
+	// snapshots are the ones whose copy is not done, they only change
+	// with every shard locked
+	snapshots []*Snapshot
+}
+
+func newKeyspace(data map[string]Data) *Keyspace {
+	keyspace := &Keyspace{}
+	for i := range keyspace.shards {
+		keyspace.shards[i] = &shard{expires: make(map[string]struct{}), hexpires: make(map[string]struct{})}
+	}
+	for key, value := range data {
+		value := value
+		keyspace.insert(key, &value)
+	}
+	return keyspace
+}
+
+// Atomic runs fn holding the locks of the shards the keys live in. The
+// shards are always locked in the same order so commands sharing keys
+// can not deadlock each other.
+func (k *Keyspace) Atomic(keys []string, fn func()) {
+	indexes := make([]int, 0, len(keys))
+	for _, key := range keys {
+		indexes = append(indexes, int(keyHash(key)%shardCount))
+	}
+	sort.Ints(indexes)
+
+	locked := indexes[:0]
+	for i, index := range indexes {
+		if i > 0 && indexes[i-1] == index {
+			continue
+		}
+		k.shards[index].mu.Lock()
+		locked = append(locked, index)
+	}
+	defer func() {
+		for _, index := range locked {
+			k.shards[index].mu.Unlock()
+		}
+	}()
+
+	fn()
+}
+
+// AtomicAll runs fn with the whole keyspace locked, for commands like
+// KEYS that look at every key
+func (k *Keyspace) AtomicAll(fn func()) {
+	for _, shard := range k.shards {
+		shard.mu.Lock()
+	}
+	defer func() {
+		for _, shard := range k.shards {
+			shard.mu.Unlock()
+		}
+	}()
+
+	fn()
+}
+
+func (k *Keyspace) Get(key string) (string, error) {
+	data, ok := k.shardFor(key).get(key)
+
+	if !ok {
+		return "", ErrKeyNotFound
+	}
+	if k.expireIfNeeded(key, data, time.Now().UnixMilli()) {
+		return "", ErrKeyExpired
+	}
+	if data.Type != TypeString {
+		return "", ErrWrongType
+	}
+
+	return data.Value, nil
+}
+
+func (k *Keyspace) Set(key string, value string, experie *int64) error {
+	data := &Data{Value: value}
+	if experie != nil {
+		data.ExpeireDate = time.Now().UnixMilli() + *experie
+		data.ExpeireEnabled = true
+	}
+
+	k.insert(key, data)
+	return nil
+}
+
+// SetKeepTTL replaces the value of the key but keeps the TTL it has,
+// which is what commands that modify a string in place want
+func (k *Keyspace) SetKeepTTL(key string, value string) error {
+	if data := k.lookup(key); data != nil {
+		data.Type = TypeString
+		data.Value = value
+		data.List, data.Hash, data.Set, data.ZSet, data.Stream = nil, nil, nil, nil, nil
+		return nil
+	}
+
+	k.insert(key, &Data{Value: value})
+	return nil
+}
+
+// Delete removes the key, false when there was nothing to remove
+func (k *Keyspace) Delete(key string) bool {
+	if k.lookup(key) == nil {
+		return false
+	}
+	return k.remove(key)
+}
+
+func (k *Keyspace) Exists(key string) bool {
+	return k.lookup(key) != nil
+}
+
+// Type is the type name TYPE replies with, "none" for missing keys
+func (k *Keyspace) Type(key string) string {
+	data := k.lookup(key)
+	if data == nil {
+		return "none"
+	}
+	return data.Type.String()
+}
+
+// Encoding is the internal representation OBJECT ENCODING reports
+func (k *Keyspace) Encoding(key string) (string, error) {
+	data := k.lookup(key)
+	if data == nil {
+		return "", ErrKeyNotFound
+	}
+	return data.encoding(), nil
+}
+
+// LookupList returns the list stored at key, nil when the key is missing
+func (k *Keyspace) LookupList(key string) (*List, error) {
+	data := k.lookup(key)
+	if data == nil {
+		return nil, nil
+	}
+	if data.Type != TypeList {
+		return nil, ErrWrongType
+	}
+	return data.List, nil
+}
+
+// LookupOrCreateList is LookupList that creates an empty list for a
+// missing key, callers must push to it or call DeleteIfEmpty
+func (k *Keyspace) LookupOrCreateList(key string) (*List, error) {
+	list, err := k.LookupList(key)
+	if err != nil || list != nil {
+		return list, err
+	}
+
+	list = NewList()
+	k.insert(key, &Data{Type: TypeList, List: list})
+	return list, nil
+}
+
+// LookupHash returns the hash stored at key, nil when the key is missing.
+// Fields whose TTL passed are already deleted by lookup.
+func (k *Keyspace) LookupHash(key string) (*Hash, error) {
+	data := k.lookup(key)
+	if data == nil {
+		return nil, nil
+	}
+	if data.Type != TypeHash {
+		return nil, ErrWrongType
+	}
+	return data.Hash, nil
+}
+
+// LookupOrCreateHash is LookupHash that creates an empty hash for a
+// missing key, callers must add to it or call DeleteIfEmpty
+func (k *Keyspace) LookupOrCreateHash(key string) (*Hash, error) {
+	hash, err := k.LookupHash(key)
+	if err != nil || hash != nil {
+		return hash, err
+	}
+
+	hash = NewHash()
+	k.insert(key, &Data{Type: TypeHash, Hash: hash})
+	return hash, nil
+}
+
+// TrackHashExpires lets the active expire cycle find the hash at key, it
+// is called after fields were given a TTL
+func (k *Keyspace) TrackHashExpires(key string) {
+	if data := k.lookup(key); data != nil && data.Type == TypeHash && data.Hash.volatile > 0 {
+		k.shardFor(key).hexpires[key] = struct{}{}
+	}
+}
+
+// LookupSet returns the set stored at key, nil when the key is missing
+func (k *Keyspace) LookupSet(key string) (*Set, error) {
+	data := k.lookup(key)
+	if data == nil {
+		return nil, nil
+	}
+	if data.Type != TypeSet {
+		return nil, ErrWrongType
+	}
+	return data.Set, nil
+}
+
+// LookupOrCreateSet is LookupSet that creates an empty set for a missing
+// key, callers must add to it or call DeleteIfEmpty
+func (k *Keyspace) LookupOrCreateSet(key string) (*Set, error) {
+	set, err := k.LookupSet(key)
+	if err != nil || set != nil {
+		return set, err
+	}
+
+	set = NewSet()
+	k.insert(key, &Data{Type: TypeSet, Set: set})
+	return set, nil
+}
+
+// StoreSet replaces whatever key held with set, an empty set deletes the
+// key
+func (k *Keyspace) StoreSet(key string, set *Set) {
+	k.remove(key)
+	if set.Len() > 0 {
+		k.insert(key, &Data{Type: TypeSet, Set: set})
+	}
+}
+
+// LookupZSet returns the sorted set stored at key, nil when the key is
+// missing
+func (k *Keyspace) LookupZSet(key string) (*ZSet, error) {
+	data := k.lookup(key)
+	if data == nil {
+		return nil, nil
+	}
+	if data.Type != TypeZSet {
+		return nil, ErrWrongType
+	}
+	return data.ZSet, nil
+}
+
+// LookupOrCreateZSet is LookupZSet that creates an empty sorted set for a
+// missing key, callers must add to it or call DeleteIfEmpty
+func (k *Keyspace) LookupOrCreateZSet(key string) (*ZSet, error) {
+	zset, err := k.LookupZSet(key)
+	if err != nil || zset != nil {
+		return zset, err
+	}
+
+	zset = NewZSet()
+	k.insert(key, &Data{Type: TypeZSet, ZSet: zset})
+	return zset, nil
+}
+
+// StoreZSet replaces whatever key held with zset, an empty sorted set
+// deletes the key
+func (k *Keyspace) StoreZSet(key string, zset *ZSet) {
+	k.remove(key)
+	if zset.Len() > 0 {
+		k.insert(key, &Data{Type: TypeZSet, ZSet: zset})
+	}
+}
+
+// LookupStream returns the stream stored at key, nil when the key is
+// missing
+func (k *Keyspace) LookupStream(key string) (*Stream, error) {
+	data := k.lookup(key)
+	if data == nil {
+		return nil, nil
+	}
+	if data.Type != TypeStream {
+		return nil, ErrWrongType
+	}
+	return data.Stream, nil
+}
+
+// LookupOrCreateStream is LookupStream that creates an empty stream for a
+// missing key, empty streams are kept
+func (k *Keyspace) LookupOrCreateStream(key string) (*Stream, error) {
+	stream, err := k.LookupStream(key)
+	if err != nil || stream != nil {
+		return stream, err
+	}
+
+	stream = NewStream()
+	k.insert(key, &Data{Type: TypeStream, Stream: stream})
+	return stream, nil
+}
+
+// DeleteIfEmpty removes a container key whose last element was removed
+func (k *Keyspace) DeleteIfEmpty(key string) {
+	if data := k.lookup(key); data != nil && data.isEmpty() {
+		k.remove(key)
+	}
+}
+
+// Rename moves the value and TTL of src to dst, overwriting dst
+func (k *Keyspace) Rename(src, dst string) error {
+	data := k.lookup(src)
+	if data == nil {
+		return ErrKeyNotFound
+	}
+	if src == dst {
+		return nil
+	}
+
+	k.remove(src)
+	k.remove(dst)
+	k.insert(dst, data)
+	return nil
+}
+
+// Copy duplicates src with its TTL into dst, false when dst exists and
+// replace is not set
+func (k *Keyspace) Copy(src, dst string, replace bool) (bool, error) {
+	data := k.lookup(src)
+	if data == nil {
+		return false, ErrKeyNotFound
+	}
+	if k.lookup(dst) != nil {
+		if !replace {
+			return false, nil
+		}
+		k.remove(dst)
+	}
+
+	k.insert(dst, data.clone())
+	return true, nil
+}
+
+// ExpireDate returns the unix time in milliseconds the key expires at,
+// -1 when the key has no TTL
+func (k *Keyspace) ExpireDate(key string) (int64, error) {
+	data := k.lookup(key)
+	if data == nil {
+		return 0, ErrKeyNotFound
+	}
+	if !data.ExpeireEnabled {
+		return -1, nil
+	}
+	return data.ExpeireDate, nil
+}
+
+// SetExpireDate gives the key a TTL ending at when, a date in the past
+// deletes the key right away unless the AOF is loading
+func (k *Keyspace) SetExpireDate(key string, when int64) error {
+	data := k.lookup(key)
+	if data == nil {
+		return ErrKeyNotFound
+	}
+	if when <= time.Now().UnixMilli() && !k.Loading() {
+		k.remove(key)
+		return nil
+	}
+
+	shard := k.shardFor(key)
+	if !data.ExpeireEnabled {
+		shard.expires[key] = struct{}{}
+		k.volatile.Add(1)
+	}
+	data.ExpeireEnabled = true
+	data.ExpeireDate = when
+	return nil
+}
+
+// Persist removes the TTL of the key, false when it had none
+func (k *Keyspace) Persist(key string) (bool, error) {
+	data := k.lookup(key)
+	if data == nil {
+		return false, ErrKeyNotFound
+	}
+	if !data.ExpeireEnabled {
+		return false, nil
+	}
+
+	delete(k.shardFor(key).expires, key)
+	k.volatile.Add(-1)
+	data.ExpeireEnabled = false
+	data.ExpeireDate = 0
+	return true, nil
+}
+
+func (k *Keyspace) GetAllKeys() []string {
+	now := time.Now().UnixMilli()
+	keys := []string{}
+	for _, shard := range k.shards {
+		for _, table := range shard.tables {
+			for key, data := range table {
+				if !k.expireIfNeeded(key, data, now) {
+					keys = append(keys, key)
+				}
+			}
+		}
+	}
+	return keys
+}
+
+// Scan returns the keys of the tables starting at cursor until at least
+// count keys were found, and the cursor to continue from which is 0 once
+// every table was visited. Tables never move keys around, so a key that
+// exists for the whole iteration is returned exactly once.
+func (k *Keyspace) Scan(cursor uint64, count int) (uint64, []string, error) {
+	if cursor >= tableCount {
+		return 0, nil, ErrInvalidCursor
+	}
+
+	now := time.Now().UnixMilli()
+	keys := []string{}
+	// like redis, give up on empty tables after a while
+	for visited := 0; visited < count*10; visited++ {
+		shard := k.shards[cursor%shardCount]
+		for key, data := range shard.tables[cursor/shardCount] {
+			if !k.expireIfNeeded(key, data, now) {
+				keys = append(keys, key)
+			}
+		}
+
+		cursor++
+		if cursor == tableCount {
+			return 0, keys, nil
+		}
+		if len(keys) >= count {
+			break
+		}
+	}
+	return cursor, keys, nil
+}
+
+// SetLoading turns expiration off while the AOF is replayed, it is turned
+// back on before the active expire cycle starts
+func (k *Keyspace) SetLoading(loading bool) {
+	k.loading.Store(loading)
+}
+
+func (k *Keyspace) Loading() bool {
+	return k.loading.Load()
+}
+
+func (k *Keyspace) KeyCount() int64 {
+	return k.keys.Load()
+}
+
+func (k *Keyspace) ExpiresCount() int64 {
+	return k.volatile.Load()
+}
+
+// ExpiredKeys counts every key removed because its TTL passed
+func (k *Keyspace) ExpiredKeys() int64 {
+	return k.expiredKeys.Load()
+}
+
+// lookup returns nil for missing keys and expires the key when its
+// TTL passed, which is the lazy half of expiration
+func (k *Keyspace) lookup(key string) *Data {
+	data, ok := k.shardFor(key).get(key)
+	if !ok {
+		return nil
+	}
+	// callers may change what they get
+	k.preserve(key)
+	if k.expireIfNeeded(key, data, time.Now().UnixMilli()) {
+		return nil
+	}
+	return data
+}
+
+// expireIfNeeded removes the key when its TTL passed, or when it is a hash
+// whose last fields expired, true when the key is gone
+func (k *Keyspace) expireIfNeeded(key string, data *Data, now int64) bool {
+	if k.Loading() {
+		return false
+	}
+	if data.isExpired(now) {
+		k.expire(key)
+		return true
+	}
+	if data.Type == TypeHash && data.Hash.hasExpiredFields(now) {
+		k.preserve(key)
+		data.Hash.expireFields(now)
+		if data.Hash.Len() == 0 {
+			k.remove(key)
+			return true
+		}
+	}
+	return false
+}
+
+// insert replaces whatever the key held and keeps the counters and the
+// expires index in sync with the new data
+func (k *Keyspace) insert(key string, data *Data) {
+	k.preserve(key)
+	shard := k.shardFor(key)
+	old, exists := shard.get(key)
+	if !exists {
+		k.keys.Add(1)
+	}
+	if exists && old.ExpeireEnabled && !data.ExpeireEnabled {
+		delete(shard.expires, key)
+		k.volatile.Add(-1)
+	}
+	if data.ExpeireEnabled && (!exists || !old.ExpeireEnabled) {
+		shard.expires[key] = struct{}{}
+		k.volatile.Add(1)
+	}
+	if data.Type == TypeHash && data.Hash.volatile > 0 {
+		shard.hexpires[key] = struct{}{}
+	} else {
+		delete(shard.hexpires, key)
+	}
+
+	shard.set(key, data)
+}
+
+func (k *Keyspace) remove(key string) bool {
+	k.preserve(key)
+	shard := k.shardFor(key)
+	data, exists := shard.get(key)
+	if !exists {
+		return false
+	}
+	if data.ExpeireEnabled {
+		delete(shard.expires, key)
+		k.volatile.Add(-1)
+	}
+
+	delete(shard.hexpires, key)
+	shard.delete(key)
+	k.keys.Add(-1)
+	return true
+}
+
+func (k *Keyspace) expire(key string) {
+	if k.remove(key) {
+		k.expiredKeys.Add(1)
+	}
+}
+
+func (k *Keyspace) shardFor(key string) *shard {
+	return k.shards[keyHash(key)%shardCount]
+}
+
+func (s *shard) get(key string) (*Data, bool) {
+	data, ok := s.tables[tableIndex(key)][key]
+	return data, ok
+}
+
+func (s *shard) set(key string, data *Data) {
+	index := tableIndex(key)
+	if s.tables[index] == nil {
+		s.tables[index] = make(map[string]*Data)
+	}
+	s.tables[index][key] = data
+}
+
+func (s *shard) delete(key string) {
+	delete(s.tables[tableIndex(key)], key)
+}
+
+// the low bits of the hash pick the shard, the ones above pick the table
+func tableIndex(key string) int {
+	return int(keyHash(key) / shardCount % tablesPerShard)
+}
+
+// keyHash is fnv-1a, inlined so hashing a key does not allocate
+func keyHash(key string) uint32 {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return hash
+}
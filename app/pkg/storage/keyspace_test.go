@@ -0,0 +1,358 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testClients = 32
+	testRounds  = 500
+)
+
+// incr is what INCR does, it is only correct when nothing else touches
+// the key between the read and the write
+func incr(k *Keyspace, key string) {
+	value, _ := k.Get(key)
+	n, _ := strconv.Atoi(value)
+	k.Set(key, strconv.Itoa(n+1), nil)
+}
+
+func TestAtomicIncrementsFromManyClients(t *testing.T) {
+	k := newKeyspace(nil)
+	keys := []string{"a", "b", "c", "d"}
+
+	var wg sync.WaitGroup
+	for c := 0; c < testClients; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < testRounds; i++ {
+				key := keys[i%len(keys)]
+				k.Atomic([]string{key}, func() { incr(k, key) })
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, key := range keys {
+		value, err := k.Get(key)
+		if err != nil {
+			t.Fatalf("GET %s: %v", key, err)
+		}
+		if want := strconv.Itoa(testClients * testRounds / len(keys)); value != want {
+			t.Fatalf("%s is %s, want %s", key, value, want)
+		}
+	}
+}
+
+// keysInShards returns a key for each of count different shards
+func keysInShards(count int) []string {
+	keys := []string{}
+	seen := map[uint32]bool{}
+	for i := 0; len(keys) < count; i++ {
+		key := fmt.Sprintf("account:%d", i)
+		if shard := keyHash(key) % shardCount; !seen[shard] {
+			seen[shard] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Transfers between keys of different shards lock them in opposite orders
+// from different clients, they must neither deadlock nor be seen half done
+func TestAtomicCrossShardTransfers(t *testing.T) {
+	k := newKeyspace(nil)
+	accounts := keysInShards(8)
+	for _, key := range accounts {
+		k.Set(key, "1000", nil)
+	}
+	total := 1000 * len(accounts)
+
+	sum := func() int {
+		sum := 0
+		for _, key := range accounts {
+			value, _ := k.Get(key)
+			n, _ := strconv.Atoi(value)
+			sum += n
+		}
+		return sum
+	}
+
+	var wg sync.WaitGroup
+	for c := 0; c < testClients; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			for i := 0; i < testRounds; i++ {
+				from := accounts[(c+i)%len(accounts)]
+				to := accounts[(c+2*i+1)%len(accounts)]
+				if from == to {
+					continue
+				}
+				k.Atomic([]string{to, from}, func() {
+					value, _ := k.Get(from)
+					n, _ := strconv.Atoi(value)
+					k.Set(from, strconv.Itoa(n-1), nil)
+					value, _ = k.Get(to)
+					n, _ = strconv.Atoi(value)
+					k.Set(to, strconv.Itoa(n+1), nil)
+				})
+			}
+		}(c)
+	}
+
+	done := make(chan struct{})
+	errs := make(chan string, 1)
+	go func() {
+		defer close(errs)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			// the sum only holds if no transfer is seen in the middle
+			k.Atomic(accounts, func() {
+				if got := sum(); got != total {
+					select {
+					case errs <- fmt.Sprintf("sum is %d in the middle of transfers, want %d", got, total):
+					default:
+					}
+				}
+			})
+			k.AtomicAll(func() {
+				if got := sum(); got != total {
+					select {
+					case errs <- fmt.Sprintf("sum is %d under AtomicAll, want %d", got, total):
+					default:
+					}
+				}
+			})
+		}
+	}()
+
+	wg.Wait()
+	close(done)
+	if err, ok := <-errs; ok {
+		t.Fatal(err)
+	}
+	if got := sum(); got != total {
+		t.Fatalf("sum is %d after the transfers, want %d", got, total)
+	}
+}
+
+// A key that exists for the whole SCAN is returned exactly once, no matter
+// what other clients insert and delete in the meantime
+func TestScanDuringWrites(t *testing.T) {
+	k := newKeyspace(nil)
+	const stable = 2000
+	for i := 0; i < stable; i++ {
+		k.Set(fmt.Sprintf("stable:%d", i), "x", nil)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for c := 0; c < testClients/2; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				key := fmt.Sprintf("churn:%d:%d", c, i%200)
+				k.Atomic([]string{key}, func() {
+					if !k.Delete(key) {
+						k.Set(key, "x", nil)
+					}
+				})
+			}
+		}(c)
+	}
+
+	seen := map[string]int{}
+	cursor := uint64(0)
+	for {
+		var keys []string
+		var err error
+		k.AtomicAll(func() {
+			cursor, keys, err = k.Scan(cursor, 10)
+		})
+		if err != nil {
+			t.Fatalf("SCAN: %v", err)
+		}
+		for _, key := range keys {
+			seen[key]++
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	for i := 0; i < stable; i++ {
+		key := fmt.Sprintf("stable:%d", i)
+		if seen[key] != 1 {
+			t.Fatalf("%s was returned %d times", key, seen[key])
+		}
+	}
+}
+
+// Lazy expiry from clients and the active expire cycle race for the same
+// keys, every key must be counted as expired exactly once
+func TestExpiryFromManyClients(t *testing.T) {
+	k := newKeyspace(nil)
+	const count = 5000
+	ttl := int64(50)
+	for i := 0; i < count; i++ {
+		k.Set(fmt.Sprintf("volatile:%d", i), "x", &ttl)
+	}
+	k.Set("persistent", "x", nil)
+	if k.ExpiresCount() != count {
+		t.Fatalf("%d volatile keys, want %d", k.ExpiresCount(), count)
+	}
+
+	time.Sleep(time.Duration(ttl+10) * time.Millisecond)
+
+	done := make(chan struct{})
+	var cycle sync.WaitGroup
+	cycle.Add(1)
+	go func() {
+		defer cycle.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			k.activeExpireCycle(time.Millisecond)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for c := 0; c < testClients; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			for i := c; i < count; i += testClients {
+				key := fmt.Sprintf("volatile:%d", i)
+				k.Atomic([]string{key}, func() {
+					if _, err := k.Get(key); err == nil {
+						t.Errorf("%s exists after its TTL", key)
+					}
+				})
+			}
+		}(c)
+	}
+	for c := 0; c < 4; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				k.AtomicAll(func() { k.GetAllKeys() })
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(done)
+	cycle.Wait()
+
+	if k.KeyCount() != 1 || k.ExpiresCount() != 0 {
+		t.Fatalf("%d keys and %d volatile keys left, want 1 and 0", k.KeyCount(), k.ExpiresCount())
+	}
+	if k.ExpiredKeys() != count {
+		t.Fatalf("%d keys counted as expired, want %d", k.ExpiredKeys(), count)
+	}
+}
+
+// hashWithFieldTTL stores a hash whose field f expires after ttl and whose
+// field g, when keep is set, does not
+func hashWithFieldTTL(k *Keyspace, key string, ttl time.Duration, keep bool) {
+	hash, _ := k.LookupOrCreateHash(key)
+	hash.Set("f", "v")
+	hash.SetExpireAt("f", time.Now().Add(ttl).UnixMilli())
+	if keep {
+		hash.Set("g", "v")
+	}
+	k.TrackHashExpires(key)
+}
+
+// A hash whose fields all expired is gone for every command, not only for
+// the hash commands, and the active cycle reclaims fields nobody reads
+func TestExpiredHashFields(t *testing.T) {
+	k := newKeyspace(nil)
+	for _, key := range []string{"exists", "keys", "scan", "cycle"} {
+		hashWithFieldTTL(k, key, 20*time.Millisecond, false)
+	}
+	hashWithFieldTTL(k, "partly", 20*time.Millisecond, true)
+	time.Sleep(30 * time.Millisecond)
+
+	if k.Exists("exists") || k.Type("exists") != "none" {
+		t.Fatal("a hash without fields left exists")
+	}
+	for _, key := range k.GetAllKeys() {
+		if key == "keys" {
+			t.Fatal("KEYS returns a hash without fields left")
+		}
+	}
+	cursor, keys := uint64(0), []string{}
+	for {
+		var page []string
+		cursor, page, _ = k.Scan(cursor, 100)
+		keys = append(keys, page...)
+		if cursor == 0 {
+			break
+		}
+	}
+	for _, key := range keys {
+		if key == "scan" {
+			t.Fatal("SCAN returns a hash without fields left")
+		}
+	}
+
+	k.activeExpireCycle(time.Second)
+	if _, ok := k.shardFor("cycle").get("cycle"); ok {
+		t.Fatal("the active expire cycle kept a hash without fields left")
+	}
+	data, _ := k.shardFor("partly").get("partly")
+	if data == nil || data.Hash.Len() != 1 {
+		t.Fatal("the active expire cycle did not delete the expired field only")
+	}
+	if k.KeyCount() != 1 {
+		t.Fatalf("%d keys left, want 1", k.KeyCount())
+	}
+}
+
+// While the AOF loads nothing expires, dates in the past included, so the
+// replayed writes change the keys they changed the first time
+func TestNoExpiryWhileLoading(t *testing.T) {
+	k := newKeyspace(nil)
+	k.SetLoading(true)
+	past := time.Now().Add(-time.Second).UnixMilli()
+
+	k.Set("string", "1", nil)
+	if err := k.SetExpireDate("string", past); err != nil {
+		t.Fatalf("PEXPIREAT: %v", err)
+	}
+	if value, err := k.Get("string"); err != nil || value != "1" {
+		t.Fatalf("GET is %q, %v while loading, want 1", value, err)
+	}
+	hashWithFieldTTL(k, "hash", -time.Second, false)
+	if hash, _ := k.LookupHash("hash"); hash == nil || hash.Len() != 1 {
+		t.Fatal("a hash field expired while loading")
+	}
+
+	k.SetLoading(false)
+	if k.Exists("string") || k.Exists("hash") {
+		t.Fatal("keys did not expire once loaded")
+	}
+}
@@ -0,0 +1,363 @@
+package storage
+
+// A node is full when either limit is reached, which keeps nodes around the
+// 8kb listpacks redis uses while long lists don't pay a pointer per element
+const (
+	listNodeMaxEntries = 128
+	listNodeMaxBytes   = 8 * 1024
+)
+
+type listNode struct {
+	entries []string
+	bytes   int
+	prev    *listNode
+	next    *listNode
+}
+
+// List is a quicklist, a doubly linked list of small chunks of elements.
+// Pushes and pops at both ends are O(1) and indexing skips whole nodes.
+type List struct {
+	head   *listNode
+	tail   *listNode
+	length int
+	nodes  int
+}
+
+func NewList() *List {
+	return &List{}
+}
+
+func (l *List) Len() int {
+	return l.length
+}
+
+// IsCompact is true while the whole list fits in one node, OBJECT
+// ENCODING reports those like redis reports a listpack
+func (l *List) IsCompact() bool {
+	return l.nodes <= 1
+}
+
+func (l *List) PushHead(value string) {
+	if l.head == nil || l.head.isFull(value) {
+		node := &listNode{next: l.head}
+		if l.head != nil {
+			l.head.prev = node
+		} else {
+			l.tail = node
+		}
+		l.head = node
+		l.nodes++
+	}
+
+	l.head.entries = append(l.head.entries, "")
+	copy(l.head.entries[1:], l.head.entries)
+	l.head.entries[0] = value
+	l.head.bytes += len(value)
+	l.length++
+}
+
+func (l *List) PushTail(value string) {
+	if l.tail == nil || l.tail.isFull(value) {
+		node := &listNode{prev: l.tail}
+		if l.tail != nil {
+			l.tail.next = node
+		} else {
+			l.head = node
+		}
+		l.tail = node
+		l.nodes++
+	}
+
+	l.tail.entries = append(l.tail.entries, value)
+	l.tail.bytes += len(value)
+	l.length++
+}
+
+func (l *List) PopHead() (string, bool) {
+	if l.length == 0 {
+		return "", false
+	}
+	value := l.head.entries[0]
+	l.removeAt(l.head, 0)
+	return value, true
+}
+
+func (l *List) PopTail() (string, bool) {
+	if l.length == 0 {
+		return "", false
+	}
+	value := l.tail.entries[len(l.tail.entries)-1]
+	l.removeAt(l.tail, len(l.tail.entries)-1)
+	return value, true
+}
+
+// Index supports negative indexes counting from the tail
+func (l *List) Index(index int) (string, bool) {
+	node, offset, ok := l.locate(index)
+	if !ok {
+		return "", false
+	}
+	return node.entries[offset], true
+}
+
+func (l *List) Set(index int, value string) bool {
+	node, offset, ok := l.locate(index)
+	if !ok {
+		return false
+	}
+	node.bytes += len(value) - len(node.entries[offset])
+	node.entries[offset] = value
+	return true
+}
+
+// Range returns the elements between start and end inclusive, with the
+// same index rules as LRANGE
+func (l *List) Range(start, end int) []string {
+	start, end, ok := l.normalizeRange(start, end)
+	if !ok {
+		return []string{}
+	}
+
+	values := make([]string, 0, end-start+1)
+	node, offset, _ := l.locate(start)
+	for node != nil && len(values) < end-start+1 {
+		values = append(values, node.entries[offset])
+		offset++
+		if offset == len(node.entries) {
+			node, offset = node.next, 0
+		}
+	}
+	return values
+}
+
+// Trim keeps only the elements between start and end inclusive
+func (l *List) Trim(start, end int) {
+	start, end, ok := l.normalizeRange(start, end)
+	if !ok {
+		l.head, l.tail, l.length, l.nodes = nil, nil, 0, 0
+		return
+	}
+
+	for i := 0; i < start; i++ {
+		l.PopHead()
+	}
+	for l.length > end-start+1 {
+		l.PopTail()
+	}
+}
+
+// Remove deletes up to count elements equal to value, from the head when
+// count is positive, from the tail when negative and all of them for 0
+func (l *List) Remove(count int, value string) int {
+	removed := 0
+	if count >= 0 {
+		for node := l.head; node != nil; {
+			next := node.next
+			for i := 0; i < len(node.entries); {
+				if node.entries[i] == value && (count == 0 || removed < count) {
+					l.removeAt(node, i)
+					removed++
+					continue
+				}
+				i++
+			}
+			node = next
+		}
+		return removed
+	}
+
+	for node := l.tail; node != nil; {
+		prev := node.prev
+		for i := len(node.entries) - 1; i >= 0; i-- {
+			if node.entries[i] == value && removed < -count {
+				l.removeAt(node, i)
+				removed++
+			}
+		}
+		node = prev
+	}
+	return removed
+}
+
+// Insert puts value before or after the first pivot from the head and
+// returns the new length, or -1 when there is no pivot
+func (l *List) Insert(pivot, value string, before bool) int {
+	for node := l.head; node != nil; node = node.next {
+		for i, entry := range node.entries {
+			if entry != pivot {
+				continue
+			}
+			if !before {
+				i++
+			}
+			l.insertAt(node, i, value)
+			return l.length
+		}
+	}
+	return -1
+}
+
+// Each calls fn with every element and its index from the head, or from
+// the tail when reverse is set, until fn returns false
+func (l *List) Each(reverse bool, fn func(index int, value string) bool) {
+	if !reverse {
+		index := 0
+		for node := l.head; node != nil; node = node.next {
+			for _, entry := range node.entries {
+				if !fn(index, entry) {
+					return
+				}
+				index++
+			}
+		}
+		return
+	}
+
+	index := l.length - 1
+	for node := l.tail; node != nil; node = node.prev {
+		for i := len(node.entries) - 1; i >= 0; i-- {
+			if !fn(index, node.entries[i]) {
+				return
+			}
+			index--
+		}
+	}
+}
+
+// Values returns every element from head to tail
+func (l *List) Values() []string {
+	return l.Range(0, -1)
+}
+
+func (l *List) Clone() *List {
+	clone := NewList()
+	for node := l.head; node != nil; node = node.next {
+		for _, entry := range node.entries {
+			clone.PushTail(entry)
+		}
+	}
+	return clone
+}
+
+func (l *List) normalizeRange(start, end int) (int, int, bool) {
+	if start < 0 {
+		start = l.length + start
+	}
+	if end < 0 {
+		end = l.length + end
+	}
+	start = max(start, 0)
+	end = min(end, l.length-1)
+	if start > end || start >= l.length {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// locate finds the node holding an index, walking from the closer end
+func (l *List) locate(index int) (*listNode, int, bool) {
+	if index < 0 {
+		index = l.length + index
+	}
+	if index < 0 || index >= l.length {
+		return nil, 0, false
+	}
+
+	if index < l.length/2 {
+		node := l.head
+		for index >= len(node.entries) {
+			index -= len(node.entries)
+			node = node.next
+		}
+		return node, index, true
+	}
+
+	node := l.tail
+	fromTail := l.length - 1 - index
+	for fromTail >= len(node.entries) {
+		fromTail -= len(node.entries)
+		node = node.prev
+	}
+	return node, len(node.entries) - 1 - fromTail, true
+}
+
+func (l *List) insertAt(node *listNode, offset int, value string) {
+	if node.isFull(value) && len(node.entries) == 1 {
+		// a single big entry can't be split, the value gets a node of its
+		// own on its side
+		if offset == 0 {
+			node = l.linkAfter(node.prev)
+		} else {
+			node = l.linkAfter(node)
+		}
+		offset = 0
+	} else if node.isFull(value) {
+		// split the node in half so inserts in the middle stay cheap
+		half := len(node.entries) / 2
+		sibling := l.linkAfter(node)
+		sibling.entries = append([]string{}, node.entries[half:]...)
+		for _, entry := range sibling.entries {
+			sibling.bytes += len(entry)
+		}
+		node.entries = node.entries[:half:half]
+		node.bytes -= sibling.bytes
+
+		if offset > half {
+			node, offset = sibling, offset-half
+		}
+	}
+
+	node.entries = append(node.entries, "")
+	copy(node.entries[offset+1:], node.entries[offset:])
+	node.entries[offset] = value
+	node.bytes += len(value)
+	l.length++
+}
+
+// linkAfter adds an empty node after prev, or at the head when prev is nil
+func (l *List) linkAfter(prev *listNode) *listNode {
+	node := &listNode{prev: prev}
+	if prev != nil {
+		node.next = prev.next
+		prev.next = node
+	} else {
+		node.next = l.head
+		l.head = node
+	}
+	if node.next != nil {
+		node.next.prev = node
+	} else {
+		l.tail = node
+	}
+	l.nodes++
+	return node
+}
+
+func (l *List) removeAt(node *listNode, offset int) {
+	node.bytes -= len(node.entries[offset])
+	last := len(node.entries) - 1
+	copy(node.entries[offset:], node.entries[offset+1:])
+	// drop the reference so the removed string can be collected
+	node.entries[last] = ""
+	node.entries = node.entries[:last]
+	l.length--
+	if len(node.entries) > 0 {
+		return
+	}
+
+	if node.prev != nil {
+		node.prev.next = node.next
+	} else {
+		l.head = node.next
+	}
+	if node.next != nil {
+		node.next.prev = node.prev
+	} else {
+		l.tail = node.prev
+	}
+	l.nodes--
+}
+
+func (n *listNode) isFull(value string) bool {
+	return len(n.entries) >= listNodeMaxEntries || (len(n.entries) > 0 && n.bytes+len(value) > listNodeMaxBytes)
+}
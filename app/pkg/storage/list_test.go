@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+// checkNodes fails when a node is empty or the links and counts of the
+// list don't match its nodes
+func checkNodes(t *testing.T, l *List) {
+	t.Helper()
+	nodes, length := 0, 0
+	var prev *listNode
+	for node := l.head; node != nil; node = node.next {
+		if len(node.entries) == 0 {
+			t.Fatalf("node %d is empty", nodes)
+		}
+		if node.prev != prev {
+			t.Fatalf("node %d does not link back to the one before", nodes)
+		}
+		prev = node
+		nodes++
+		length += len(node.entries)
+	}
+	if l.tail != prev || l.nodes != nodes || l.length != length {
+		t.Fatalf("the list counts %d nodes and %d entries, it has %d and %d", l.nodes, l.length, nodes, length)
+	}
+}
+
+// A node holding a single entry bigger than a node can't be split in half,
+// inserting next to it must not leave an empty node behind
+func TestInsertNextToBigEntry(t *testing.T) {
+	big := strings.Repeat("x", 9*1024)
+	for _, before := range []bool{false, true} {
+		l := NewList()
+		l.PushHead(big)
+		if l.Insert(big, "a", before) != 2 {
+			t.Fatal("the pivot was not found")
+		}
+		checkNodes(t, l)
+
+		want := []string{big, "a"}
+		if before {
+			want = []string{"a", big}
+		}
+		for _, value := range want {
+			got, ok := l.PopHead()
+			if !ok || got != value {
+				t.Fatalf("LPOP returned %.8q, want %.8q", got, value)
+			}
+			checkNodes(t, l)
+		}
+		if l.Len() != 0 {
+			t.Fatalf("%d entries left", l.Len())
+		}
+	}
+}
+
+// Inserts in the middle of full nodes split them and keep the order
+func TestInsertSplitsFullNodes(t *testing.T) {
+	l := NewList()
+	for i := 0; i < listNodeMaxEntries; i++ {
+		l.PushTail("x")
+	}
+	l.Insert("x", "a", false)
+	checkNodes(t, l)
+	if l.nodes != 2 {
+		t.Fatalf("%d nodes after inserting into a full one, want 2", l.nodes)
+	}
+	if value, _ := l.Index(1); value != "a" {
+		t.Fatalf("the inserted value is at the wrong index, %q is there", value)
+	}
+}
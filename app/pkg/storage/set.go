@@ -0,0 +1,280 @@
+package storage
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+)
+
+// Sets of integers stay an intset up to setMaxIntsetEntries members,
+// other small sets are a compact slice like the listpacks of redis
+const (
+	setMaxIntsetEntries  = 512
+	setMaxCompactEntries = 128
+	setMaxCompactValue   = 64
+)
+
+type setEncoding int
+
+const (
+	setIntset setEncoding = iota
+	setCompact
+	setHashtable
+)
+
+type setEntry struct {
+	member  string
+	deleted bool
+}
+
+// Set is a set of strings in one of three encodings. An intset is a
+// sorted slice of integers, a compact set a slice of members searched
+// linearly and a hashtable indexes its slots with a map and reuses the
+// slots of removed members. Members never move to another slot in that
+// mode, so the slot is a stable SSCAN cursor. Sets only ever upgrade.
+type Set struct {
+	encoding setEncoding
+	intset   []int64
+	entries  []setEntry
+	index    map[string]int
+	free     []int
+	length   int
+}
+
+func NewSet() *Set {
+	return &Set{}
+}
+
+func (s *Set) Len() int {
+	return s.length
+}
+
+// Encoding is what OBJECT ENCODING reports
+func (s *Set) Encoding() string {
+	switch s.encoding {
+	case setIntset:
+		return "intset"
+	case setCompact:
+		return "listpack"
+	}
+	return "hashtable"
+}
+
+func (s *Set) Contains(member string) bool {
+	switch s.encoding {
+	case setIntset:
+		value, ok := parseSetInteger(member)
+		if !ok {
+			return false
+		}
+		_, found := s.searchIntset(value)
+		return found
+	case setCompact:
+		return s.findCompact(member) >= 0
+	}
+	_, ok := s.index[member]
+	return ok
+}
+
+// Add is false when the member was already in the set
+func (s *Set) Add(member string) bool {
+	if s.encoding == setIntset {
+		value, ok := parseSetInteger(member)
+		if ok {
+			at, found := s.searchIntset(value)
+			if found {
+				return false
+			}
+			s.intset = append(s.intset, 0)
+			copy(s.intset[at+1:], s.intset[at:])
+			s.intset[at] = value
+			s.length++
+			if s.length > setMaxIntsetEntries {
+				s.convert(setHashtable)
+			}
+			return true
+		}
+
+		if s.length < setMaxCompactEntries && len(member) <= setMaxCompactValue {
+			s.convert(setCompact)
+		} else {
+			s.convert(setHashtable)
+		}
+	}
+
+	if s.Contains(member) {
+		return false
+	}
+	if s.encoding == setCompact && (s.length >= setMaxCompactEntries || len(member) > setMaxCompactValue) {
+		s.convert(setHashtable)
+	}
+
+	entry := setEntry{member: member}
+	switch {
+	case s.encoding == setCompact:
+		s.entries = append(s.entries, entry)
+	case len(s.free) > 0:
+		slot := s.free[len(s.free)-1]
+		s.free = s.free[:len(s.free)-1]
+		s.entries[slot] = entry
+		s.index[member] = slot
+	default:
+		s.entries = append(s.entries, entry)
+		s.index[member] = len(s.entries) - 1
+	}
+	s.length++
+	return true
+}
+
+// Remove is false when the member was not in the set
+func (s *Set) Remove(member string) bool {
+	switch s.encoding {
+	case setIntset:
+		value, ok := parseSetInteger(member)
+		if !ok {
+			return false
+		}
+		at, found := s.searchIntset(value)
+		if !found {
+			return false
+		}
+		s.intset = append(s.intset[:at], s.intset[at+1:]...)
+	case setCompact:
+		at := s.findCompact(member)
+		if at < 0 {
+			return false
+		}
+		s.entries = append(s.entries[:at], s.entries[at+1:]...)
+	default:
+		slot, ok := s.index[member]
+		if !ok {
+			return false
+		}
+		s.entries[slot] = setEntry{deleted: true}
+		delete(s.index, member)
+		s.free = append(s.free, slot)
+	}
+	s.length--
+	return true
+}
+
+// Each calls fn for every member until it returns false, intsets are
+// walked in ascending order
+func (s *Set) Each(fn func(member string) bool) {
+	if s.encoding == setIntset {
+		for _, value := range s.intset {
+			if !fn(strconv.FormatInt(value, 10)) {
+				return
+			}
+		}
+		return
+	}
+	for _, entry := range s.entries {
+		if !entry.deleted && !fn(entry.member) {
+			return
+		}
+	}
+}
+
+func (s *Set) Members() []string {
+	members := make([]string, 0, s.length)
+	s.Each(func(member string) bool {
+		members = append(members, member)
+		return true
+	})
+	return members
+}
+
+// Random returns a random member, the set must not be empty
+func (s *Set) Random() string {
+	switch s.encoding {
+	case setIntset:
+		return strconv.FormatInt(s.intset[rand.Intn(len(s.intset))], 10)
+	case setCompact:
+		return s.entries[rand.Intn(len(s.entries))].member
+	}
+
+	// slots are mostly in use since they are reused, fall back to a walk
+	// when we keep hitting free ones
+	for i := 0; i < 100; i++ {
+		if entry := s.entries[rand.Intn(len(s.entries))]; !entry.deleted {
+			return entry.member
+		}
+	}
+	members := s.Members()
+	return members[rand.Intn(len(members))]
+}
+
+// Scan returns the members of the slots starting at cursor until count
+// members were found, and the cursor to continue from which is 0 at the
+// end. Intsets and compact sets are returned whole like redis does.
+func (s *Set) Scan(cursor uint64, count int) (uint64, []string) {
+	if s.encoding != setHashtable {
+		return 0, s.Members()
+	}
+
+	members := []string{}
+	for ; cursor < uint64(len(s.entries)); cursor++ {
+		if len(members) >= count {
+			return cursor, members
+		}
+		if entry := s.entries[cursor]; !entry.deleted {
+			members = append(members, entry.member)
+		}
+	}
+	return 0, members
+}
+
+func (s *Set) Clone() *Set {
+	clone := *s
+	clone.intset = append([]int64{}, s.intset...)
+	clone.entries = append([]setEntry{}, s.entries...)
+	clone.free = append([]int{}, s.free...)
+	if s.index != nil {
+		clone.index = make(map[string]int, len(s.index))
+		for member, slot := range s.index {
+			clone.index[member] = slot
+		}
+	}
+	return &clone
+}
+
+func (s *Set) convert(encoding setEncoding) {
+	members := s.Members()
+	s.intset = nil
+	s.entries = make([]setEntry, 0, len(members))
+	for _, member := range members {
+		s.entries = append(s.entries, setEntry{member: member})
+	}
+	if encoding == setHashtable {
+		s.index = make(map[string]int, len(members))
+		for slot, member := range members {
+			s.index[member] = slot
+		}
+	}
+	s.encoding = encoding
+}
+
+func (s *Set) searchIntset(value int64) (int, bool) {
+	at := sort.Search(len(s.intset), func(i int) bool { return s.intset[i] >= value })
+	return at, at < len(s.intset) && s.intset[at] == value
+}
+
+func (s *Set) findCompact(member string) int {
+	for i, entry := range s.entries {
+		if entry.member == member {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseSetInteger only accepts the canonical form of an integer, so "01"
+// stays a string member distinct from "1"
+func parseSetInteger(member string) (int64, bool) {
+	value, err := strconv.ParseInt(member, 10, 64)
+	if err != nil || strconv.FormatInt(value, 10) != member {
+		return 0, false
+	}
+	return value, true
+}
@@ -0,0 +1,100 @@
+package storage
+
+import "time"
+
+// Snapshot is a point in time copy of the keyspace for BGSAVE and the AOF
+// rewrite, taken one shard at a time so commands are only held up while
+// their own shard is copied. Until its shard is copied, the first change
+// to a key saves the value it had for the snapshot, which is what the
+// copy on write of the fork of redis does for its pages.
+type Snapshot struct {
+	keyspace *Keyspace
+	now      int64
+	// saved has the values of the keys changed before their shard was
+	// copied, nil for a key that did not exist yet
+	saved  [shardCount]map[string]*Data
+	copied [shardCount]bool
+}
+
+// StartSnapshot takes the point in time the snapshot shows, it has to run
+// inside AtomicAll. Copy must be called once afterwards, until then every
+// change keeps the old value around.
+func (k *Keyspace) StartSnapshot() *Snapshot {
+	snapshot := &Snapshot{keyspace: k, now: time.Now().UnixMilli()}
+	for i := range snapshot.saved {
+		snapshot.saved[i] = make(map[string]*Data)
+	}
+	k.snapshots = append(k.snapshots, snapshot)
+	return snapshot
+}
+
+// Copy returns every key and hash field that existed and did not expire
+// when the snapshot started, the copy does not change with the keyspace.
+func (s *Snapshot) Copy() map[string]Data {
+	k := s.keyspace
+	copied := make(map[string]Data, k.keys.Load())
+	for i, shard := range k.shards {
+		shard.mu.Lock()
+		for key, data := range s.saved[i] {
+			if data != nil {
+				s.add(copied, key, data)
+			}
+		}
+		for _, table := range shard.tables {
+			for key, data := range table {
+				if _, changed := s.saved[i][key]; !changed {
+					s.add(copied, key, data.clone())
+				}
+			}
+		}
+		s.copied[i] = true
+		s.saved[i] = nil
+		shard.mu.Unlock()
+	}
+
+	k.AtomicAll(func() {
+		for i, snapshot := range k.snapshots {
+			if snapshot == s {
+				k.snapshots = append(k.snapshots[:i], k.snapshots[i+1:]...)
+				break
+			}
+		}
+	})
+	return copied
+}
+
+// add keeps data, a copy of its own, unless it expired at the snapshot
+func (s *Snapshot) add(copied map[string]Data, key string, data *Data) {
+	if data.isExpired(s.now) {
+		return
+	}
+	if data.Type == TypeHash {
+		data.Hash.expireFields(s.now)
+		if data.Hash.Len() == 0 {
+			return
+		}
+	}
+	copied[key] = *data
+}
+
+// preserve saves the value of key for the snapshots that did not copy its
+// shard yet, it is called with the shard locked before the key changes
+func (k *Keyspace) preserve(key string) {
+	if len(k.snapshots) == 0 {
+		return
+	}
+	index := keyHash(key) % shardCount
+	for _, snapshot := range k.snapshots {
+		if snapshot.copied[index] {
+			continue
+		}
+		if _, saved := snapshot.saved[index][key]; saved {
+			continue
+		}
+		data, _ := k.shards[index].get(key)
+		if data != nil {
+			data = data.clone()
+		}
+		snapshot.saved[index][key] = data
+	}
+}
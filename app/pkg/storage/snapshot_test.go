@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// The copy shows the keyspace as it was when the snapshot started, while
+// many clients change, delete and add keys in the shards it did not reach
+func TestSnapshotWhileClientsWrite(t *testing.T) {
+	k := newKeyspace(nil)
+	const count = 5000
+	for i := 0; i < count; i++ {
+		k.Set(fmt.Sprintf("string:%d", i), "0", nil)
+		list, _ := k.LookupOrCreateList(fmt.Sprintf("list:%d", i))
+		list.PushTail("0")
+		hash, _ := k.LookupOrCreateHash(fmt.Sprintf("hash:%d", i))
+		hash.Set("f", "0")
+	}
+
+	var snapshot *Snapshot
+	k.AtomicAll(func() {
+		snapshot = k.StartSnapshot()
+	})
+
+	var wg sync.WaitGroup
+	for c := 0; c < testClients; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			for i := c; i < count; i += testClients {
+				keys := []string{fmt.Sprintf("string:%d", i), fmt.Sprintf("list:%d", i), fmt.Sprintf("hash:%d", i), fmt.Sprintf("new:%d", i)}
+				k.Atomic(keys, func() {
+					incr(k, keys[0])
+					list, _ := k.LookupList(keys[1])
+					list.PushTail("1")
+					if i%2 == 0 {
+						k.Delete(keys[2])
+					} else {
+						hash, _ := k.LookupHash(keys[2])
+						hash.Set("f", "1")
+					}
+					k.Set(keys[3], "x", nil)
+				})
+			}
+		}(c)
+	}
+	copied := snapshot.Copy()
+	wg.Wait()
+
+	if len(copied) != 3*count {
+		t.Fatalf("the snapshot has %d keys, want %d", len(copied), 3*count)
+	}
+	for i := 0; i < count; i++ {
+		if data := copied[fmt.Sprintf("string:%d", i)]; data.Value != "0" {
+			t.Fatalf("string:%d is %q in the snapshot, want 0", i, data.Value)
+		}
+		if data := copied[fmt.Sprintf("list:%d", i)]; data.List == nil || data.List.Len() != 1 {
+			t.Fatalf("list:%d changed in the snapshot", i)
+		}
+		data := copied[fmt.Sprintf("hash:%d", i)]
+		if data.Hash == nil {
+			t.Fatalf("hash:%d is missing from the snapshot", i)
+		}
+		if value, _ := data.Hash.Get("f"); value != "0" {
+			t.Fatalf("hash:%d changed in the snapshot", i)
+		}
+	}
+
+	// the keyspace went on without the snapshot
+	value, _ := k.Get("string:0")
+	if n, _ := strconv.Atoi(value); n != 1 {
+		t.Fatalf("string:0 is %s, want 1", value)
+	}
+	if len(k.snapshots) != 0 {
+		t.Fatal("the snapshot is still kept after its copy")
+	}
+}
@@ -1,7 +1,56 @@
 package storage
 
+import "errors"
+
+var (
+	ErrKeyNotFound   = errors.New("this key is not setted")
+	ErrKeyExpired    = errors.New("this data is expeired")
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrWrongType     = errors.New("Operation against a key holding the wrong kind of value")
+)
+
+// StorageInterface data operations are not synchronized, callers run
+// them inside Atomic or AtomicAll covering every key they touch.
 type StorageInterface interface {
 	Get(key string) (string, error)
 	Set(key string, value string, experie *int64) error
+	SetKeepTTL(key string, value string) error
 	GetAllKeys() []string
+	StartSnapshot() *Snapshot
+	Scan(cursor uint64, count int) (uint64, []string, error)
+	Delete(key string) bool
+	Exists(key string) bool
+	Type(key string) string
+	Encoding(key string) (string, error)
+	Rename(src, dst string) error
+	Copy(src, dst string, replace bool) (bool, error)
+
+	ExpireDate(key string) (int64, error)
+	SetExpireDate(key string, when int64) error
+	Persist(key string) (bool, error)
+
+	LookupList(key string) (*List, error)
+	LookupOrCreateList(key string) (*List, error)
+	LookupHash(key string) (*Hash, error)
+	LookupOrCreateHash(key string) (*Hash, error)
+	TrackHashExpires(key string)
+	LookupSet(key string) (*Set, error)
+	LookupOrCreateSet(key string) (*Set, error)
+	StoreSet(key string, set *Set)
+	LookupZSet(key string) (*ZSet, error)
+	LookupOrCreateZSet(key string) (*ZSet, error)
+	StoreZSet(key string, zset *ZSet)
+	LookupStream(key string) (*Stream, error)
+	LookupOrCreateStream(key string) (*Stream, error)
+	DeleteIfEmpty(key string)
+
+	KeyCount() int64
+	ExpiresCount() int64
+	ExpiredKeys() int64
+	SetLoading(loading bool)
+	Loading() bool
+	StartActiveExpire()
+
+	Atomic(keys []string, fn func())
+	AtomicAll(fn func())
 }
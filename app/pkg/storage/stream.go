@@ -0,0 +1,506 @@
+package storage
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// StreamNodeMaxEntries is stream-node-max-entries of redis, how many
+// entries share a node and a listpack of the RDB file
+const StreamNodeMaxEntries = 100
+
+type StreamID struct {
+	Ms, Seq uint64
+}
+
+// MaxStreamID is the last ID a stream can ever reach
+var MaxStreamID = StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+func (id StreamID) Less(other StreamID) bool {
+	return id.Ms < other.Ms || (id.Ms == other.Ms && id.Seq < other.Seq)
+}
+
+func (id StreamID) IsZero() bool {
+	return id.Ms == 0 && id.Seq == 0
+}
+
+// Next is the smallest ID after id, false when id is the last one
+func (id StreamID) Next() (StreamID, bool) {
+	switch {
+	case id.Seq < math.MaxUint64:
+		return StreamID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	case id.Ms < math.MaxUint64:
+		return StreamID{Ms: id.Ms + 1}, true
+	}
+	return id, false
+}
+
+// Prev is the largest ID before id, false when id is 0-0
+func (id StreamID) Prev() (StreamID, bool) {
+	switch {
+	case id.Seq > 0:
+		return StreamID{Ms: id.Ms, Seq: id.Seq - 1}, true
+	case id.Ms > 0:
+		return StreamID{Ms: id.Ms - 1, Seq: math.MaxUint64}, true
+	}
+	return id, false
+}
+
+// StreamEntry is an entry of a stream, Fields holds the field value
+// pairs in the order they were added
+type StreamEntry struct {
+	ID     StreamID
+	Fields []string
+}
+
+// streamNode is a run of consecutive entries like the listpacks hanging
+// from the radix tree of redis
+type streamNode struct {
+	entries []StreamEntry
+}
+
+// Stream is an append only log of entries ordered by ID. Entries live in
+// nodes of up to StreamNodeMaxEntries, and the nodes sit in a slice
+// sorted by ID which plays the part of the radix tree of redis: a lookup
+// is a binary search on the nodes and then on the entries of one node.
+type Stream struct {
+	nodes  []*streamNode
+	length int
+
+	LastID StreamID
+	// MaxDeletedID is the largest ID XDEL removed, it tells whether
+	// consumer groups can trust their read counters
+	MaxDeletedID StreamID
+	// EntriesAdded counts every entry ever added
+	EntriesAdded uint64
+
+	Groups map[string]*ConsumerGroup
+}
+
+func NewStream() *Stream {
+	return &Stream{Groups: make(map[string]*ConsumerGroup)}
+}
+
+func (s *Stream) Len() int {
+	return s.length
+}
+
+// Nodes is how many nodes hold the entries
+func (s *Stream) Nodes() int {
+	return len(s.nodes)
+}
+
+// Add appends an entry, id has to be greater than LastID
+func (s *Stream) Add(id StreamID, fields []string) {
+	if len(s.nodes) == 0 || len(s.nodes[len(s.nodes)-1].entries) >= StreamNodeMaxEntries {
+		s.nodes = append(s.nodes, &streamNode{entries: make([]StreamEntry, 0, 8)})
+	}
+	node := s.nodes[len(s.nodes)-1]
+	node.entries = append(node.entries, StreamEntry{ID: id, Fields: fields})
+	s.length++
+	s.LastID = id
+	s.EntriesAdded++
+}
+
+func (s *Stream) First() (StreamEntry, bool) {
+	if s.length == 0 {
+		return StreamEntry{}, false
+	}
+	return s.nodes[0].entries[0], true
+}
+
+func (s *Stream) Last() (StreamEntry, bool) {
+	if s.length == 0 {
+		return StreamEntry{}, false
+	}
+	node := s.nodes[len(s.nodes)-1]
+	return node.entries[len(node.entries)-1], true
+}
+
+func (s *Stream) Get(id StreamID) (StreamEntry, bool) {
+	node, at, found := s.find(id)
+	if !found {
+		return StreamEntry{}, false
+	}
+	return s.nodes[node].entries[at], true
+}
+
+// Range returns the entries from start to end inclusive, walking back
+// from end when reverse is set, and at most count of them unless count
+// is 0
+func (s *Stream) Range(start, end StreamID, reverse bool, count int) []StreamEntry {
+	entries := []StreamEntry{}
+	if end.Less(start) {
+		return entries
+	}
+
+	full := func() bool {
+		return count > 0 && len(entries) >= count
+	}
+	if reverse {
+		// start at end or at the last entry before it
+		node, at, found := s.find(end)
+		if !found {
+			at--
+		}
+		for node >= 0 {
+			if node == len(s.nodes) || at < 0 {
+				node--
+				if node >= 0 {
+					at = len(s.nodes[node].entries) - 1
+				}
+				continue
+			}
+			entry := s.nodes[node].entries[at]
+			if entry.ID.Less(start) || full() {
+				break
+			}
+			entries = append(entries, entry)
+			at--
+		}
+		return entries
+	}
+
+	node, at, _ := s.find(start)
+	for ; node < len(s.nodes); node++ {
+		for ; at < len(s.nodes[node].entries); at++ {
+			entry := s.nodes[node].entries[at]
+			if end.Less(entry.ID) || full() {
+				return entries
+			}
+			entries = append(entries, entry)
+		}
+		at = 0
+	}
+	return entries
+}
+
+// Delete removes the entry with id, false when there is none
+func (s *Stream) Delete(id StreamID) bool {
+	node, at, found := s.find(id)
+	if !found {
+		return false
+	}
+
+	entries := s.nodes[node].entries
+	s.nodes[node].entries = append(entries[:at], entries[at+1:]...)
+	if len(s.nodes[node].entries) == 0 {
+		s.nodes = append(s.nodes[:node], s.nodes[node+1:]...)
+	}
+	s.length--
+	if s.MaxDeletedID.Less(id) {
+		s.MaxDeletedID = id
+	}
+	return true
+}
+
+// TrimMaxLen removes the oldest entries until at most maxLen are left.
+// Approximate trimming only drops whole nodes, limit caps how many
+// entries it removes unless it is 0.
+func (s *Stream) TrimMaxLen(maxLen int, approx bool, limit int) int {
+	return s.trim(func(count int, last StreamID) bool {
+		return s.length-count >= maxLen
+	}, approx, limit)
+}
+
+// TrimMinID removes the entries older than minID, see TrimMaxLen
+func (s *Stream) TrimMinID(minID StreamID, approx bool, limit int) int {
+	return s.trim(func(count int, last StreamID) bool {
+		return last.Less(minID)
+	}, approx, limit)
+}
+
+// trim drops entries from the head while canRemove allows dropping the
+// first count of them, last being the ID of the last one
+func (s *Stream) trim(canRemove func(count int, last StreamID) bool, approx bool, limit int) int {
+	removed := 0
+	for len(s.nodes) > 0 {
+		node := s.nodes[0]
+		count := len(node.entries)
+		if canRemove(count, node.entries[count-1].ID) && (limit <= 0 || removed+count <= limit) {
+			s.nodes = s.nodes[1:]
+			s.length -= count
+			removed += count
+			continue
+		}
+		if approx {
+			break
+		}
+
+		at := 0
+		for at < count && canRemove(at+1, node.entries[at].ID) {
+			at++
+		}
+		node.entries = node.entries[at:]
+		s.length -= at
+		removed += at
+		break
+	}
+	return removed
+}
+
+// find returns the node and the position of the entry with id, or where
+// it would be inserted when found is false
+func (s *Stream) find(id StreamID) (int, int, bool) {
+	node := sort.Search(len(s.nodes), func(i int) bool {
+		entries := s.nodes[i].entries
+		return !entries[len(entries)-1].ID.Less(id)
+	})
+	if node == len(s.nodes) {
+		return node, 0, false
+	}
+
+	entries := s.nodes[node].entries
+	at := sort.Search(len(entries), func(i int) bool {
+		return !entries[i].ID.Less(id)
+	})
+	return node, at, at < len(entries) && entries[at].ID == id
+}
+
+func (s *Stream) Clone() *Stream {
+	clone := *s
+	clone.nodes = make([]*streamNode, 0, len(s.nodes))
+	for _, node := range s.nodes {
+		clone.nodes = append(clone.nodes, &streamNode{entries: append([]StreamEntry{}, node.entries...)})
+	}
+	clone.Groups = make(map[string]*ConsumerGroup, len(s.Groups))
+	for name, group := range s.Groups {
+		clone.Groups[name] = group.clone()
+	}
+	return &clone
+}
+
+// CreateGroup is false when the group already exists, entriesRead is -1
+// when unknown
+func (s *Stream) CreateGroup(name string, lastID StreamID, entriesRead int64) bool {
+	if _, ok := s.Groups[name]; ok {
+		return false
+	}
+	s.Groups[name] = &ConsumerGroup{
+		Name:        name,
+		LastID:      lastID,
+		EntriesRead: entriesRead,
+		Consumers:   make(map[string]*Consumer),
+	}
+	return true
+}
+
+// EntriesRead is how many entries the group read as far as the stream can
+// tell, -1 when deletions make it impossible. XINFO reports the counter of
+// the group itself and only uses this for the lag.
+func (s *Stream) EntriesRead(group *ConsumerGroup) int64 {
+	if group.EntriesRead >= 0 && !s.hasTombstonesAfter(group.LastID) {
+		return group.EntriesRead
+	}
+	added := int64(s.EntriesAdded)
+	switch {
+	case added == 0:
+		return 0
+	case s.length == 0 && !s.LastID.Less(group.LastID):
+		return added
+	case group.LastID == s.LastID:
+		return added
+	case s.LastID.Less(group.LastID):
+		return -1
+	}
+
+	// without deletions after the first entry everything before it was
+	// added and removed by trimming, so the first entry is entry added-length+1
+	first, _ := s.First()
+	if s.MaxDeletedID.IsZero() || s.MaxDeletedID.Less(first.ID) {
+		if group.LastID.Less(first.ID) {
+			return added - int64(s.length)
+		}
+		if group.LastID == first.ID {
+			return added - int64(s.length) + 1
+		}
+	}
+	return -1
+}
+
+// Lag is how many entries the group still has to read, -1 when unknown
+func (s *Stream) Lag(group *ConsumerGroup) int64 {
+	if s.EntriesAdded == 0 {
+		return 0
+	}
+	read := s.EntriesRead(group)
+	if read < 0 {
+		return -1
+	}
+	return int64(s.EntriesAdded) - read
+}
+
+// Deliver moves the group past the entry with id, keeping its read
+// counter in step when it can
+func (s *Stream) Deliver(group *ConsumerGroup, id StreamID) {
+	if group.EntriesRead >= 0 && !s.hasTombstonesAfter(group.LastID) {
+		group.EntriesRead++
+		group.LastID = id
+		return
+	}
+	group.LastID = id
+	group.EntriesRead = s.EntriesRead(group)
+}
+
+// hasTombstonesAfter is true when entries after id may have been deleted
+func (s *Stream) hasTombstonesAfter(id StreamID) bool {
+	if s.MaxDeletedID.IsZero() {
+		return false
+	}
+	return id.Less(s.MaxDeletedID)
+}
+
+// ConsumerGroup tracks what was delivered to its consumers. The pending
+// entries list is sorted by ID, every pending entry also counts for the
+// consumer owning it.
+type ConsumerGroup struct {
+	Name        string
+	LastID      StreamID
+	EntriesRead int64
+	Consumers   map[string]*Consumer
+	pending     []*PendingEntry
+}
+
+type Consumer struct {
+	Name string
+	// SeenTime is the last time it tried anything and ActiveTime the last
+	// time it got something, both in milliseconds, ActiveTime is -1 until
+	// then
+	SeenTime   int64
+	ActiveTime int64
+	Pending    int
+}
+
+type PendingEntry struct {
+	ID            StreamID
+	Consumer      *Consumer
+	DeliveryTime  int64
+	DeliveryCount int64
+}
+
+// Consumer returns the consumer with name, creating it when create is
+// set, the bool is true when it was created
+func (g *ConsumerGroup) Consumer(name string, create bool, now int64) (*Consumer, bool) {
+	if consumer, ok := g.Consumers[name]; ok || !create {
+		return consumer, false
+	}
+	consumer := &Consumer{Name: name, SeenTime: now, ActiveTime: -1}
+	g.Consumers[name] = consumer
+	return consumer, true
+}
+
+// DeleteConsumer removes the consumer with its pending entries and
+// returns how many it had
+func (g *ConsumerGroup) DeleteConsumer(name string) int {
+	consumer, ok := g.Consumers[name]
+	if !ok {
+		return 0
+	}
+	kept := g.pending[:0]
+	for _, entry := range g.pending {
+		if entry.Consumer != consumer {
+			kept = append(kept, entry)
+		}
+	}
+	clear(g.pending[len(kept):])
+	g.pending = kept
+	delete(g.Consumers, name)
+	return consumer.Pending
+}
+
+func (g *ConsumerGroup) PendingLen() int {
+	return len(g.pending)
+}
+
+func (g *ConsumerGroup) Pending(id StreamID) *PendingEntry {
+	at, found := g.searchPending(id)
+	if !found {
+		return nil
+	}
+	return g.pending[at]
+}
+
+// PendingRange returns the pending entries from start to end inclusive,
+// at most count of them unless it is 0 and only the ones of consumer
+// when it is set
+func (g *ConsumerGroup) PendingRange(start, end StreamID, count int, consumer *Consumer) []*PendingEntry {
+	entries := []*PendingEntry{}
+	at, _ := g.searchPending(start)
+	for ; at < len(g.pending) && (count <= 0 || len(entries) < count); at++ {
+		entry := g.pending[at]
+		if end.Less(entry.ID) {
+			break
+		}
+		if consumer == nil || entry.Consumer == consumer {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// AddPending records that the entry with id was delivered to consumer,
+// moving it from its previous owner if it was pending already
+func (g *ConsumerGroup) AddPending(id StreamID, consumer *Consumer, now int64) *PendingEntry {
+	at, found := g.searchPending(id)
+	if found {
+		entry := g.pending[at]
+		g.Claim(entry, consumer)
+		entry.DeliveryTime = now
+		entry.DeliveryCount++
+		return entry
+	}
+
+	entry := &PendingEntry{ID: id, Consumer: consumer, DeliveryTime: now, DeliveryCount: 1}
+	g.pending = append(g.pending, nil)
+	copy(g.pending[at+1:], g.pending[at:])
+	g.pending[at] = entry
+	consumer.Pending++
+	return entry
+}
+
+// Claim hands the pending entry over to consumer
+func (g *ConsumerGroup) Claim(entry *PendingEntry, consumer *Consumer) {
+	entry.Consumer.Pending--
+	entry.Consumer = consumer
+	consumer.Pending++
+}
+
+// Ack removes the entry with id from the pending entries, false when it
+// was not pending
+func (g *ConsumerGroup) Ack(id StreamID) bool {
+	at, found := g.searchPending(id)
+	if !found {
+		return false
+	}
+	g.pending[at].Consumer.Pending--
+	g.pending = append(g.pending[:at], g.pending[at+1:]...)
+	return true
+}
+
+func (g *ConsumerGroup) searchPending(id StreamID) (int, bool) {
+	at := sort.Search(len(g.pending), func(i int) bool {
+		return !g.pending[i].ID.Less(id)
+	})
+	return at, at < len(g.pending) && g.pending[at].ID == id
+}
+
+func (g *ConsumerGroup) clone() *ConsumerGroup {
+	clone := *g
+	clone.Consumers = make(map[string]*Consumer, len(g.Consumers))
+	for name, consumer := range g.Consumers {
+		copy := *consumer
+		clone.Consumers[name] = &copy
+	}
+	clone.pending = make([]*PendingEntry, 0, len(g.pending))
+	for _, entry := range g.pending {
+		copy := *entry
+		copy.Consumer = clone.Consumers[entry.Consumer.Name]
+		clone.pending = append(clone.pending, &copy)
+	}
+	return &clone
+}
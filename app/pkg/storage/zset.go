@@ -0,0 +1,436 @@
+package storage
+
+import "math/rand"
+
+// same shape as the skiplist of redis
+const (
+	zskiplistMaxLevel = 32
+	zskiplistP        = 0.25
+)
+
+type ZEntry struct {
+	Member string
+	Score  float64
+}
+
+// ScoreRange is an interval of scores, the bounds are excluded when
+// MinEx or MaxEx are set
+type ScoreRange struct {
+	Min, Max     float64
+	MinEx, MaxEx bool
+}
+
+// LexRange is an interval of members for ZRANGEBYLEX, MinInf stands for
+// "-" and MaxInf for "+"
+type LexRange struct {
+	Min, Max       string
+	MinEx, MaxEx   bool
+	MinInf, MaxInf bool
+}
+
+type zslLevel struct {
+	forward *zslNode
+	// span is how many nodes the forward pointer skips, which is what
+	// makes ranks O(log n)
+	span int
+}
+
+type zslNode struct {
+	ZEntry
+	backward *zslNode
+	level    []zslLevel
+	slot     int
+}
+
+// ZSet is a sorted set, a skiplist ordered by score then member for
+// ranges and ranks, and a map from member to node for O(1) lookups.
+// Nodes also sit in a slot that never changes while they exist, the slot
+// is the ZSCAN cursor.
+type ZSet struct {
+	header *zslNode
+	tail   *zslNode
+	length int
+	level  int
+
+	dict  map[string]*zslNode
+	slots []*zslNode
+	free  []int
+}
+
+func NewZSet() *ZSet {
+	return &ZSet{
+		header: &zslNode{level: make([]zslLevel, zskiplistMaxLevel)},
+		level:  1,
+		dict:   make(map[string]*zslNode),
+	}
+}
+
+func (z *ZSet) Len() int {
+	return z.length
+}
+
+func (z *ZSet) Score(member string) (float64, bool) {
+	node, ok := z.dict[member]
+	if !ok {
+		return 0, false
+	}
+	return node.Score, true
+}
+
+// Add sets the score of member, true when the member is new
+func (z *ZSet) Add(member string, score float64) bool {
+	if node, ok := z.dict[member]; ok {
+		if node.Score == score {
+			return false
+		}
+		// keep the node where it is when the order does not change
+		prev, next := node.backward, node.level[0].forward
+		if (prev == nil || prev.Score < score || (prev.Score == score && prev.Member < member)) &&
+			(next == nil || next.Score > score || (next.Score == score && next.Member > member)) {
+			node.Score = score
+			return false
+		}
+		slot := node.slot
+		z.deleteNode(node)
+		z.slots[slot] = z.insert(member, score)
+		z.slots[slot].slot = slot
+		return false
+	}
+
+	node := z.insert(member, score)
+	if len(z.free) > 0 {
+		node.slot = z.free[len(z.free)-1]
+		z.free = z.free[:len(z.free)-1]
+		z.slots[node.slot] = node
+	} else {
+		node.slot = len(z.slots)
+		z.slots = append(z.slots, node)
+	}
+	return true
+}
+
+// Remove is false when the member was not in the set
+func (z *ZSet) Remove(member string) bool {
+	node, ok := z.dict[member]
+	if !ok {
+		return false
+	}
+	z.deleteNode(node)
+	z.slots[node.slot] = nil
+	z.free = append(z.free, node.slot)
+	return true
+}
+
+// Rank is the 0 based position of member, from the highest score when
+// reverse is set
+func (z *ZSet) Rank(member string, reverse bool) (int, bool) {
+	node, ok := z.dict[member]
+	if !ok {
+		return 0, false
+	}
+
+	rank := 0
+	x := z.header
+	for i := z.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !zslLess(node.ZEntry, x.level[i].forward.ZEntry) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+		if x == node {
+			break
+		}
+	}
+
+	if reverse {
+		return z.length - rank, true
+	}
+	return rank - 1, true
+}
+
+// RangeByRank returns the elements between the 0 based ranks start and
+// end inclusive, which the caller keeps inside the set
+func (z *ZSet) RangeByRank(start, end int, reverse bool) []ZEntry {
+	entries := make([]ZEntry, 0, end-start+1)
+	if reverse {
+		node := z.nodeByRank(z.length - start)
+		for ; node != nil && len(entries) < end-start+1; node = node.backward {
+			entries = append(entries, node.ZEntry)
+		}
+		return entries
+	}
+
+	node := z.nodeByRank(start + 1)
+	for ; node != nil && len(entries) < end-start+1; node = node.level[0].forward {
+		entries = append(entries, node.ZEntry)
+	}
+	return entries
+}
+
+// RangeByScore returns the elements inside r skipping offset of them and
+// returning at most limit, all of them when limit is negative
+func (z *ZSet) RangeByScore(r ScoreRange, reverse bool, offset, limit int) []ZEntry {
+	first, last := z.scoreBounds(r)
+	return z.rangeBetween(first, last, reverse, offset, limit)
+}
+
+func (z *ZSet) RangeByLex(r LexRange, reverse bool, offset, limit int) []ZEntry {
+	first, last := z.lexBounds(r)
+	return z.rangeBetween(first, last, reverse, offset, limit)
+}
+
+func (z *ZSet) CountByScore(r ScoreRange) int {
+	first, last := z.scoreBounds(r)
+	return max(last-first+1, 0)
+}
+
+func (z *ZSet) CountByLex(r LexRange) int {
+	first, last := z.lexBounds(r)
+	return max(last-first+1, 0)
+}
+
+func (z *ZSet) RemoveRangeByRank(start, end int) int {
+	return z.removeEntries(z.RangeByRank(start, end, false))
+}
+
+func (z *ZSet) RemoveRangeByScore(r ScoreRange) int {
+	return z.removeEntries(z.RangeByScore(r, false, 0, -1))
+}
+
+func (z *ZSet) RemoveRangeByLex(r LexRange) int {
+	return z.removeEntries(z.RangeByLex(r, false, 0, -1))
+}
+
+// Pop removes and returns the element with the lowest score, or the one
+// with the highest when highest is set
+func (z *ZSet) Pop(highest bool) (ZEntry, bool) {
+	node := z.header.level[0].forward
+	if highest {
+		node = z.tail
+	}
+	if node == nil {
+		return ZEntry{}, false
+	}
+	z.Remove(node.Member)
+	return node.ZEntry, true
+}
+
+// Each calls fn with the elements in order until it returns false
+func (z *ZSet) Each(fn func(entry ZEntry) bool) {
+	for node := z.header.level[0].forward; node != nil; node = node.level[0].forward {
+		if !fn(node.ZEntry) {
+			return
+		}
+	}
+}
+
+// Scan returns the elements of the slots starting at cursor until count
+// of them were found, and the cursor to continue from which is 0 at the
+// end
+func (z *ZSet) Scan(cursor uint64, count int) (uint64, []ZEntry) {
+	entries := []ZEntry{}
+	for ; cursor < uint64(len(z.slots)); cursor++ {
+		if len(entries) >= count {
+			return cursor, entries
+		}
+		if node := z.slots[cursor]; node != nil {
+			entries = append(entries, node.ZEntry)
+		}
+	}
+	return 0, entries
+}
+
+func (z *ZSet) Clone() *ZSet {
+	clone := NewZSet()
+	z.Each(func(entry ZEntry) bool {
+		clone.Add(entry.Member, entry.Score)
+		return true
+	})
+	return clone
+}
+
+func (z *ZSet) removeEntries(entries []ZEntry) int {
+	for _, entry := range entries {
+		z.Remove(entry.Member)
+	}
+	return len(entries)
+}
+
+// rangeBetween walks the elements between the 1 based ranks first and
+// last
+func (z *ZSet) rangeBetween(first, last int, reverse bool, offset, limit int) []ZEntry {
+	count := last - first + 1 - offset
+	if limit >= 0 {
+		count = min(count, limit)
+	}
+	if count <= 0 {
+		return []ZEntry{}
+	}
+
+	entries := make([]ZEntry, 0, min(count, 1024))
+	if reverse {
+		for node := z.nodeByRank(last - offset); node != nil && len(entries) < count; node = node.backward {
+			entries = append(entries, node.ZEntry)
+		}
+		return entries
+	}
+	for node := z.nodeByRank(first + offset); node != nil && len(entries) < count; node = node.level[0].forward {
+		entries = append(entries, node.ZEntry)
+	}
+	return entries
+}
+
+// scoreBounds returns the 1 based ranks of the first and the last element
+// inside r, last is smaller than first when there is none
+func (z *ZSet) scoreBounds(r ScoreRange) (int, int) {
+	belowMin := func(node *zslNode) bool {
+		return node.Score < r.Min || (r.MinEx && node.Score == r.Min)
+	}
+	upToMax := func(node *zslNode) bool {
+		return node.Score < r.Max || (!r.MaxEx && node.Score == r.Max)
+	}
+	return z.countWhile(belowMin) + 1, z.countWhile(upToMax)
+}
+
+func (z *ZSet) lexBounds(r LexRange) (int, int) {
+	belowMin := func(node *zslNode) bool {
+		if r.MinInf {
+			return false
+		}
+		return node.Member < r.Min || (r.MinEx && node.Member == r.Min)
+	}
+	upToMax := func(node *zslNode) bool {
+		if r.MaxInf {
+			return true
+		}
+		return node.Member < r.Max || (!r.MaxEx && node.Member == r.Max)
+	}
+	return z.countWhile(belowMin) + 1, z.countWhile(upToMax)
+}
+
+// countWhile counts the leading elements matching fn, which has to be
+// true up to some element and false after it
+func (z *ZSet) countWhile(fn func(node *zslNode) bool) int {
+	rank := 0
+	x := z.header
+	for i := z.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && fn(x.level[i].forward) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+	}
+	return rank
+}
+
+// nodeByRank finds the element at the 1 based rank
+func (z *ZSet) nodeByRank(rank int) *zslNode {
+	if rank < 1 || rank > z.length {
+		return nil
+	}
+
+	traversed := 0
+	x := z.header
+	for i := z.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span <= rank {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		if traversed == rank {
+			return x
+		}
+	}
+	return nil
+}
+
+func (z *ZSet) insert(member string, score float64) *zslNode {
+	entry := ZEntry{Member: member, Score: score}
+	var update [zskiplistMaxLevel]*zslNode
+	var rank [zskiplistMaxLevel]int
+
+	x := z.header
+	for i := z.level - 1; i >= 0; i-- {
+		if i < z.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.level[i].forward != nil && zslLess(x.level[i].forward.ZEntry, entry) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	level := zslRandomLevel()
+	if level > z.level {
+		for i := z.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = z.header
+			update[i].level[i].span = z.length
+		}
+		z.level = level
+	}
+
+	x = &zslNode{ZEntry: entry, level: make([]zslLevel, level)}
+	for i := 0; i < level; i++ {
+		x.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = x
+		x.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = rank[0] - rank[i] + 1
+	}
+	for i := level; i < z.level; i++ {
+		update[i].level[i].span++
+	}
+
+	if update[0] != z.header {
+		x.backward = update[0]
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x
+	} else {
+		z.tail = x
+	}
+	z.length++
+	z.dict[member] = x
+	return x
+}
+
+func (z *ZSet) deleteNode(node *zslNode) {
+	var update [zskiplistMaxLevel]*zslNode
+	x := z.header
+	for i := z.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && zslLess(x.level[i].forward.ZEntry, node.ZEntry) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	for i := 0; i < z.level; i++ {
+		if update[i].level[i].forward == node {
+			update[i].level[i].span += node.level[i].span - 1
+			update[i].level[i].forward = node.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+	if node.level[0].forward != nil {
+		node.level[0].forward.backward = node.backward
+	} else {
+		z.tail = node.backward
+	}
+	for z.level > 1 && z.header.level[z.level-1].forward == nil {
+		z.level--
+	}
+	z.length--
+	delete(z.dict, node.Member)
+}
+
+// zslLess orders by score and then by member
+func zslLess(a, b ZEntry) bool {
+	return a.Score < b.Score || (a.Score == b.Score && a.Member < b.Member)
+}
+
+func zslRandomLevel() int {
+	level := 1
+	for level < zskiplistMaxLevel && rand.Float64() < zskiplistP {
+		level++
+	}
+	return level
+}